@@ -0,0 +1,197 @@
+package bootx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/advancevillage/3rd/dbx"
+	"github.com/advancevillage/3rd/idx"
+	"github.com/advancevillage/3rd/llm"
+	"github.com/advancevillage/3rd/logx"
+	"github.com/advancevillage/3rd/notice"
+	"github.com/advancevillage/3rd/sts"
+	"github.com/advancevillage/3rd/x"
+	"golang.org/x/sync/singleflight"
+)
+
+const DefaultName = "default" // 名称为空时使用
+
+// Container 按配置延迟创建客户端, 同名客户端只创建一次, 关闭时按创建的逆序关闭
+//
+//	c := bootx.NewContainer(ctx, logger, cfg)
+//	defer c.Close()
+//	cache, err := c.Redis("default")
+type Container struct {
+	ctx    context.Context
+	logger logx.ILogger
+	cfg    *x.Cfg
+
+	sf        singleflight.Group // 同名客户端并发创建时只创建一次
+	mu        sync.Mutex         // 只保护下列字段, 不在创建客户端期间持有
+	instances map[string]any
+	closers   []namedCloser
+	closed    bool
+}
+
+type namedCloser struct {
+	key string
+	c   io.Closer
+}
+
+var ErrContainerClosed = errors.New("bootx: container closed")
+
+func NewContainer(ctx context.Context, logger logx.ILogger, cfg *x.Cfg) *Container {
+	if cfg == nil {
+		cfg = &x.Cfg{}
+	}
+	return &Container{ctx: ctx, logger: logger, cfg: cfg, instances: map[string]any{}}
+}
+
+func (c *Container) Redis(name string) (dbx.Cacher, error) {
+	return get(c, "redis", name, c.cfg.Redis, func(ctx context.Context, logger logx.ILogger, cfg *x.DsnCfg) (dbx.Cacher, error) {
+		return dbx.NewCacheRedis(ctx, logger, dbx.WithCacheDsn(cfg.Dsn))
+	})
+}
+
+func (c *Container) Sql(name string) (dbx.SqlExecutor, error) {
+	return get(c, "sql", name, c.cfg.Sql, func(ctx context.Context, logger logx.ILogger, cfg *x.DsnCfg) (dbx.SqlExecutor, error) {
+		return dbx.NewMariaSqlExecutor(ctx, logger, dbx.WithSqlDsn(cfg.Dsn))
+	})
+}
+
+func (c *Container) Cos(name string) (dbx.S3, error) {
+	return get(c, "cos", name, c.cfg.Cos, func(ctx context.Context, logger logx.ILogger, cfg *x.DsnCfg) (dbx.S3, error) {
+		return dbx.NewCosClient(ctx, cfg.Dsn)
+	})
+}
+
+func (c *Container) Sms(name string) (notice.SMS, error) {
+	return get(c, "sms", name, c.cfg.Sms, func(ctx context.Context, logger logx.ILogger, cfg *x.DsnCfg) (notice.SMS, error) {
+		return notice.NewSmsClient(ctx, logger, cfg.Dsn)
+	})
+}
+
+func (c *Container) Sts(name string) (sts.ISts, error) {
+	return get(c, "sts", name, c.cfg.Sts, func(ctx context.Context, logger logx.ILogger, cfg *x.DsnCfg) (sts.ISts, error) {
+		return sts.NewStsClient(ctx, logger, cfg.Dsn)
+	})
+}
+
+func (c *Container) Search(name string) (idx.HybridSearcher, error) {
+	return get(c, "idx", name, c.cfg.Idx, func(ctx context.Context, logger logx.ILogger, cfg *x.DsnCfg) (idx.HybridSearcher, error) {
+		return idx.NewHybridSearchClient(ctx, logger, cfg.Dsn)
+	})
+}
+
+func (c *Container) Chat(name string) (llm.LLMChat, error) {
+	return get(c, "llm", name, c.cfg.Llm, func(ctx context.Context, logger logx.ILogger, cfg *x.LlmCfg) (llm.LLMChat, error) {
+		opts := []llm.LLMOption{llm.WithSecret(cfg.Secret)}
+		if len(cfg.BaseUrl) > 0 {
+			opts = append(opts, llm.WithBaseUrl(cfg.BaseUrl))
+		}
+		if len(cfg.Model) > 0 {
+			opts = append(opts, llm.WithModel(cfg.Model))
+		}
+		if len(cfg.Mode) > 0 {
+			opts = append(opts, llm.WithMode(cfg.Mode))
+		}
+		return llm.NewBaseChat(ctx, logger, opts...)
+	})
+}
+
+// Close 按创建的逆序关闭实现了io.Closer的客户端, 重复调用无副作用
+// 关闭时仍在创建中的客户端会在创建完成后直接关闭
+func (c *Container) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+
+	var errs []error
+	for i := len(c.closers) - 1; i >= 0; i-- {
+		nc := c.closers[i]
+		if err := nc.c.Close(); err != nil {
+			c.logger.Errorw(c.ctx, "bootx: close failed", "err", err, "client", nc.key)
+			errs = append(errs, fmt.Errorf("%s: %w", nc.key, err))
+			continue
+		}
+		c.logger.Infow(c.ctx, "bootx: client closed", "client", nc.key)
+	}
+	c.closers, c.instances = nil, map[string]any{}
+	return errors.Join(errs...)
+}
+
+// get 已创建时直接返回, 创建失败不缓存以便下次重试
+// 创建在锁外进行, 单个后端连接缓慢不会阻塞其他客户端的获取和Close
+func get[T any, C any](c *Container, kind string, name string, cfgs map[string]*C, build func(ctx context.Context, logger logx.ILogger, cfg *C) (T, error)) (T, error) {
+	var zero T
+	if len(name) <= 0 {
+		name = DefaultName
+	}
+	key := kind + "." + name
+
+	// 1. 已关闭或已创建
+	v, ok, err := c.lookup(key)
+	if err != nil {
+		return zero, err
+	}
+	if ok {
+		return v.(T), nil
+	}
+
+	// 2. 查找配置
+	cfg, ok := cfgs[name]
+	if !ok || cfg == nil {
+		return zero, fmt.Errorf("bootx: %s not configured", key)
+	}
+
+	// 3. 创建客户端, 同名客户端并发获取时共享同一次创建
+	v, err, _ = c.sf.Do(key, func() (any, error) {
+		// 3.1 等待期间可能已被其他调用创建
+		if v, ok, err := c.lookup(key); err != nil || ok {
+			return v, err
+		}
+		// 3.2 同类客户端共享命名日志
+		v, err := build(c.ctx, c.logger.Named(kind), cfg)
+		if err != nil {
+			c.logger.Errorw(c.ctx, "bootx: create client failed", "err", err, "client", key)
+			return nil, err
+		}
+		// 3.3 发布实例
+		closer, _ := any(v).(io.Closer)
+		c.mu.Lock()
+		if c.closed {
+			c.mu.Unlock()
+			if closer != nil {
+				closer.Close()
+			}
+			return nil, ErrContainerClosed
+		}
+		c.instances[key] = v
+		if closer != nil {
+			c.closers = append(c.closers, namedCloser{key: key, c: closer})
+		}
+		c.mu.Unlock()
+		c.logger.Infow(c.ctx, "bootx: client created", "client", key)
+		return v, nil
+	})
+	if err != nil {
+		return zero, err
+	}
+	return v.(T), nil
+}
+
+func (c *Container) lookup(key string) (any, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil, false, ErrContainerClosed
+	}
+	v, ok := c.instances[key]
+	return v, ok, nil
+}
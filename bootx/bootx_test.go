@@ -0,0 +1,188 @@
+package bootx
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/advancevillage/3rd/logx"
+	"github.com/advancevillage/3rd/x"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_container(t *testing.T) {
+	var (
+		ctx    = context.TODO()
+		logger = logx.NewObservedLogger()
+		key    = []byte("0123456789abcdef")
+		path   = filepath.Join(t.TempDir(), "cfg.yaml")
+	)
+	sk, err := x.EncryptValue(key, "sts://ak:sk@ap-guangzhou")
+	assert.Nil(t, err)
+	yaml := "sms:\n  default:\n    dsn: sms://ak:sk@ap-guangzhou?sign=s&app=a&tmpl=t\n" +
+		"sts:\n  default:\n    dsn: " + sk + "\n" +
+		"cos:\n  bad:\n    dsn: cos://ak@bucket/region\n" +
+		"llm:\n  doubao:\n    secret: sk-123\n    mode: chat\n"
+	assert.Nil(t, os.WriteFile(path, []byte(yaml), 0o644))
+	cfg, err := x.NewCfg(path, x.WithCfgKey(key))
+	assert.Nil(t, err)
+
+	c := NewContainer(ctx, logger, cfg)
+	var data = map[string]struct {
+		get func() (any, error)
+		err string
+	}{
+		"case-sms": {
+			get: func() (any, error) { return c.Sms("") },
+		},
+		"case-sts-enc": {
+			get: func() (any, error) { return c.Sts(DefaultName) },
+		},
+		"case-llm": {
+			get: func() (any, error) { return c.Chat("doubao") },
+		},
+		"case-bad-dsn": {
+			get: func() (any, error) { return c.Cos("bad") },
+			err: "cos: invalid sk",
+		},
+		"case-not-configured": {
+			get: func() (any, error) { return c.Redis("") },
+			err: "bootx: redis.default not configured",
+		},
+	}
+	for n, v := range data {
+		f := func(t *testing.T) {
+			a, err := v.get()
+			if len(v.err) > 0 {
+				assert.EqualError(t, err, v.err)
+				return
+			}
+			assert.Nil(t, err)
+			b, err := v.get()
+			assert.Nil(t, err)
+			assert.Same(t, a, b)
+		}
+		t.Run(n, f)
+	}
+	assert.Nil(t, c.Close())
+	_, err = c.Sms("")
+	assert.Equal(t, ErrContainerClosed, err)
+}
+
+type testCloser struct {
+	name  string
+	order *[]string
+	err   error
+}
+
+func (c *testCloser) Close() error {
+	*c.order = append(*c.order, c.name)
+	return c.err
+}
+
+func Test_container_close(t *testing.T) {
+	var (
+		order = []string{}
+		c     = NewContainer(context.TODO(), logx.NewNopLogger(), nil)
+		cfgs  = map[string]*x.DsnCfg{"a": {}, "b": {}, "c": {}}
+	)
+	for _, name := range []string{"a", "b", "c", "a"} {
+		_, err := get(c, "test", name, cfgs, func(ctx context.Context, logger logx.ILogger, cfg *x.DsnCfg) (*testCloser, error) {
+			tc := &testCloser{name: name, order: &order}
+			if name == "b" {
+				tc.err = errors.New("boom")
+			}
+			return tc, nil
+		})
+		assert.Nil(t, err)
+	}
+	err := c.Close()
+	assert.ErrorContains(t, err, "test.b: boom")
+	assert.Equal(t, []string{"c", "b", "a"}, order)
+	assert.Nil(t, c.Close())
+	assert.Equal(t, 3, len(order))
+}
+
+func Test_container_slow(t *testing.T) {
+	var (
+		c       = NewContainer(context.TODO(), logx.NewNopLogger(), nil)
+		cfgs    = map[string]*x.DsnCfg{"slow": {}, "fast": {}}
+		order   = []string{}
+		release = make(chan struct{})
+		started = make(chan struct{})
+		built   atomic.Int32
+	)
+	slow := func(ctx context.Context, logger logx.ILogger, cfg *x.DsnCfg) (*testCloser, error) {
+		built.Add(1)
+		close(started)
+		<-release
+		return &testCloser{name: "slow", order: &order}, nil
+	}
+	// 1. 并发获取缓慢的客户端只创建一次
+	var wg sync.WaitGroup
+	res := make([]*testCloser, 3)
+	for i := range res {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			v, err := get(c, "test", "slow", cfgs, slow)
+			assert.Nil(t, err)
+			res[i] = v
+		}(i)
+	}
+	<-started
+
+	// 2. 创建期间其他客户端的获取不被阻塞
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, err := get(c, "test", "fast", cfgs, func(ctx context.Context, logger logx.ILogger, cfg *x.DsnCfg) (*testCloser, error) {
+			return &testCloser{name: "fast", order: &order}, nil
+		})
+		assert.Nil(t, err)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("lookup blocked by slow build")
+	}
+
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(1), built.Load())
+	assert.Same(t, res[0], res[1])
+	assert.Same(t, res[0], res[2])
+	assert.Nil(t, c.Close())
+	assert.Equal(t, []string{"slow", "fast"}, order)
+}
+
+func Test_container_close_building(t *testing.T) {
+	var (
+		c       = NewContainer(context.TODO(), logx.NewNopLogger(), nil)
+		cfgs    = map[string]*x.DsnCfg{"slow": {}}
+		order   = []string{}
+		release = make(chan struct{})
+		started = make(chan struct{})
+		errc    = make(chan error)
+	)
+	go func() {
+		_, err := get(c, "test", "slow", cfgs, func(ctx context.Context, logger logx.ILogger, cfg *x.DsnCfg) (*testCloser, error) {
+			close(started)
+			<-release
+			return &testCloser{name: "slow", order: &order}, nil
+		})
+		errc <- err
+	}()
+	<-started
+	// 1. 创建期间关闭不被阻塞
+	assert.Nil(t, c.Close())
+	close(release)
+	// 2. 关闭后才创建完成的客户端直接关闭
+	assert.Equal(t, ErrContainerClosed, <-errc)
+	assert.Equal(t, []string{"slow"}, order)
+}
@@ -0,0 +1,99 @@
+// xcfg 加解密配置文件中的ENC(...)值
+//
+//	xcfg genkey > cfg.key
+//	X_CFG_KEY_FILE=cfg.key xcfg enc 'redis://:pass@127.0.0.1:6379/0'
+//	xcfg dec -key-file cfg.key 'ENC(...)'
+//
+// 未指定-key和-key-file时读取X_CFG_KEY或X_CFG_KEY_FILE, 未指定值时从标准输入读取
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/advancevillage/3rd/x"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	var (
+		cmd     = os.Args[1]
+		fs      = flag.NewFlagSet(cmd, flag.ExitOnError)
+		key     = fs.String("key", "", "32位十六进制或base64密钥")
+		keyFile = fs.String("key-file", "", "密钥文件")
+	)
+	fs.Parse(os.Args[2:])
+
+	// 1. 生成密钥
+	if cmd == "genkey" {
+		k := make([]byte, 16)
+		_, err := rand.Read(k)
+		exitIf(err)
+		fmt.Println(hex.EncodeToString(k))
+		return
+	}
+
+	// 2. 读取密钥和值
+	k, err := loadKey(*key, *keyFile)
+	exitIf(err)
+	value, err := readValue(fs.Args())
+	exitIf(err)
+
+	// 3. 加解密
+	switch cmd {
+	case "enc":
+		s, err := x.EncryptValue(k, value)
+		exitIf(err)
+		fmt.Println(s)
+	case "dec":
+		s, err := x.DecryptValue(k, value)
+		exitIf(err)
+		fmt.Println(s)
+	default:
+		usage()
+	}
+}
+
+func loadKey(key string, keyFile string) ([]byte, error) {
+	if len(key) > 0 {
+		return x.ParseCfgKey(key)
+	}
+	if len(keyFile) > 0 {
+		buf, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		return x.ParseCfgKey(string(buf))
+	}
+	return x.LoadCfgKey()
+}
+
+func readValue(args []string) (string, error) {
+	if len(args) > 0 {
+		return args[0], nil
+	}
+	s, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && len(s) <= 0 {
+		return "", err
+	}
+	return strings.TrimRight(s, "\r\n"), nil
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: xcfg genkey | xcfg enc|dec [-key key | -key-file file] [value]")
+	os.Exit(2)
+}
+
+func exitIf(err error) {
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "xcfg:", err)
+		os.Exit(1)
+	}
+}
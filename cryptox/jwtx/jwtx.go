@@ -160,7 +160,7 @@ func (j *jwtx) parse(ctx context.Context, token string) (*jwt.Token, error) {
 		return []byte(j.opts.sk), nil
 	})
 	if err != nil {
-		j.logger.Errorw(ctx, "jwt parse failed", "err", err, "token", token)
+		j.logger.Errorw(ctx, "jwt parse failed", "err", err, "token", logx.Secret(token))
 		return nil, err
 	}
 	return t, nil
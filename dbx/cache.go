@@ -91,7 +91,20 @@ func newRedisClient(ctx context.Context, logger logx.ILogger, opt ...CacheOption
 	}, nil
 }
 
-var _ CacheLocker = (*redisLocker)(nil)
+// Close 关闭连接池
+func (c *redisClient) Close() error {
+	return c.rdb.Close()
+}
+
+// CacheLockRenewer 持有者续期锁, 长时间持有锁时定期调用
+type CacheLockRenewer interface {
+	Renew(ctx context.Context, key string, val string, ttl time.Duration) (bool, error)
+}
+
+var (
+	_ CacheLocker      = (*redisLocker)(nil)
+	_ CacheLockRenewer = (*redisLocker)(nil)
+)
 
 type redisLocker struct {
 	redisClient
@@ -145,6 +158,28 @@ func (c *redisLocker) Unlock(ctx context.Context, key string, val string) (bool,
 	return true, nil
 }
 
+// Renew 续期锁, 只有持有锁的客户端才能续期
+// 锁不存在或已被他人持有时返回false
+func (c *redisLocker) Renew(ctx context.Context, key string, val string, ttl time.Duration) (bool, error) {
+	lua := `
+		if redis.call("GET", KEYS[1]) == ARGV[1] then
+			return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+		else
+			return 0
+		end
+	`
+	result, err := c.rdb.Eval(ctx, lua, []string{key}, val, ttl.Milliseconds()).Result()
+	if err != nil {
+		c.logger.Errorw(ctx, "redis lock renew failed", "err", err, "key", key, "val", val)
+		return false, err
+	}
+	if result.(int64) != 1 {
+		c.logger.Warnw(ctx, "redis lock lost", "key", key, "val", val)
+		return false, nil
+	}
+	return true, nil
+}
+
 type Cacher interface {
 	CreateHashCacher(ctx context.Context, key string, exp time.Duration) HashCacher
 	CreateStringCacher(ctx context.Context, key string, exp time.Duration) StringCacher
@@ -218,6 +253,7 @@ func (c *redisCacher) hPipe(ctx context.Context, cmd string, key string, kv map[
 
 type HashCacher interface {
 	Get(ctx context.Context, fields ...string) (x.Builder, error)
+	GetAll(ctx context.Context) (x.Builder, error)
 	Del(ctx context.Context, fields ...string) error
 	Set(ctx context.Context, b x.Builder) error
 	Incr(ctx context.Context, b x.Builder) error
@@ -261,6 +297,19 @@ func (c *hashRedisCacher) Get(ctx context.Context, fields ...string) (x.Builder,
 	return x.NewBuilder(kv...), nil
 }
 
+func (c *hashRedisCacher) GetAll(ctx context.Context) (x.Builder, error) {
+	r, err := c.rc.rdb.HGetAll(ctx, c.key).Result()
+	if err != nil {
+		c.rc.logger.Errorw(ctx, "redis hash get all failed", "err", err, "key", c.key)
+		return nil, err
+	}
+	kv := make([]x.Option, 0, len(r))
+	for k, v := range r {
+		kv = append(kv, x.WithKV(k, v))
+	}
+	return x.NewBuilder(kv...), nil
+}
+
 func (c *hashRedisCacher) Set(ctx context.Context, b x.Builder) error {
 	var kv = b.Build()
 	if len(kv) <= 0 {
@@ -375,3 +424,14 @@ func (c *stringRedisCacher) Incr(ctx context.Context, incr int64) error {
 	c.rc.logger.Infow(ctx, "redis string incr success", "key", c.key, "incr", incr, "next", next)
 	return nil
 }
+
+// NewCacheCfgSource 以Redis哈希为远程配置来源, 字段为点分路径如app.port, 配合x.NewCfgLoader使用
+func NewCacheCfgSource(c Cacher, key string) x.CfgSource {
+	return x.NewKVSource("redis:"+key, func(ctx context.Context) (map[string]any, error) {
+		b, err := c.CreateHashCacher(ctx, key, 0).GetAll(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return b.Build(), nil
+	})
+}
@@ -123,6 +123,11 @@ func Test_hash(t *testing.T) {
 			assert.Nil(t, err)
 			assert.Equal(t, x.NewBuilder(v.expect...).Build(), b.Build())
 
+			// 获取全部
+			b, err = h.GetAll(ctx)
+			assert.Nil(t, err)
+			assert.Equal(t, x.NewBuilder(v.expect...).Build(), b.Build())
+
 			// 删除
 			err = h.Del(ctx, "sin")
 			assert.Nil(t, err)
@@ -2,7 +2,6 @@ package dbx
 
 import (
 	"fmt"
-	"os"
 	"testing"
 
 	"github.com/advancevillage/3rd/mathx"
@@ -103,10 +102,7 @@ func Test_mem_ldb(t *testing.T) {
 }
 
 func Test_p_ldb(t *testing.T) {
-	var pdir, _ = os.Getwd()
-	var dir = fmt.Sprintf("%s/%s", pdir, "temp")
-	os.MkdirAll(dir, os.ModePerm)
-	var s, err = NewPersistentStore(dir)
+	var s, err = NewPersistentStore(t.TempDir())
 	if err != nil {
 		t.Fatal(err)
 		return
@@ -139,5 +135,4 @@ func Test_p_ldb(t *testing.T) {
 		}
 		t.Run(n, f)
 	}
-	os.Remove(dir)
 }
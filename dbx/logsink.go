@@ -0,0 +1,356 @@
+package dbx
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/advancevillage/3rd/logx"
+)
+
+// LogSink 日志输出, 批量投递到Redis Stream, 通过logx.WithSink接入日志
+type LogSink interface {
+	io.Writer
+	Sync() error
+	Close() error
+}
+
+// LogBatch 一次投递的日志, Entries为编码后的单条日志
+type LogBatch struct {
+	Service string   `json:"service"`
+	Host    string   `json:"host"`
+	Entries []string `json:"entries"`
+}
+
+type LogSinkOption interface {
+	apply(*logSinkOption)
+}
+
+// WithLogSinkPubSub 投递使用的Redis配置, 如WithPubSubDNS WithPubSubChannel
+func WithLogSinkPubSub(opt ...PubSubOption) LogSinkOption {
+	return newFuncLogSinkOption(func(o *logSinkOption) {
+		o.pubsub = append(o.pubsub, opt...)
+	})
+}
+
+// WithLogSinkPublisher 使用指定的生产者投递, 其日志不能再写入本输出
+func WithLogSinkPublisher(p Publisher) LogSinkOption {
+	return newFuncLogSinkOption(func(o *logSinkOption) {
+		o.publisher = p
+	})
+}
+
+func WithLogSinkService(service string) LogSinkOption {
+	return newFuncLogSinkOption(func(o *logSinkOption) {
+		o.service = service
+	})
+}
+
+// WithLogSinkBatch 每批最多size条, 不足时每interval投递一次; queue为待投递上限, 超出直接写本地
+func WithLogSinkBatch(size int, interval time.Duration, queue int) LogSinkOption {
+	return newFuncLogSinkOption(func(o *logSinkOption) {
+		o.size = max(size, 1)
+		if interval > 0 {
+			o.interval = interval
+		}
+		o.queue = max(queue, o.size)
+	})
+}
+
+// WithLogSinkRetry 投递失败最多重试n次, 间隔从backoff开始翻倍
+func WithLogSinkRetry(n int, backoff time.Duration) LogSinkOption {
+	return newFuncLogSinkOption(func(o *logSinkOption) {
+		o.retry = max(n, 0)
+		o.backoff = backoff
+	})
+}
+
+// WithLogSinkFallback 投递失败时写入本地文件, 默认写标准错误
+func WithLogSinkFallback(path string, opt ...logx.FileOption) LogSinkOption {
+	return newFuncLogSinkOption(func(o *logSinkOption) {
+		o.fallback = path
+		o.fallbackOpts = opt
+	})
+}
+
+type logSinkOption struct {
+	publisher    Publisher         // 生产者
+	pubsub       []PubSubOption    // 生产者配置
+	service      string            // 服务名称
+	size         int               // 每批条数
+	interval     time.Duration     // 投递间隔
+	queue        int               // 待投递上限
+	retry        int               // 重试次数
+	backoff      time.Duration     // 重试间隔
+	fallback     string            // 本地文件
+	fallbackOpts []logx.FileOption // 本地文件切割
+}
+
+var defaultLogSinkOptions = logSinkOption{
+	size:     100,
+	interval: time.Second,
+	queue:    10000,
+	retry:    3,
+	backoff:  100 * time.Millisecond,
+}
+
+type funcLogSinkOption struct {
+	f func(*logSinkOption)
+}
+
+func (fdo *funcLogSinkOption) apply(do *logSinkOption) {
+	fdo.f(do)
+}
+
+func newFuncLogSinkOption(f func(*logSinkOption)) *funcLogSinkOption {
+	return &funcLogSinkOption{
+		f: f,
+	}
+}
+
+var _ LogSink = (*logSink)(nil)
+
+type logSink struct {
+	ctx      context.Context
+	opts     logSinkOption
+	host     string
+	fallback io.Writer
+	owned    io.Closer // 内部创建的生产者, 关闭时一并释放
+
+	mu      sync.Mutex
+	pending []string
+	closed  bool
+
+	kick  chan struct{}      // 攒满一批
+	syncs chan chan struct{} // 立即投递
+	done  chan struct{}
+	exit  chan struct{}
+	once  sync.Once
+}
+
+func NewLogSink(ctx context.Context, opt ...LogSinkOption) (LogSink, error) {
+	return newLogSink(ctx, opt...)
+}
+
+func newLogSink(ctx context.Context, opt ...LogSinkOption) (*logSink, error) {
+	// 1. 设置配置
+	opts := defaultLogSinkOptions
+	for _, o := range opt {
+		o.apply(&opts)
+	}
+
+	// 2. 生产者, 其日志不能写回本输出否则会循环投递
+	var owned io.Closer
+	if opts.publisher == nil {
+		p, err := newProducerRedis(ctx, logx.NewNopLogger(), opts.pubsub...)
+		if err != nil {
+			return nil, err
+		}
+		opts.publisher, owned = p, p
+	}
+
+	// 3. 本地兜底
+	var fallback io.Writer = os.Stderr
+	if len(opts.fallback) > 0 {
+		w, err := logx.NewRotateWriter(opts.fallback, opts.fallbackOpts...)
+		if err != nil {
+			if owned != nil {
+				owned.Close()
+			}
+			return nil, err
+		}
+		fallback = w
+	}
+
+	// 4. 设置对象
+	host, _ := os.Hostname()
+	s := &logSink{
+		ctx:      context.WithoutCancel(ctx),
+		opts:     opts,
+		host:     host,
+		fallback: fallback,
+		owned:    owned,
+		kick:     make(chan struct{}, 1),
+		syncs:    make(chan chan struct{}),
+		done:     make(chan struct{}),
+		exit:     make(chan struct{}),
+	}
+	go s.loop()
+
+	return s, nil
+}
+
+func (s *logSink) Write(p []byte) (int, error) {
+	entry := strings.TrimSuffix(string(p), "\n")
+	s.mu.Lock()
+	// 1. 关闭或积压过多时直接写本地
+	if s.closed || len(s.pending) >= s.opts.queue {
+		s.mu.Unlock()
+		return s.writeFallback([]string{entry}, len(p))
+	}
+	// 2. 攒批
+	s.pending = append(s.pending, entry)
+	full := len(s.pending) >= s.opts.size
+	s.mu.Unlock()
+	if full {
+		select {
+		case s.kick <- struct{}{}:
+		default:
+		}
+	}
+	return len(p), nil
+}
+
+// Sync 立即投递待发送的日志
+func (s *logSink) Sync() error {
+	ch := make(chan struct{})
+	select {
+	case s.syncs <- ch:
+		<-ch
+	case <-s.exit:
+	}
+	return s.syncFallback()
+}
+
+// Close 投递剩余日志后关闭, 之后的写入落到本地
+func (s *logSink) Close() error {
+	var err error
+	s.once.Do(func() {
+		s.mu.Lock()
+		s.closed = true
+		s.mu.Unlock()
+		close(s.done)
+		<-s.exit
+		// 最后一批投递完成后再释放内部创建的生产者
+		if s.owned != nil {
+			err = s.owned.Close()
+		}
+		if c, ok := s.fallback.(io.Closer); ok && s.fallback != os.Stderr {
+			if cerr := c.Close(); err == nil {
+				err = cerr
+			}
+		}
+	})
+	<-s.exit
+	return err
+}
+
+func (s *logSink) loop() {
+	defer close(s.exit)
+	var t = time.NewTicker(s.opts.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			s.flush()
+		case <-s.kick:
+			s.flush()
+		case ch := <-s.syncs:
+			s.flush()
+			close(ch)
+		case <-s.done:
+			s.flush()
+			return
+		}
+	}
+}
+
+func (s *logSink) flush() {
+	s.mu.Lock()
+	entries := s.pending
+	s.pending = nil
+	s.mu.Unlock()
+
+	for len(entries) > 0 {
+		n := min(len(entries), s.opts.size)
+		s.ship(entries[:n])
+		entries = entries[n:]
+	}
+}
+
+// ship 有限重试, 仍失败则写本地
+func (s *logSink) ship(entries []string) {
+	// 1. 编码
+	payload, err := json.Marshal(&LogBatch{Service: s.opts.service, Host: s.host, Entries: entries})
+	if err != nil {
+		s.writeFallback(entries, 0)
+		return
+	}
+
+	// 2. 投递
+	backoff := s.opts.backoff
+	for i := 0; ; i++ {
+		err = s.opts.publisher.Publish(s.ctx, string(payload))
+		if err == nil {
+			return
+		}
+		if i >= s.opts.retry {
+			break
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+
+	// 3. 兜底
+	s.writeFallback(entries, 0)
+}
+
+func (s *logSink) writeFallback(entries []string, n int) (int, error) {
+	var b strings.Builder
+	for _, e := range entries {
+		b.WriteString(e)
+		b.WriteByte('\n')
+	}
+	_, err := io.WriteString(s.fallback, b.String())
+	return n, err
+}
+
+func (s *logSink) syncFallback() error {
+	if f, ok := s.fallback.(interface{ Sync() error }); ok && s.fallback != os.Stderr {
+		return f.Sync()
+	}
+	return nil
+}
+
+// LogHandler 处理一批日志
+type LogHandler func(ctx context.Context, batch *LogBatch) error
+
+// NewLogSubscriber 汇聚LogSink投递的日志, 配合NewConsumer使用
+func NewLogSubscriber(h LogHandler) Subscriber {
+	return &logSubscriber{h: h}
+}
+
+// NewLogWriterHandler 逐条写入w, 如汇聚到logx.RotateWriter
+func NewLogWriterHandler(w io.Writer) LogHandler {
+	var mu sync.Mutex
+	return func(ctx context.Context, batch *LogBatch) error {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, e := range batch.Entries {
+			_, err := io.WriteString(w, e+"\n")
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+var _ Subscriber = (*logSubscriber)(nil)
+
+type logSubscriber struct {
+	h LogHandler
+}
+
+func (s *logSubscriber) Subscribe(ctx context.Context, payload string) error {
+	batch := &LogBatch{}
+	err := json.Unmarshal([]byte(payload), batch)
+	if err != nil {
+		return err
+	}
+	return s.h(ctx, batch)
+}
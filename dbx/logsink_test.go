@@ -0,0 +1,139 @@
+package dbx_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/advancevillage/3rd/dbx"
+	"github.com/advancevillage/3rd/logx"
+	"github.com/stretchr/testify/assert"
+)
+
+var _ dbx.Publisher = (*testLogPublisher)(nil)
+
+// testLogPublisher 前fails次投递失败, 成功后直接交给订阅者
+type testLogPublisher struct {
+	mu    sync.Mutex
+	fails int
+	calls int
+	sub   dbx.Subscriber
+}
+
+func (p *testLogPublisher) Publish(ctx context.Context, payload string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls++
+	if p.calls <= p.fails {
+		return errors.New("redis: connection refused")
+	}
+	return p.sub.Subscribe(ctx, payload)
+}
+
+func (p *testLogPublisher) Delay(ctx context.Context, payload string, delay time.Duration) error {
+	return p.Publish(ctx, payload)
+}
+
+func Test_logsink(t *testing.T) {
+	var data = map[string]struct {
+		fails    int
+		calls    int
+		shipped  int
+		fallback int
+	}{
+		"case-ship": {
+			calls:   1,
+			shipped: 5,
+		},
+		"case-retry": {
+			fails:   2,
+			calls:   3,
+			shipped: 5,
+		},
+		"case-fallback": {
+			fails:    100,
+			calls:    3,
+			fallback: 5,
+		},
+	}
+	for n, v := range data {
+		f := func(t *testing.T) {
+			var (
+				ctx  = context.TODO()
+				path = filepath.Join(t.TempDir(), "fallback.log")
+				recv = &bytes.Buffer{}
+				pub  = &testLogPublisher{fails: v.fails}
+				mu   sync.Mutex
+				host string
+			)
+			pub.sub = dbx.NewLogSubscriber(func(ctx context.Context, batch *dbx.LogBatch) error {
+				mu.Lock()
+				defer mu.Unlock()
+				assert.Equal(t, "svc", batch.Service)
+				host = batch.Host
+				return dbx.NewLogWriterHandler(recv)(ctx, batch)
+			})
+			sink, err := dbx.NewLogSink(ctx,
+				dbx.WithLogSinkPublisher(pub),
+				dbx.WithLogSinkService("svc"),
+				dbx.WithLogSinkBatch(10, time.Hour, 100),
+				dbx.WithLogSinkRetry(2, time.Millisecond),
+				dbx.WithLogSinkFallback(path),
+			)
+			assert.Nil(t, err)
+			l, err := logx.NewLogger("info", logx.WithoutStdout(), logx.WithSink(sink, ""))
+			assert.Nil(t, err)
+
+			for range 5 {
+				l.Infow(ctx, "ship me", "k", "v")
+			}
+			assert.Nil(t, l.Close())
+
+			fb, _ := os.ReadFile(path)
+			assert.Equal(t, v.calls, pub.calls)
+			assert.Equal(t, v.shipped, strings.Count(recv.String(), `"msg":"ship me"`))
+			assert.Equal(t, v.fallback, strings.Count(string(fb), `"msg":"ship me"`))
+			if v.shipped > 0 {
+				assert.NotEmpty(t, host)
+			}
+		}
+		t.Run(n, f)
+	}
+}
+
+func Test_logsink_owned_producer(t *testing.T) {
+	var (
+		ctx  = context.TODO()
+		path = filepath.Join(t.TempDir(), "fallback.log")
+	)
+	// 内部创建的生产者在Close时释放, redis不可达时日志落到本地
+	sink, err := dbx.NewLogSink(ctx,
+		dbx.WithLogSinkPubSub(dbx.WithPubSubDNS("redis://127.0.0.1:1/0"), dbx.WithPubSubChannel("logsink-test")),
+		dbx.WithLogSinkBatch(10, time.Hour, 100),
+		dbx.WithLogSinkRetry(0, time.Millisecond),
+		dbx.WithLogSinkFallback(path),
+	)
+	assert.Nil(t, err)
+	_, err = sink.Write([]byte(`{"msg":"ship me"}` + "\n"))
+	assert.Nil(t, err)
+
+	done := make(chan error)
+	go func() { done <- sink.Close() }()
+	select {
+	case err = <-done:
+		assert.Nil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("close timeout")
+	}
+	assert.Nil(t, sink.Close())
+
+	fb, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, strings.Count(string(fb), `"msg":"ship me"`))
+}
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/advancevillage/3rd/logx"
+	"github.com/advancevillage/3rd/tracex"
 	"github.com/redis/go-redis/v9"
 	"golang.org/x/sync/errgroup"
 )
@@ -56,12 +57,21 @@ func WithSubscriber(sub Subscriber) PubSubOption {
 	})
 }
 
+// WithPubSubTracer 发布和消费时创建span, 未设置时仍在消息中透传traceparent
+func WithPubSubTracer(t tracex.Tracer) PubSubOption {
+	return newFuncPubSubOption(func(o *pubsubOption) {
+		o.tracer = t
+	})
+}
+
 type pubsubOption struct {
 	cg         string     // 消费组 consumer group
 	ql         int64      // 生产者 最大消息长度
 	dns        string     // 组件地址
 	channel    string     // 订阅主题频道
 	subscriber Subscriber // 消费组中的订阅者
+
+	tracer tracex.Tracer // 链路追踪
 }
 
 var defaultPubSubOptions = pubsubOption{
@@ -92,6 +102,8 @@ type producerRedis struct {
 	opts   pubsubOption
 	rdb    *redis.Client
 	logger logx.ILogger
+	cancel context.CancelFunc // 停止延迟队列
+	exit   chan struct{}
 }
 
 const (
@@ -120,26 +132,42 @@ func newProducerRedis(ctx context.Context, logger logx.ILogger, opt ...PubSubOpt
 		opts:   opts,
 		rdb:    redis.NewClient(rdbOpts),
 		logger: logger,
+		exit:   make(chan struct{}),
 	}
 	// 4. 延迟队列
+	ctx, p.cancel = context.WithCancel(ctx)
 	go p.loop(ctx)
 
 	return p, nil
 }
 
 func (p *producerRedis) Publish(ctx context.Context, payload string) error {
-	// Redis Stream是惰性创建的，第一次执行XADD或XGROUP时才会真正创
-	err := p.rdb.XAdd(ctx, &redis.XAddArgs{
-		Stream: p.opts.channel,
-		MaxLen: p.opts.ql,
-		Values: map[string]interface{}{
+	// 1. 链路追踪
+	var (
+		span   tracex.Span
+		values = map[string]interface{}{
 			logx.TraceId:     ctx.Value(logx.TraceId),
 			X_TICKET_TIME:    time.Now().UnixNano() / 1e6,
 			X_TICKET_PAYLOAD: payload,
-		},
+		}
+	)
+	if p.opts.tracer != nil {
+		ctx, span = p.opts.tracer.Start(ctx, p.opts.channel+" publish", tracex.WithSpanKind(tracex.SpanKindProducer), tracex.WithSpanAttributes("messaging.system", "redis", "messaging.destination", p.opts.channel))
+		defer span.End()
+	}
+	tracex.Inject(ctx, valuesCarrier(values))
+
+	// 2. Redis Stream是惰性创建的，第一次执行XADD或XGROUP时才会真正创
+	err := p.rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: p.opts.channel,
+		MaxLen: p.opts.ql,
+		Values: values,
 	}).Err()
 	if err != nil {
 		p.logger.Errorw(ctx, "redis publish failed", "err", err)
+		if span != nil {
+			span.RecordError(err)
+		}
 	}
 	p.logger.Infow(ctx, "publish message success", "payload", payload)
 	return err
@@ -153,6 +181,7 @@ func (p *producerRedis) Delay(ctx context.Context, payload string, delay time.Du
 	qs.Add(logx.TraceId, fmt.Sprint(ctx.Value(logx.TraceId)))
 	qs.Add(X_TICKET_TIME, fmt.Sprint(time.Now().UnixNano()/1e6))
 	qs.Add(X_TICKET_PAYLOAD, payload)
+	tracex.Inject(ctx, urlValuesCarrier(qs))
 	// 2. 进入延迟队列
 	var (
 		q     = fmt.Sprintf("%s-pending", p.opts.channel)
@@ -170,7 +199,15 @@ func (p *producerRedis) Delay(ctx context.Context, payload string, delay time.Du
 	return nil
 }
 
+// Close 停止延迟队列并关闭连接池
+func (p *producerRedis) Close() error {
+	p.cancel()
+	<-p.exit
+	return p.rdb.Close()
+}
+
 func (p *producerRedis) loop(ctx context.Context) {
+	defer close(p.exit)
 	var t = time.NewTicker(time.Second)
 	defer t.Stop()
 
@@ -204,6 +241,7 @@ func (p *producerRedis) loop(ctx context.Context) {
 					sctx  = context.WithValue(context.Background(), logx.TraceId, trace)
 					etime = time.Now().UnixNano() / 1e6
 				)
+				sctx = tracex.Extract(sctx, urlValuesCarrier(qs))
 				p.logger.Infow(sctx, "consume delay message", "period", etime-stime, "payload", payload)
 				// 3. 发布消息
 				err = p.Publish(sctx, fmt.Sprint(payload))
@@ -349,6 +387,7 @@ func (c *consumerRedis) subscribe(ctx context.Context) {
 					)
 					// 1. 提取traceId
 					sctx := context.WithValue(context.Background(), logx.TraceId, values[logx.TraceId])
+					sctx = tracex.Extract(sctx, valuesCarrier(values))
 
 					// 2. 提取时间
 					stime, err := strconv.ParseInt(fmt.Sprint(values[X_TICKET_TIME]), 10, 64)
@@ -371,9 +410,16 @@ func (c *consumerRedis) subscribe(ctx context.Context) {
 						defer func() {
 							<-ch
 						}()
+						sctx := sctx
+						if c.opts.tracer != nil {
+							var span tracex.Span
+							sctx, span = c.opts.tracer.Start(sctx, c.opts.channel+" process", tracex.WithSpanKind(tracex.SpanKindConsumer), tracex.WithSpanAttributes("messaging.system", "redis", "messaging.destination", c.opts.channel, "messaging.message_id", msgId))
+							defer span.End()
+						}
 						c.logger.Infow(sctx, "subscribe receive payload", "msgId", msgId, "delay", etime-stime)
 						err := c.opts.subscriber.Subscribe(sctx, payload)
 						if err != nil {
+							tracex.SpanFromContext(sctx).RecordError(err)
 							c.logger.Errorw(sctx, "subscribe handle payload failed", "msgId", msgId, "err", err)
 							return nil
 						}
@@ -411,3 +457,21 @@ type emptyConsumer struct {
 func (e *emptyConsumer) Subscribe(ctx context.Context, payload string) error {
 	return nil
 }
+
+// valuesCarrier Redis Stream消息字段
+type valuesCarrier map[string]interface{}
+
+func (c valuesCarrier) Get(key string) string {
+	if v, ok := c[key]; ok && v != nil {
+		return fmt.Sprint(v)
+	}
+	return ""
+}
+
+func (c valuesCarrier) Set(key string, val string) { c[key] = val }
+
+// urlValuesCarrier 延迟队列消息
+type urlValuesCarrier url.Values
+
+func (c urlValuesCarrier) Get(key string) string      { return url.Values(c).Get(key) }
+func (c urlValuesCarrier) Set(key string, val string) { url.Values(c).Set(key, val) }
@@ -99,6 +99,11 @@ func newMariaSqlExecutor(ctx context.Context, logger logx.ILogger, opt ...SqlOpt
 	}, nil
 }
 
+// Close 关闭连接池
+func (c *maria) Close() error {
+	return c.conn.Close()
+}
+
 func (c *maria) ExecSql(ctx context.Context, query string, args ...any) (*SqlReply, error) {
 	var (
 		r   *SqlReply
@@ -41,7 +41,7 @@ func newBaseGPT(ctx context.Context, logger logx.ILogger, opt ...LLMOption) (*ba
 		option.WithBaseURL(opts.baseUrl),
 	)
 	c.client = &client
-	logger.Infow(ctx, "success to create chatgpt client", "sk", opts.sk, "model", opts.model)
+	logger.Infow(ctx, "success to create chatgpt client", "sk", logx.Secret(opts.sk), "model", opts.model)
 	return c, nil
 }
 
@@ -0,0 +1,192 @@
+package logx
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// OverflowPolicy 异步缓冲区满时的处理策略
+type OverflowPolicy int
+
+const (
+	OverflowBlock      OverflowPolicy = iota // 阻塞等待, 不丢日志
+	OverflowDropOldest                       // 丢弃最早的日志
+	OverflowDropNewest                       // 丢弃当前日志
+)
+
+type asyncOption struct {
+	size     int            // 缓冲条数, 0表示同步写
+	policy   OverflowPolicy // 溢出策略
+	interval time.Duration  // 定时刷盘间隔
+}
+
+// asyncWriter 有界环形缓冲, 后台协程批量写入
+type asyncWriter struct {
+	ws   zapcore.WriteSyncer
+	opts asyncOption
+
+	mu       sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+	idle     *sync.Cond
+	ring     [][]byte
+	head     int
+	count    int
+	writing  bool  // 后台正在写入
+	closed   bool  // 关闭后同步写
+	dropped  int64 // 累计丢弃
+	reported int64 // 已报告的丢弃
+	exit     chan struct{}
+}
+
+func newAsyncWriter(ws zapcore.WriteSyncer, opts asyncOption) *asyncWriter {
+	w := &asyncWriter{
+		ws:   ws,
+		opts: opts,
+		ring: make([][]byte, opts.size),
+		exit: make(chan struct{}),
+	}
+	w.notEmpty = sync.NewCond(&w.mu)
+	w.notFull = sync.NewCond(&w.mu)
+	w.idle = sync.NewCond(&w.mu)
+	go w.loop()
+	if opts.interval > 0 {
+		go w.tick()
+	}
+	return w
+}
+
+func (w *asyncWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	// 1. 关闭后直接写入
+	if w.closed {
+		w.mu.Unlock()
+		return w.ws.Write(p)
+	}
+
+	// 2. 缓冲区满
+	for w.count == len(w.ring) {
+		switch w.opts.policy {
+		case OverflowDropNewest:
+			w.dropped++
+			w.mu.Unlock()
+			return len(p), nil
+		case OverflowDropOldest:
+			w.ring[w.head] = nil
+			w.head = (w.head + 1) % len(w.ring)
+			w.count--
+			w.dropped++
+		default:
+			w.notFull.Wait()
+			if w.closed {
+				w.mu.Unlock()
+				return w.ws.Write(p)
+			}
+		}
+	}
+
+	// 3. 入队, zap会复用p因此需要拷贝
+	w.ring[(w.head+w.count)%len(w.ring)] = append([]byte(nil), p...)
+	w.count++
+	w.notEmpty.Signal()
+	w.mu.Unlock()
+	return len(p), nil
+}
+
+func (w *asyncWriter) loop() {
+	defer close(w.exit)
+	var batch []byte
+	for {
+		// 1. 等待日志
+		w.mu.Lock()
+		for w.count == 0 && !w.closed {
+			w.notEmpty.Wait()
+		}
+		if w.count == 0 && w.closed {
+			w.idle.Broadcast()
+			w.mu.Unlock()
+			return
+		}
+
+		// 2. 取出全部日志
+		batch = batch[:0]
+		for w.count > 0 {
+			batch = append(batch, w.ring[w.head]...)
+			w.ring[w.head] = nil
+			w.head = (w.head + 1) % len(w.ring)
+			w.count--
+		}
+		dropped := w.dropped - w.reported
+		w.reported = w.dropped
+		w.writing = true
+		w.notFull.Broadcast()
+		w.mu.Unlock()
+
+		// 3. 批量写入
+		if dropped > 0 {
+			fmt.Fprintf(os.Stderr, "%s logx: async buffer overflow, %d entries dropped\n", time.Now().Format(logTmFmtWithMS), dropped)
+		}
+		if _, err := w.ws.Write(batch); err != nil {
+			fmt.Fprintf(os.Stderr, "%s logx: async write failed: %v\n", time.Now().Format(logTmFmtWithMS), err)
+		}
+
+		w.mu.Lock()
+		w.writing = false
+		w.idle.Broadcast()
+		w.mu.Unlock()
+	}
+}
+
+// tick 定时刷盘
+func (w *asyncWriter) tick() {
+	t := time.NewTicker(w.opts.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-w.exit:
+			return
+		case <-t.C:
+			w.Sync()
+		}
+	}
+}
+
+// drain 等待缓冲区写完
+func (w *asyncWriter) drain() {
+	w.mu.Lock()
+	for w.count > 0 || w.writing {
+		w.idle.Wait()
+	}
+	w.mu.Unlock()
+}
+
+func (w *asyncWriter) Sync() error {
+	w.drain()
+	return w.ws.Sync()
+}
+
+// Close 写完缓冲并停止后台协程, 之后的写入直接落到下层
+func (w *asyncWriter) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	w.notEmpty.Broadcast()
+	w.notFull.Broadcast()
+	w.mu.Unlock()
+	<-w.exit
+	return w.ws.Sync()
+}
+
+// Dropped 累计丢弃条数
+func (w *asyncWriter) Dropped() int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.dropped
+}
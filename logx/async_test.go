@@ -0,0 +1,128 @@
+package logx
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// gateWriter 第一次写入阻塞直到放行, 用于制造缓冲区满
+type gateWriter struct {
+	mu      sync.Mutex
+	buf     bytes.Buffer
+	once    sync.Once
+	entered chan struct{}
+	release chan struct{}
+}
+
+func newGateWriter() *gateWriter {
+	return &gateWriter{entered: make(chan struct{}), release: make(chan struct{})}
+}
+
+func (w *gateWriter) Write(p []byte) (int, error) {
+	w.once.Do(func() {
+		close(w.entered)
+		<-w.release
+	})
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.Write(p)
+}
+
+func (w *gateWriter) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.String()
+}
+
+func Test_async(t *testing.T) {
+	var data = map[string]struct {
+		policy OverflowPolicy
+		exp    []int
+	}{
+		"case-block": {
+			policy: OverflowBlock,
+			exp:    []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9},
+		},
+		"case-drop-oldest": {
+			policy: OverflowDropOldest,
+			exp:    []int{0, 8, 9},
+		},
+		"case-drop-newest": {
+			policy: OverflowDropNewest,
+			exp:    []int{0, 1, 2},
+		},
+	}
+	for n, v := range data {
+		f := func(t *testing.T) {
+			var (
+				ctx  = context.TODO()
+				w    = newGateWriter()
+				done = make(chan struct{})
+			)
+			l, err := NewLogger("info", WithoutStdout(), WithOutput(w, ""), WithAsync(2, v.policy))
+			assert.Nil(t, err)
+
+			// 1. 第一条日志阻塞在写入, 之后的日志进入缓冲
+			l.Infow(ctx, "async", "i", 0)
+			<-w.entered
+			go func() {
+				defer close(done)
+				for i := 1; i < 10; i++ {
+					l.Infow(ctx, "async", "i", i)
+				}
+			}()
+			if v.policy == OverflowBlock {
+				// 缓冲区满时写入方阻塞
+				select {
+				case <-done:
+					t.Fatal("write not blocked")
+				case <-time.After(50 * time.Millisecond):
+				}
+			} else {
+				<-done
+			}
+
+			// 2. 放行后关闭, 缓冲中的日志全部写出
+			close(w.release)
+			<-done
+			assert.Nil(t, l.Close())
+			assert.Nil(t, l.Close())
+
+			act := []int{}
+			for i := range 10 {
+				if bytes.Contains([]byte(w.String()), fmt.Appendf(nil, `"i":%d}`, i)) {
+					act = append(act, i)
+				}
+			}
+			assert.Equal(t, v.exp, act)
+		}
+		t.Run(n, f)
+	}
+}
+
+func Test_async_sync(t *testing.T) {
+	var (
+		ctx = context.TODO()
+		w   = newGateWriter()
+	)
+	close(w.release)
+	l, err := NewLogger("debug", WithoutStdout(), WithOutput(w, ""), WithAsync(16, OverflowBlock), WithAsyncFlushInterval(0))
+	assert.Nil(t, err)
+	child := l.Named("child").With("k", "v")
+	for i := range 100 {
+		child.Debugw(ctx, "sync", "i", i)
+	}
+	assert.Nil(t, child.Sync())
+	assert.Equal(t, 100, bytes.Count([]byte(w.String()), []byte(`"msg":"sync"`)))
+
+	// 关闭后仍可写入, 直接落到下层输出
+	assert.Nil(t, child.Close())
+	l.Infow(ctx, "after close")
+	assert.Contains(t, w.String(), "after close")
+}
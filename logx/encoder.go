@@ -0,0 +1,235 @@
+package logx
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	FormatJSON    = "json"    // 默认
+	FormatConsole = "console" // 终端, 彩色对齐
+	FormatLogfmt  = "logfmt"  // key=value
+)
+
+const (
+	consoleMsgWidth  = 40 // 消息对齐宽度
+	consoleNameWidth = 12 // 日志名称对齐宽度
+)
+
+var (
+	textPool    = buffer.NewPool()
+	levelColors = map[string]string{
+		"debug": "\x1b[35m", // 紫色
+		"info":  "\x1b[34m", // 蓝色
+		"warn":  "\x1b[33m", // 黄色
+		"error": "\x1b[31m", // 红色
+	}
+	colorReset = "\x1b[0m"
+	colorKey   = "\x1b[36m" // 青色
+)
+
+// textEncoder 以JSON编码后按顺序重排为console或logfmt格式, 复用JSON编码器的With字段和类型处理
+type textEncoder struct {
+	zapcore.Encoder
+	format string
+	color  bool
+}
+
+func newEncoder(format string, color bool) zapcore.Encoder {
+	enc := zapcore.NewJSONEncoder(zapcore.EncoderConfig{
+		CallerKey:     "caller", // 打印文件名和行数
+		LevelKey:      "level",
+		MessageKey:    "msg",
+		TimeKey:       "ts",
+		StacktraceKey: "stacktrace",
+		LineEnding:    zapcore.DefaultLineEnding,
+		EncodeTime: func(t time.Time, enc zapcore.PrimitiveArrayEncoder) {
+			enc.AppendString(t.Format(logTmFmtWithMS))
+		},
+		EncodeLevel:    zapcore.LowercaseLevelEncoder, // 小写编码器
+		EncodeCaller:   zapcore.ShortCallerEncoder,    // 全路径编码器
+		EncodeDuration: zapcore.SecondsDurationEncoder,
+		EncodeName:     zapcore.FullNameEncoder,
+		NameKey:        "logger",
+	})
+	switch strings.ToLower(format) {
+	case FormatConsole:
+		return &textEncoder{Encoder: enc, format: FormatConsole, color: color}
+	case FormatLogfmt:
+		return &textEncoder{Encoder: enc, format: FormatLogfmt}
+	default:
+		return enc
+	}
+}
+
+// isTerminal 标准输出是否为终端, 重定向到文件时不输出颜色
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+func (e *textEncoder) Clone() zapcore.Encoder {
+	return &textEncoder{Encoder: e.Encoder.Clone(), format: e.format, color: e.color}
+}
+
+type textField struct {
+	key string
+	raw json.RawMessage
+}
+
+func (e *textEncoder) EncodeEntry(ent zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	// 1. JSON编码
+	buf, err := e.Encoder.EncodeEntry(ent, fields)
+	if err != nil {
+		return nil, err
+	}
+	defer buf.Free()
+
+	// 2. 按原顺序解析字段
+	var (
+		dec  = json.NewDecoder(bytes.NewReader(buf.Bytes()))
+		kvs  = []textField{}
+		base = map[string]string{}
+	)
+	if _, err = dec.Token(); err != nil {
+		return nil, err
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		f := textField{key: fmt.Sprint(tok)}
+		if err = dec.Decode(&f.raw); err != nil {
+			return nil, err
+		}
+		// 与内置键同名的字段保留为普通字段
+		_, dup := base[f.key]
+		switch {
+		case dup:
+			kvs = append(kvs, f)
+		case f.key == "ts", f.key == "level", f.key == "logger", f.key == "caller", f.key == "msg", f.key == "stacktrace":
+			base[f.key] = textValue(f.raw)
+		default:
+			kvs = append(kvs, f)
+		}
+	}
+
+	// 3. 重排输出
+	out := textPool.Get()
+	if e.format == FormatConsole {
+		e.encodeConsole(out, base, kvs)
+	} else {
+		e.encodeLogfmt(out, base, kvs)
+	}
+	out.AppendString(zapcore.DefaultLineEnding)
+	return out, nil
+}
+
+// encodeConsole 2006-01-02 15:04:05.000 INFO  [name]       caller  msg  key=value
+func (e *textEncoder) encodeConsole(out *buffer.Buffer, base map[string]string, kvs []textField) {
+	out.AppendString(base["ts"])
+	out.AppendByte(' ')
+	lvl := fmt.Sprintf("%-5s", strings.ToUpper(base["level"]))
+	if c, ok := levelColors[base["level"]]; ok && e.color {
+		lvl = c + lvl + colorReset
+	}
+	out.AppendString(lvl)
+	out.AppendByte(' ')
+	if name := base["logger"]; len(name) > 0 {
+		out.AppendString(pad("["+name+"]", consoleNameWidth))
+		out.AppendByte(' ')
+	}
+	out.AppendString(base["caller"])
+	out.AppendByte('\t')
+	if len(kvs) > 0 {
+		out.AppendString(pad(base["msg"], consoleMsgWidth))
+	} else {
+		out.AppendString(base["msg"])
+	}
+	for _, f := range kvs {
+		out.AppendByte(' ')
+		if e.color {
+			out.AppendString(colorKey + f.key + colorReset)
+		} else {
+			out.AppendString(f.key)
+		}
+		out.AppendByte('=')
+		if f.raw[0] == '{' || f.raw[0] == '[' {
+			out.AppendString(string(f.raw))
+		} else {
+			out.AppendString(quoteValue(f.raw))
+		}
+	}
+	if st := base["stacktrace"]; len(st) > 0 {
+		out.AppendString(zapcore.DefaultLineEnding)
+		out.AppendString(st)
+	}
+}
+
+// encodeLogfmt ts="..." level=info logger=name caller=file:line msg="..." key=value
+func (e *textEncoder) encodeLogfmt(out *buffer.Buffer, base map[string]string, kvs []textField) {
+	first := true
+	write := func(k string, v string) {
+		if !first {
+			out.AppendByte(' ')
+		}
+		first = false
+		out.AppendString(k)
+		out.AppendByte('=')
+		out.AppendString(v)
+	}
+	for _, k := range []string{"ts", "level", "logger", "caller", "msg"} {
+		if v, ok := base[k]; ok {
+			write(k, quote(v))
+		}
+	}
+	for _, f := range kvs {
+		write(f.key, quoteValue(f.raw))
+	}
+	if st, ok := base["stacktrace"]; ok {
+		write("stacktrace", quote(st))
+	}
+}
+
+// textValue 字符串取原值, 其他类型保留JSON
+func textValue(raw json.RawMessage) string {
+	var s string
+	if len(raw) > 0 && raw[0] == '"' && json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	return string(raw)
+}
+
+func quoteValue(raw json.RawMessage) string {
+	return quote(textValue(raw))
+}
+
+// quote 含空白、等号、引号或控制字符时加引号
+func quote(s string) string {
+	if len(s) <= 0 {
+		return `""`
+	}
+	if strings.ContainsFunc(s, func(r rune) bool {
+		return r <= ' ' || r == '=' || r == '"' || r == utf8.RuneError
+	}) {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+func pad(s string, width int) string {
+	if n := utf8.RuneCountInString(s); n < width {
+		return s + strings.Repeat(" ", width-n)
+	}
+	return s
+}
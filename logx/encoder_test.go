@@ -0,0 +1,52 @@
+package logx
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/advancevillage/3rd/x"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_encoder(t *testing.T) {
+	var data = map[string]struct {
+		format string
+		exp    *regexp.Regexp
+	}{
+		"case-json": {
+			format: "",
+			exp:    regexp.MustCompile(`^\{"level":"info","ts":"[^"]+","logger":"dbx","caller":"logx/encoder_test.go:\d+","msg":"hello world","x-3rd-trace":"t1","n":1,"s":"a b","obj":\{"k":"v"\}\}\n$`),
+		},
+		"case-console": {
+			format: FormatConsole,
+			exp:    regexp.MustCompile(`^\S+ \S+ INFO  \[dbx\]        logx/encoder_test.go:\d+\thello world {29} x-3rd-trace=t1 n=1 s="a b" obj=\{"k":"v"\}\n$`),
+		},
+		"case-logfmt": {
+			format: FormatLogfmt,
+			exp:    regexp.MustCompile(`^ts="\S+ \S+" level=info logger=dbx caller=logx/encoder_test.go:\d+ msg="hello world" x-3rd-trace=t1 n=1 s="a b" obj="\{\\"k\\":\\"v\\"\}"\n$`),
+		},
+	}
+	for n, v := range data {
+		f := func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			l, err := NewLoggerWithCfg(&x.LogCfg{Level: "info", Format: v.format}, WithoutStdout(), WithOutput(buf, ""))
+			assert.Nil(t, err)
+			ctx := TraceKey.WithValue(context.TODO(), "t1")
+			l.Named("dbx").Infow(ctx, "hello world", "n", 1, "s", "a b", "obj", map[string]string{"k": "v"})
+			assert.Regexp(t, v.exp, buf.String())
+		}
+		t.Run(n, f)
+	}
+}
+
+func Test_encoder_stacktrace(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l, err := NewLogger("info", WithFormat(FormatLogfmt), WithoutStdout(), WithOutput(buf, ""))
+	assert.Nil(t, err)
+	l.Errorw(context.TODO(), "failed", "err", errors.New("boom"), "msg", "dup")
+	assert.Regexp(t, `msg=failed err=boom msg=dup stacktrace="`, buf.String())
+	assert.Equal(t, 1, bytes.Count(buf.Bytes(), []byte("\n")))
+}
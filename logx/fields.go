@@ -0,0 +1,134 @@
+package logx
+
+import (
+	"context"
+	"fmt"
+
+	"go.uber.org/zap"
+)
+
+// Key 类型化的上下文键, 以指针区分, 不同包同名也不会冲突
+// 通过Key写入上下文的值会作为字段自动输出到日志
+type Key[T any] struct {
+	*keyName
+}
+
+type keyName struct {
+	name   string
+	legacy bool // 兼容以字符串为键的旧写法
+}
+
+// NewKey 创建上下文键, name为日志字段名
+func NewKey[T any](name string) Key[T] {
+	return Key[T]{&keyName{name: name}}
+}
+
+func newLegacyKey(name string) Key[string] {
+	return Key[string]{&keyName{name: name, legacy: true}}
+}
+
+var (
+	TraceKey   = newLegacyKey(TraceId)
+	UriKey     = newLegacyKey(UriId)
+	MethodKey  = newLegacyKey(MethodId)
+	SpanKey    = NewKey[string]("x-3rd-span")
+	RequestKey = NewKey[string]("x-3rd-request")
+	TenantKey  = NewKey[string]("tenant")
+	UserKey    = NewKey[string]("user")
+)
+
+func (k Key[T]) Name() string {
+	return k.name
+}
+
+// WithValue 写入上下文并追加日志字段
+func (k Key[T]) WithValue(ctx context.Context, v T) context.Context {
+	ctx = context.WithValue(ctx, k.keyName, v)
+	if k.legacy {
+		ctx = context.WithValue(ctx, k.name, v)
+	}
+	return withField(ctx, k.name, v)
+}
+
+func (k Key[T]) Value(ctx context.Context) (T, bool) {
+	v, ok := ctx.Value(k.keyName).(T)
+	if !ok && k.legacy {
+		v, ok = ctx.Value(k.name).(T)
+	}
+	return v, ok
+}
+
+type ctxKeyFields struct{}
+
+// fieldList 链表追加, 派生上下文不复制父节点字段
+type fieldList struct {
+	parent *fieldList
+	key    string
+	val    interface{}
+}
+
+// WithFields 向上下文追加日志字段, 同名字段后写覆盖先写
+func WithFields(ctx context.Context, keysAndValues ...interface{}) context.Context {
+	for i := 0; i+1 < len(keysAndValues); i += 2 {
+		key, ok := keysAndValues[i].(string)
+		if !ok {
+			key = fmt.Sprint(keysAndValues[i])
+		}
+		ctx = withField(ctx, key, keysAndValues[i+1])
+	}
+	return ctx
+}
+
+func withField(ctx context.Context, key string, val interface{}) context.Context {
+	parent, _ := ctx.Value(ctxKeyFields{}).(*fieldList)
+	return context.WithValue(ctx, ctxKeyFields{}, &fieldList{parent: parent, key: key, val: val})
+}
+
+// FieldsFromContext 上下文中的日志字段, 按写入顺序展开为键值对
+func FieldsFromContext(ctx context.Context) []interface{} {
+	fields := collectFields(ctx)
+	kv := make([]interface{}, 0, len(fields)*2)
+	for _, f := range fields {
+		kv = append(kv, f.key, f.val)
+	}
+	return kv
+}
+
+func contextFields(ctx context.Context) []zap.Field {
+	fields := collectFields(ctx)
+	zf := make([]zap.Field, 0, len(fields))
+	for _, f := range fields {
+		zf = append(zf, zap.Any(f.key, f.val))
+	}
+	return zf
+}
+
+func collectFields(ctx context.Context) []fieldList {
+	// 1. 类型化字段, 从尾部回溯, 同名保留最后写入
+	var (
+		seen  = map[string]struct{}{}
+		stack = []*fieldList{}
+	)
+	for f, _ := ctx.Value(ctxKeyFields{}).(*fieldList); f != nil; f = f.parent {
+		if _, ok := seen[f.key]; ok {
+			continue
+		}
+		seen[f.key] = struct{}{}
+		stack = append(stack, f)
+	}
+	fields := make([]fieldList, 0, len(stack)+3)
+	for i := len(stack) - 1; i >= 0; i-- {
+		fields = append(fields, fieldList{key: stack[i].key, val: stack[i].val})
+	}
+
+	// 2. 兼容以字符串为键写入的trace/uri/method
+	for _, k := range []string{TraceId, UriId, MethodId} {
+		if _, ok := seen[k]; ok {
+			continue
+		}
+		if val, ok := ctx.Value(k).(string); ok && len(val) > 0 {
+			fields = append(fields, fieldList{key: k, val: val})
+		}
+	}
+	return fields
+}
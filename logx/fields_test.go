@@ -0,0 +1,67 @@
+package logx
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_fields(t *testing.T) {
+	var tenantKey = NewKey[int]("tenant")
+
+	var data = map[string]struct {
+		ctx    func() context.Context
+		fields []interface{}
+	}{
+		"case-legacy": {
+			ctx: func() context.Context {
+				return context.WithValue(context.TODO(), TraceId, "t1")
+			},
+			fields: []interface{}{TraceId, "t1"},
+		},
+		"case-typed": {
+			ctx: func() context.Context {
+				ctx := TraceKey.WithValue(context.TODO(), "t1")
+				ctx = UserKey.WithValue(ctx, "u1")
+				return tenantKey.WithValue(ctx, 100)
+			},
+			fields: []interface{}{TraceId, "t1", "user", "u1", "tenant", 100},
+		},
+		"case-override": {
+			ctx: func() context.Context {
+				ctx := WithFields(context.TODO(), "a", 1, "b", 2)
+				return WithFields(ctx, "a", 3, "dangling")
+			},
+			fields: []interface{}{"b", 2, "a", 3},
+		},
+	}
+	for n, v := range data {
+		f := func(t *testing.T) {
+			assert.Equal(t, v.fields, FieldsFromContext(v.ctx()))
+		}
+		t.Run(n, f)
+	}
+
+	// 1. 同名不同类型的键互不影响, 旧写法可通过类型化键读取
+	ctx := tenantKey.WithValue(context.TODO(), 100)
+	_, ok := TenantKey.Value(ctx)
+	assert.False(t, ok)
+	tenant, ok := tenantKey.Value(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, 100, tenant)
+
+	trace, ok := TraceKey.Value(context.WithValue(context.TODO(), TraceId, "t2"))
+	assert.True(t, ok)
+	assert.Equal(t, "t2", trace)
+	assert.Equal(t, "t3", TraceKey.WithValue(context.TODO(), "t3").Value(TraceId))
+
+	// 2. 日志自动输出上下文字段
+	buf := &bytes.Buffer{}
+	l, err := NewLogger("info", WithoutStdout(), WithOutput(buf, ""))
+	assert.Nil(t, err)
+	l.Infow(RequestKey.WithValue(ctx, "r1"), "hello")
+	assert.Contains(t, buf.String(), `"tenant":100`)
+	assert.Contains(t, buf.String(), `"x-3rd-request":"r1"`)
+}
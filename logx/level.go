@@ -0,0 +1,139 @@
+package logx
+
+import (
+	"context"
+	"maps"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/advancevillage/3rd/x"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// LevelController 运行时调整日志级别, name为空表示全局级别
+// 命名日志按 a.b.c -> a.b -> a -> 全局 的顺序查找级别
+type LevelController interface {
+	Level(name string) string
+	SetLevel(name string, level string) error
+	// UnsetLevel 删除命名日志的级别, 恢复继承
+	UnsetLevel(name string)
+	// Levels 全局及全部命名日志的级别, 全局级别的键为空字符串
+	Levels() map[string]string
+}
+
+// Levels 获取日志的级别控制器, 同一根日志派生的子日志共享
+func Levels(l ILogger) (LevelController, bool) {
+	lg, ok := l.(*logger)
+	if !ok {
+		return nil, false
+	}
+	return lg.levels, true
+}
+
+// NewLevelSubscriber 配置热加载时按log.level调整全局级别, 未配置时为info
+//
+//	w.Subscribe(logx.NewLevelSubscriber(logger))
+func NewLevelSubscriber(l ILogger) x.CfgSubscriber[x.Cfg] {
+	return func(old, new *x.Cfg) {
+		// 1. 级别未变化
+		var (
+			from = cfgLevel(old)
+			to   = cfgLevel(new)
+		)
+		if from == to {
+			return
+		}
+		lc, ok := Levels(l)
+		if !ok {
+			return
+		}
+		// 2. 调整全局级别
+		err := lc.SetLevel("", to)
+		if err != nil {
+			l.Errorw(context.TODO(), "log level change failed", "err", err, "from", from, "to", to)
+			return
+		}
+		l.Infow(context.TODO(), "log level changed", "from", from, "to", to)
+	}
+}
+
+func cfgLevel(c *x.Cfg) string {
+	if c == nil || c.Log == nil || len(c.Log.Level) <= 0 {
+		return "info"
+	}
+	return c.Log.Level
+}
+
+var _ LevelController = (*levelRegistry)(nil)
+
+type levelRegistry struct {
+	global zap.AtomicLevel
+	mu     sync.Mutex                               // 串行写
+	named  atomic.Pointer[map[string]zapcore.Level] // 写时复制, 读无锁
+}
+
+func newLevelRegistry(level zapcore.Level) *levelRegistry {
+	r := &levelRegistry{global: zap.NewAtomicLevelAt(level)}
+	r.named.Store(&map[string]zapcore.Level{})
+	return r
+}
+
+func (r *levelRegistry) enabled(name string, lvl zapcore.Level) bool {
+	return lvl >= r.level(name)
+}
+
+func (r *levelRegistry) level(name string) zapcore.Level {
+	named := *r.named.Load()
+	for len(name) > 0 && len(named) > 0 {
+		if lvl, ok := named[name]; ok {
+			return lvl
+		}
+		i := strings.LastIndex(name, ".")
+		if i < 0 {
+			break
+		}
+		name = name[:i]
+	}
+	return r.global.Level()
+}
+
+func (r *levelRegistry) Level(name string) string {
+	return r.level(name).String()
+}
+
+func (r *levelRegistry) SetLevel(name string, level string) error {
+	lvl, err := zapcore.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	if len(name) <= 0 {
+		r.global.SetLevel(lvl)
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	named := maps.Clone(*r.named.Load())
+	named[name] = lvl
+	r.named.Store(&named)
+	return nil
+}
+
+func (r *levelRegistry) UnsetLevel(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	named := maps.Clone(*r.named.Load())
+	delete(named, name)
+	r.named.Store(&named)
+}
+
+func (r *levelRegistry) Levels() map[string]string {
+	named := *r.named.Load()
+	levels := make(map[string]string, len(named)+1)
+	levels[""] = r.global.Level().String()
+	for k, v := range named {
+		levels[k] = v.String()
+	}
+	return levels
+}
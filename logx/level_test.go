@@ -0,0 +1,100 @@
+package logx
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/advancevillage/3rd/x"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_level(t *testing.T) {
+	var (
+		ctx = context.TODO()
+		buf = &bytes.Buffer{}
+	)
+	root, err := NewLogger("info", WithoutStdout(), WithOutput(buf, ""))
+	assert.Nil(t, err)
+	levels, ok := Levels(root)
+	assert.True(t, ok)
+
+	var (
+		dbx   = root.Named("dbx")
+		redis = dbx.Named("redis").With("addr", "127.0.0.1:6379")
+	)
+	count := func(msg string) int {
+		return strings.Count(buf.String(), `"msg":"`+msg+`"`)
+	}
+
+	// 1. 默认继承全局级别
+	root.Debugw(ctx, "root-debug")
+	redis.Debugw(ctx, "redis-debug")
+	redis.Infow(ctx, "redis-info")
+	assert.Equal(t, 0, count("root-debug"))
+	assert.Equal(t, 0, count("redis-debug"))
+	assert.Equal(t, 1, count("redis-info"))
+	assert.Contains(t, buf.String(), `"logger":"dbx.redis"`)
+	assert.Contains(t, buf.String(), `"addr":"127.0.0.1:6379"`)
+
+	// 2. 命名级别作用于子日志
+	assert.Nil(t, levels.SetLevel("dbx", "debug"))
+	redis.Debugw(ctx, "redis-debug")
+	root.Debugw(ctx, "root-debug")
+	assert.Equal(t, 1, count("redis-debug"))
+	assert.Equal(t, 0, count("root-debug"))
+	assert.Equal(t, "debug", levels.Level("dbx.redis"))
+
+	// 3. 更具体的名称优先
+	assert.Nil(t, levels.SetLevel("dbx.redis", "error"))
+	redis.Warnw(ctx, "redis-warn")
+	dbx.Warnw(ctx, "dbx-warn")
+	assert.Equal(t, 0, count("redis-warn"))
+	assert.Equal(t, 1, count("dbx-warn"))
+
+	// 4. 恢复继承并调整全局级别
+	levels.UnsetLevel("dbx.redis")
+	levels.UnsetLevel("dbx")
+	assert.Nil(t, levels.SetLevel("", "error"))
+	dbx.Warnw(ctx, "dbx-warn")
+	assert.Equal(t, 1, count("dbx-warn"))
+	assert.Equal(t, map[string]string{"": "error"}, levels.Levels())
+
+	// 5. 非法级别
+	assert.NotNil(t, levels.SetLevel("", "verbose"))
+}
+
+func Test_level_subscriber(t *testing.T) {
+	var data = map[string]struct {
+		old   *x.Cfg
+		new   *x.Cfg
+		level string
+	}{
+		"case-change": {
+			old:   &x.Cfg{Log: &x.LogCfg{Level: "info"}},
+			new:   &x.Cfg{Log: &x.LogCfg{Level: "debug"}},
+			level: "debug",
+		},
+		"case-removed": {
+			old:   &x.Cfg{Log: &x.LogCfg{Level: "error"}},
+			new:   &x.Cfg{},
+			level: "info",
+		},
+		"case-unchanged": {
+			old:   &x.Cfg{Log: &x.LogCfg{Level: "warn"}},
+			new:   &x.Cfg{Log: &x.LogCfg{Level: "warn"}},
+			level: "error",
+		},
+	}
+	for n, v := range data {
+		f := func(t *testing.T) {
+			l, err := NewLogger("error", WithoutStdout())
+			assert.Nil(t, err)
+			NewLevelSubscriber(l)(v.old, v.new)
+			lc, _ := Levels(l)
+			assert.Equal(t, v.level, lc.Level(""))
+		}
+		t.Run(n, f)
+	}
+}
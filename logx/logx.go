@@ -2,10 +2,11 @@ package logx
 
 import (
 	"context"
+	"io"
 	"os"
 	"strings"
-	"time"
 
+	"github.com/advancevillage/3rd/x"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
@@ -22,87 +23,197 @@ type ILogger interface {
 	Infow(ctx context.Context, msg string, keysAndValues ...interface{})
 	Warnw(ctx context.Context, msg string, keysAndValues ...interface{})
 	Errorw(ctx context.Context, msg string, keysAndValues ...interface{})
+	// With 返回携带固定字段的子日志
+	With(keysAndValues ...interface{}) ILogger
+	// Named 返回命名子日志, 多级名称以.连接, 可单独设置级别
+	Named(name string) ILogger
+	// Sync 刷新缓冲, 异步模式下等待缓冲写完
+	Sync() error
+	// Close 刷新并关闭输出, 由日志创建者调用; 子日志共享输出, 重复调用无副作用
+	Close() error
 }
 
 type logger struct {
-	z *zap.Logger
+	z       *zap.Logger
+	name    string         // 日志名称
+	levels  *levelRegistry // 运行时级别, 子日志共享
+	sampler *sampler       // 采样, 子日志共享
+	closers []io.Closer    // 异步缓冲和文件输出, 按顺序关闭
 }
 
-func NewLogger(level string) (ILogger, error) {
-	var l zapcore.Level
+// NewLogger 默认输出到标准输出, 可通过Option增加文件等输出
+func NewLogger(level string, opt ...Option) (ILogger, error) {
+	// 0. 设置配置
+	opts := newDefaultOption()
+	for _, o := range opt {
+		o.Apply(&opts)
+	}
+
+	var (
+		l       = parseLevel(level)
+		enc     = newEncoder(opts.format, false)
+		r       = newRedactor(opts.redact)
+		cores   = []zapcore.Core{}
+		asyncs  = []io.Closer{}
+		closers = []io.Closer{}
+	)
+
+	// 异步模式下每个输出各自缓冲
+	wrap := func(ws zapcore.WriteSyncer) zapcore.WriteSyncer {
+		if opts.async.size <= 0 {
+			return ws
+		}
+		w := newAsyncWriter(ws, opts.async)
+		asyncs = append(asyncs, w)
+		return w
+	}
+
+	// 1. 标准输出, 忽略终端不支持Sync的错误; 级别在写入前由levels判断
+	if opts.stdout {
+		enc := newEncoder(opts.format, isTerminal(os.Stdout))
+		cores = append(cores, newRedactCore(zapcore.NewCore(enc, wrap(zapcore.AddSync(struct{ io.Writer }{os.Stdout})), zapcore.DebugLevel), r))
+	}
+
+	// 2. 其他输出
+	for _, s := range opts.sinks {
+		var (
+			ws  zapcore.WriteSyncer
+			lvl = zapcore.DebugLevel
+		)
+		if len(s.level) > 0 {
+			lvl = parseLevel(s.level)
+		}
+		if len(s.path) > 0 {
+			w, err := NewRotateWriter(s.path, s.opts...)
+			if err != nil {
+				for _, c := range append(asyncs, closers...) {
+					c.Close()
+				}
+				return nil, err
+			}
+			ws = w
+			closers = append(closers, w)
+		} else {
+			ws = zapcore.Lock(zapcore.AddSync(s.w))
+			if s.c != nil {
+				closers = append(closers, s.c)
+			}
+		}
+		cores = append(cores, newRedactCore(zapcore.NewCore(enc.Clone(), wrap(ws), lvl), r))
+	}
+
+	var z = zap.New(zapcore.NewTee(cores...),
+		zap.AddCaller(),
+		zap.AddCallerSkip(1),              // 跳过logger方法本身
+		zap.AddStacktrace(zap.ErrorLevel), // error级别日志，打印堆栈
+		zap.Development(),
+	)
+	return &logger{z: z, levels: newLevelRegistry(l), sampler: newSampler(z, opts.sample), closers: append(asyncs, closers...)}, nil
+}
+
+// NewLoggerWithCfg 按配置文件创建日志, 级别和格式取自cfg
+func NewLoggerWithCfg(cfg *x.LogCfg, opt ...Option) (ILogger, error) {
+	if cfg == nil {
+		return NewLogger("info", opt...)
+	}
+	return NewLogger(cfg.Level, append([]Option{WithFormat(cfg.Format)}, opt...)...)
+}
+
+// Sync 刷新日志缓冲, 服务退出前调用
+func Sync(l ILogger) error {
+	return l.Sync()
+}
+
+// Close 刷新并关闭文件输出
+func Close(l ILogger) error {
+	return l.Close()
+}
+
+func (l *logger) Sync() error {
+	return l.z.Sync()
+}
+
+// Close 先停止采样汇总, 再写完异步缓冲, 最后关闭文件
+func (l *logger) Close() error {
+	l.sampler.close()
+	err := l.z.Sync()
+	for _, c := range l.closers {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+func parseLevel(level string) zapcore.Level {
 	switch strings.ToLower(level) {
 	case "debug":
-		l = zapcore.DebugLevel
+		return zapcore.DebugLevel
 	case "info":
-		l = zapcore.InfoLevel
+		return zapcore.InfoLevel
 	case "warn":
-		l = zapcore.WarnLevel
+		return zapcore.WarnLevel
 	case "error":
-		l = zapcore.ErrorLevel
+		return zapcore.ErrorLevel
 	default:
-		l = zapcore.InfoLevel
+		return zapcore.InfoLevel
 	}
-	var core = zapcore.NewCore(
-		zapcore.NewJSONEncoder(zapcore.EncoderConfig{
-			CallerKey:     "caller", // 打印文件名和行数
-			LevelKey:      "level",
-			MessageKey:    "msg",
-			TimeKey:       "ts",
-			StacktraceKey: "stacktrace",
-			LineEnding:    zapcore.DefaultLineEnding,
-			EncodeTime: func(t time.Time, enc zapcore.PrimitiveArrayEncoder) {
-				enc.AppendString(t.Format(logTmFmtWithMS))
-			},
-			EncodeLevel:    zapcore.LowercaseLevelEncoder, // 小写编码器
-			EncodeCaller:   zapcore.ShortCallerEncoder,    // 全路径编码器
-			EncodeDuration: zapcore.SecondsDurationEncoder,
-			EncodeName:     zapcore.FullNameEncoder,
-		}),
-		zapcore.NewMultiWriteSyncer(zapcore.AddSync(os.Stdout)),
-		l,
-	)
-	var z = zap.New(core,
-		zap.AddCaller(),
-		zap.AddStacktrace(zap.ErrorLevel), // error级别日志，打印堆栈
-		zap.Development(),
-	)
-	return &logger{z: z}, nil
+}
+
+func (l *logger) With(keysAndValues ...interface{}) ILogger {
+	c := *l
+	c.z = l.z.Sugar().With(keysAndValues...).Desugar()
+	return &c
+}
+
+func (l *logger) Named(name string) ILogger {
+	c := *l
+	c.z = l.z.Named(name)
+	if len(l.name) > 0 {
+		c.name = l.name + "." + name
+	} else {
+		c.name = name
+	}
+	return &c
 }
 
 func (l *logger) Infow(ctx context.Context, msg string, keysAndValues ...interface{}) {
-	l.withTraceId(ctx).Sugar().Infow(msg, keysAndValues...)
+	if !l.enabled(zapcore.InfoLevel, msg) {
+		return
+	}
+	l.withContext(ctx).Sugar().Infow(msg, keysAndValues...)
 }
 
 func (l *logger) Debugw(ctx context.Context, msg string, keysAndValues ...interface{}) {
-	l.withTraceId(ctx).Sugar().Debugw(msg, keysAndValues...)
+	if !l.enabled(zapcore.DebugLevel, msg) {
+		return
+	}
+	l.withContext(ctx).Sugar().Debugw(msg, keysAndValues...)
 }
 
 func (l *logger) Warnw(ctx context.Context, msg string, keysAndValues ...interface{}) {
-	l.withTraceId(ctx).Sugar().Warnw(msg, keysAndValues...)
+	if !l.enabled(zapcore.WarnLevel, msg) {
+		return
+	}
+	l.withContext(ctx).Sugar().Warnw(msg, keysAndValues...)
 }
 
 func (l *logger) Errorw(ctx context.Context, msg string, keysAndValues ...interface{}) {
-	l.withTraceId(ctx).Sugar().Errorw(msg, keysAndValues...)
+	if !l.enabled(zapcore.ErrorLevel, msg) {
+		return
+	}
+	l.withContext(ctx).Sugar().Errorw(msg, keysAndValues...)
 }
 
-func (l *logger) withTraceId(ctx context.Context) *zap.Logger {
-	// 1. 定义默认字段
-	fields := []zap.Field{}
+// enabled 先判断级别, 再按消息采样
+func (l *logger) enabled(lvl zapcore.Level, msg string) bool {
+	return l.levels.enabled(l.name, lvl) && l.sampler.allow(lvl, msg)
+}
 
-	// 2. trace
-	var val, ok = ctx.Value(TraceId).(string)
-	if ok && len(val) > 0 {
-		fields = append(fields, zap.String(TraceId, val))
-	}
-	// 3. uri
-	val, ok = ctx.Value(UriId).(string)
-	if ok && len(val) > 0 {
-		fields = append(fields, zap.String(UriId, val))
-	}
-	// 4. method
-	val, ok = ctx.Value(MethodId).(string)
-	if ok && len(val) > 0 {
-		fields = append(fields, zap.String(MethodId, val))
+func (l *logger) withContext(ctx context.Context) *zap.Logger {
+	fields := contextFields(ctx)
+	if len(fields) <= 0 {
+		return l.z
 	}
 	return l.z.With(fields...)
 }
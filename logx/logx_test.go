@@ -47,7 +47,7 @@ func Test_zlog(t *testing.T) {
 				t.Fatal(err)
 				return
 			}
-			var ctx = context.WithValue(context.TODO(), traceId, p.traceId)
+			var ctx = context.WithValue(context.TODO(), TraceId, p.traceId)
 			z.Infow(ctx, p.msg, p.key, p.value)
 		}
 		t.Run(n, f)
@@ -0,0 +1,257 @@
+package logx
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/advancevillage/3rd/x"
+	"go.uber.org/zap/zapcore"
+)
+
+// Entry 观测日志记录的一条日志
+type Entry struct {
+	Time    time.Time
+	Level   string
+	Name    string
+	Message string
+	Fields  map[string]interface{} // 上下文字段、With字段及调用字段, 后者覆盖前者
+}
+
+// TestingT testing.T和testing.B的子集
+type TestingT interface {
+	Helper()
+	Logf(format string, args ...interface{})
+}
+
+type ObserveOption = x.Options[observeOption]
+
+// WithObserveLevel 最低记录级别, 默认debug
+func WithObserveLevel(level string) ObserveOption {
+	return x.NewFuncOptions(func(o *observeOption) {
+		o.level = parseLevel(level)
+	})
+}
+
+// WithObserveTesting 同时输出到testing.T.Log, 测试失败时可见
+func WithObserveTesting(t TestingT) ObserveOption {
+	return x.NewFuncOptions(func(o *observeOption) {
+		o.t = t
+	})
+}
+
+type observeOption struct {
+	level zapcore.Level
+	t     TestingT
+}
+
+// ObservedLogger 内存记录日志, 用于测试断言
+type ObservedLogger struct {
+	opts   observeOption
+	store  *observedStore // 子日志共享
+	name   string
+	fields []interface{}
+}
+
+type observedStore struct {
+	mu      sync.RWMutex
+	entries []Entry
+}
+
+var _ ILogger = (*ObservedLogger)(nil)
+
+func NewObservedLogger(opt ...ObserveOption) *ObservedLogger {
+	opts := observeOption{level: zapcore.DebugLevel}
+	for _, o := range opt {
+		o.Apply(&opts)
+	}
+	return &ObservedLogger{opts: opts, store: &observedStore{}}
+}
+
+func (l *ObservedLogger) Debugw(ctx context.Context, msg string, keysAndValues ...interface{}) {
+	if l.opts.t != nil {
+		l.opts.t.Helper()
+	}
+	l.log(ctx, zapcore.DebugLevel, msg, keysAndValues)
+}
+
+func (l *ObservedLogger) Infow(ctx context.Context, msg string, keysAndValues ...interface{}) {
+	if l.opts.t != nil {
+		l.opts.t.Helper()
+	}
+	l.log(ctx, zapcore.InfoLevel, msg, keysAndValues)
+}
+
+func (l *ObservedLogger) Warnw(ctx context.Context, msg string, keysAndValues ...interface{}) {
+	if l.opts.t != nil {
+		l.opts.t.Helper()
+	}
+	l.log(ctx, zapcore.WarnLevel, msg, keysAndValues)
+}
+
+func (l *ObservedLogger) Errorw(ctx context.Context, msg string, keysAndValues ...interface{}) {
+	if l.opts.t != nil {
+		l.opts.t.Helper()
+	}
+	l.log(ctx, zapcore.ErrorLevel, msg, keysAndValues)
+}
+
+func (l *ObservedLogger) With(keysAndValues ...interface{}) ILogger {
+	c := *l
+	c.fields = append(append([]interface{}{}, l.fields...), keysAndValues...)
+	return &c
+}
+
+func (l *ObservedLogger) Named(name string) ILogger {
+	c := *l
+	if len(l.name) > 0 {
+		c.name = l.name + "." + name
+	} else {
+		c.name = name
+	}
+	return &c
+}
+
+func (l *ObservedLogger) Sync() error {
+	return nil
+}
+
+func (l *ObservedLogger) Close() error {
+	return nil
+}
+
+func (l *ObservedLogger) log(ctx context.Context, lvl zapcore.Level, msg string, keysAndValues []interface{}) {
+	if lvl < l.opts.level {
+		return
+	}
+	// 1. 合并字段
+	e := Entry{Time: time.Now(), Level: lvl.String(), Name: l.name, Message: msg, Fields: map[string]interface{}{}}
+	for _, f := range collectFields(ctx) {
+		e.Fields[f.key] = f.val
+	}
+	for _, kv := range [][]interface{}{l.fields, keysAndValues} {
+		for i := 0; i+1 < len(kv); i += 2 {
+			e.Fields[fmt.Sprint(kv[i])] = kv[i+1]
+		}
+	}
+
+	// 2. 记录
+	l.store.mu.Lock()
+	l.store.entries = append(l.store.entries, e)
+	l.store.mu.Unlock()
+
+	// 3. 输出到测试日志
+	if l.opts.t != nil {
+		l.opts.t.Helper()
+		l.opts.t.Logf("%s", e)
+	}
+}
+
+func (e Entry) String() string {
+	var sb strings.Builder
+	sb.WriteString(strings.ToUpper(e.Level))
+	if len(e.Name) > 0 {
+		sb.WriteString(" [" + e.Name + "]")
+	}
+	sb.WriteString(" " + e.Message)
+	keys := make([]string, 0, len(e.Fields))
+	for k := range e.Fields {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		fmt.Fprintf(&sb, " %s=%v", k, e.Fields[k])
+	}
+	return sb.String()
+}
+
+// Entries 全部日志的副本
+func (l *ObservedLogger) Entries() []Entry {
+	l.store.mu.RLock()
+	defer l.store.mu.RUnlock()
+	return append([]Entry{}, l.store.entries...)
+}
+
+// Len 已记录条数
+func (l *ObservedLogger) Len() int {
+	l.store.mu.RLock()
+	defer l.store.mu.RUnlock()
+	return len(l.store.entries)
+}
+
+// TakeAll 返回并清空全部日志
+func (l *ObservedLogger) TakeAll() []Entry {
+	l.store.mu.Lock()
+	defer l.store.mu.Unlock()
+	entries := l.store.entries
+	l.store.entries = nil
+	return entries
+}
+
+// Reset 清空全部日志
+func (l *ObservedLogger) Reset() {
+	l.TakeAll()
+}
+
+// Filter 按条件筛选
+func (l *ObservedLogger) Filter(f func(Entry) bool) []Entry {
+	entries := []Entry{}
+	for _, e := range l.Entries() {
+		if f(e) {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// FilterLevel 按级别筛选
+func (l *ObservedLogger) FilterLevel(level string) []Entry {
+	level = parseLevel(level).String()
+	return l.Filter(func(e Entry) bool { return e.Level == level })
+}
+
+// FilterMessage 按消息精确筛选
+func (l *ObservedLogger) FilterMessage(msg string) []Entry {
+	return l.Filter(func(e Entry) bool { return e.Message == msg })
+}
+
+// FilterMessageSnippet 按消息片段筛选
+func (l *ObservedLogger) FilterMessageSnippet(snippet string) []Entry {
+	return l.Filter(func(e Entry) bool { return strings.Contains(e.Message, snippet) })
+}
+
+// FilterField 按字段值筛选, 值按reflect.DeepEqual比较
+func (l *ObservedLogger) FilterField(key string, val interface{}) []Entry {
+	return l.Filter(func(e Entry) bool {
+		v, ok := e.Fields[key]
+		return ok && reflect.DeepEqual(v, val)
+	})
+}
+
+// Contains 是否存在指定级别和消息的日志
+func (l *ObservedLogger) Contains(level string, msg string) bool {
+	level = parseLevel(level).String()
+	return len(l.Filter(func(e Entry) bool { return e.Level == level && e.Message == msg })) > 0
+}
+
+var _ ILogger = nopLogger{}
+
+type nopLogger struct{}
+
+// NewNopLogger 丢弃全部日志, 用于基准测试
+func NewNopLogger() ILogger {
+	return nopLogger{}
+}
+
+func (nopLogger) Debugw(ctx context.Context, msg string, keysAndValues ...interface{}) {}
+func (nopLogger) Infow(ctx context.Context, msg string, keysAndValues ...interface{})  {}
+func (nopLogger) Warnw(ctx context.Context, msg string, keysAndValues ...interface{})  {}
+func (nopLogger) Errorw(ctx context.Context, msg string, keysAndValues ...interface{}) {}
+func (n nopLogger) With(keysAndValues ...interface{}) ILogger                          { return n }
+func (n nopLogger) Named(name string) ILogger                                          { return n }
+func (nopLogger) Sync() error                                                          { return nil }
+func (nopLogger) Close() error                                                         { return nil }
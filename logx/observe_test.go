@@ -0,0 +1,59 @@
+package logx
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testRecorder struct {
+	lines []string
+}
+
+func (r *testRecorder) Helper() {}
+
+func (r *testRecorder) Logf(format string, args ...interface{}) {
+	r.lines = append(r.lines, fmt.Sprintf(format, args...))
+}
+
+func Test_observe(t *testing.T) {
+	var (
+		rec = &testRecorder{}
+		l   = NewObservedLogger(WithObserveLevel("info"), WithObserveTesting(rec))
+		ctx = UserKey.WithValue(context.WithValue(context.TODO(), TraceId, "t1"), "u1")
+	)
+	l.Debugw(ctx, "ignored")
+	l.Infow(ctx, "hello", "n", 1)
+	l.Named("dbx").With("key", "lock").Warnw(ctx, "redis lock not found", "n", 2)
+	l.Errorw(ctx, "failed", "err", "boom")
+
+	// 1. 查询
+	assert.Equal(t, 3, l.Len())
+	assert.True(t, l.Contains("warn", "redis lock not found"))
+	assert.False(t, l.Contains("debug", "ignored"))
+	assert.Equal(t, 1, len(l.FilterLevel("error")))
+	assert.Equal(t, 1, len(l.FilterMessageSnippet("lock")))
+	assert.Equal(t, 1, len(l.FilterField("n", 2)))
+	assert.Equal(t, 3, len(l.FilterField(TraceId, "t1")))
+
+	e := l.FilterMessage("redis lock not found")[0]
+	assert.Equal(t, "dbx", e.Name)
+	assert.Equal(t, map[string]interface{}{TraceId: "t1", "user": "u1", "key": "lock", "n": 2}, e.Fields)
+
+	// 2. 测试日志
+	assert.Equal(t, 3, len(rec.lines))
+	assert.Equal(t, "WARN [dbx] redis lock not found key=lock n=2 user=u1 x-3rd-trace=t1", rec.lines[1])
+
+	// 3. 清空
+	assert.Equal(t, 3, len(l.TakeAll()))
+	assert.Equal(t, 0, l.Len())
+}
+
+func Benchmark_nop(b *testing.B) {
+	l := NewNopLogger().Named("bench").With("k", "v")
+	for i := 0; i < b.N; i++ {
+		l.Infow(context.TODO(), "hello", "i", i)
+	}
+}
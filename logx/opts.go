@@ -0,0 +1,149 @@
+package logx
+
+import (
+	"io"
+	"regexp"
+	"time"
+
+	"github.com/advancevillage/3rd/x"
+	"go.uber.org/zap/zapcore"
+)
+
+type Option = x.Options[option]
+
+// WithFileOutput 同时写入文件, 按FileOption切割
+func WithFileOutput(path string, opt ...FileOption) Option {
+	return x.NewFuncOptions(func(o *option) {
+		o.sinks = append(o.sinks, sinkOption{path: path, opts: opt})
+	})
+}
+
+// WithErrorFileOutput 错误及以上级别额外写入单独文件
+func WithErrorFileOutput(path string, opt ...FileOption) Option {
+	return x.NewFuncOptions(func(o *option) {
+		o.sinks = append(o.sinks, sinkOption{path: path, opts: opt, level: "error"})
+	})
+}
+
+// WithOutput 写入任意writer, level为该输出的最低级别, 为空时使用日志级别
+func WithOutput(w io.Writer, level string) Option {
+	return x.NewFuncOptions(func(o *option) {
+		o.sinks = append(o.sinks, sinkOption{w: w, level: level})
+	})
+}
+
+// WithSink 写入自定义输出, 日志Close时一并关闭, 实现Sync时随日志刷新
+func WithSink(w io.WriteCloser, level string) Option {
+	return x.NewFuncOptions(func(o *option) {
+		o.sinks = append(o.sinks, sinkOption{w: w, c: w, level: level})
+	})
+}
+
+// WithoutStdout 不输出到标准输出
+func WithoutStdout() Option {
+	return x.NewFuncOptions(func(o *option) {
+		o.stdout = false
+	})
+}
+
+// WithFormat 输出格式 json console logfmt, 默认json; console仅在终端输出颜色
+func WithFormat(format string) Option {
+	return x.NewFuncOptions(func(o *option) {
+		o.format = format
+	})
+}
+
+// WithRedactKeys 追加需要脱敏的字段名, 不区分大小写
+func WithRedactKeys(keys ...string) Option {
+	return x.NewFuncOptions(func(o *option) {
+		o.redact.keys = append(o.redact.keys, keys...)
+	})
+}
+
+// WithRedactPattern 追加按值匹配的脱敏规则, mask为空时保留首尾部分字符
+func WithRedactPattern(re *regexp.Regexp, mask func(string) string) Option {
+	return x.NewFuncOptions(func(o *option) {
+		if mask == nil {
+			mask = maskDefault
+		}
+		o.redact.patterns = append(o.redact.patterns, redactPattern{re: re, mask: mask})
+	})
+}
+
+// WithoutRedact 关闭脱敏
+func WithoutRedact() Option {
+	return x.NewFuncOptions(func(o *option) {
+		o.redact.disabled = true
+	})
+}
+
+// WithSampling 开启采样, 每个周期内同一级别同一消息先输出first条, 之后每thereafter条输出1条
+// thereafter为0时超出first条全部丢弃, 每个周期输出一次丢弃汇总
+func WithSampling(interval time.Duration, first int, thereafter int) Option {
+	return x.NewFuncOptions(func(o *option) {
+		o.sample.interval = interval
+		o.sample.first = max(first, 0)
+		o.sample.thereafter = max(thereafter, 0)
+	})
+}
+
+// WithLevelCap 每个采样周期内某一级别最多输出n条, 需配合WithSampling
+func WithLevelCap(level string, n int) Option {
+	return x.NewFuncOptions(func(o *option) {
+		if o.sample.caps == nil {
+			o.sample.caps = map[zapcore.Level]int{}
+		}
+		o.sample.caps[parseLevel(level)] = max(n, 0)
+	})
+}
+
+// WithAsync 开启异步写入, 每个输出最多缓冲size条, 满时按policy处理
+// 后台协程批量写入并每秒刷盘一次, 退出前需调用Sync或Close
+func WithAsync(size int, policy OverflowPolicy) Option {
+	return x.NewFuncOptions(func(o *option) {
+		o.async.size = max(size, 0)
+		o.async.policy = policy
+	})
+}
+
+// WithAsyncFlushInterval 异步模式下的刷盘间隔, 0表示仅在Sync时刷盘
+func WithAsyncFlushInterval(interval time.Duration) Option {
+	return x.NewFuncOptions(func(o *option) {
+		o.async.interval = max(interval, 0)
+	})
+}
+
+type sinkOption struct {
+	path  string       // 文件路径
+	opts  []FileOption // 文件切割
+	w     io.Writer    // 自定义输出
+	c     io.Closer    // 随日志关闭
+	level string       // 最低级别
+}
+
+type redactOption struct {
+	disabled bool            // 关闭脱敏
+	keys     []string        // 敏感字段名
+	patterns []redactPattern // 敏感值模式
+}
+
+type option struct {
+	format string       // 输出格式
+	stdout bool         // 标准输出
+	sinks  []sinkOption // 其他输出
+	redact redactOption // 脱敏
+	sample sampleOption // 采样
+	async  asyncOption  // 异步
+}
+
+func newDefaultOption() option {
+	return option{
+		format: FormatJSON,
+		stdout: true,
+		async:  asyncOption{interval: time.Second},
+		redact: redactOption{
+			keys:     append([]string{}, defaultRedactKeys...),
+			patterns: append([]redactPattern{}, defaultRedactPatterns...),
+		},
+	}
+}
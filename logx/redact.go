@@ -0,0 +1,279 @@
+package logx
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/advancevillage/3rd/x"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Secret 敏感值, 输出到日志时部分掩码
+type Secret string
+
+func (s Secret) String() string {
+	return maskDefault(string(s))
+}
+
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// Mask 保留前prefix个和后suffix个字符, 中间替换为****
+// Mask("13812341234", 3, 4) = 138****1234
+func Mask(s string, prefix int, suffix int) string {
+	n := utf8.RuneCountInString(s)
+	if prefix < 0 || suffix < 0 || prefix+suffix >= n {
+		return "****"
+	}
+	r := []rune(s)
+	return string(r[:prefix]) + "****" + string(r[n-suffix:])
+}
+
+// maskDefault 短值全部掩码, 长值保留首尾各四分之一(最多4个字符)
+func maskDefault(s string) string {
+	n := utf8.RuneCountInString(s)
+	if n < 8 {
+		return "****"
+	}
+	keep := min(n/4, 4)
+	return Mask(s, keep, keep)
+}
+
+var defaultRedactKeys = []string{"sk", "secret", "password", "passwd", "token", "authorization", "apikey", "credential"}
+
+type redactPattern struct {
+	re   *regexp.Regexp
+	mask func(string) string
+	need func(h valueHint) bool // 匹配的必要条件, 为空时总是匹配
+}
+
+// valueHint 扫描一次得到的特征, 不满足时跳过对应正则
+type valueHint struct {
+	digits int  // 最长连续数字
+	at     bool // 含@
+	bearer bool // 含bearer
+}
+
+func newValueHint(s string) valueHint {
+	var h valueHint
+	for i, run := 0, 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case '0' <= c && c <= '9':
+			run++
+			h.digits = max(h.digits, run)
+			continue
+		case c == '@':
+			h.at = true
+		case (c == 'b' || c == 'B') && len(s)-i >= 6 && strings.EqualFold(s[i:i+6], "bearer"):
+			h.bearer = true
+		}
+		run = 0
+	}
+	return h
+}
+
+// 顺序敏感: 身份证先于手机号匹配
+var defaultRedactPatterns = []redactPattern{
+	{re: regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9\-._~+/]+=*`), mask: func(s string) string { return s[:6] + " ****" }, need: func(h valueHint) bool { return h.bearer }},
+	{re: regexp.MustCompile(`\b[1-9]\d{5}(?:19|20)\d{2}(?:0[1-9]|1[0-2])\d{2}\d{3}[\dXx]\b`), mask: func(s string) string { return Mask(s, 6, 4) }, need: func(h valueHint) bool { return h.digits >= 17 }},
+	{re: regexp.MustCompile(`(?:\b86|\b)1[3-9]\d{9}\b`), mask: func(s string) string { return Mask(s, len(s)-8, 4) }, need: func(h valueHint) bool { return h.digits >= 11 }},
+	{re: regexp.MustCompile(`\b[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}\b`), mask: maskEmail, need: func(h valueHint) bool { return h.at }},
+}
+
+func maskEmail(s string) string {
+	i := strings.LastIndex(s, "@")
+	return Mask(s[:i], 1, 0) + s[i:]
+}
+
+type redactor struct {
+	keys     map[string]struct{}
+	patterns []redactPattern
+	hits     sync.Map // 键名 -> 是否敏感, 键名来自代码, 数量有限
+}
+
+func newRedactor(opts redactOption) *redactor {
+	if opts.disabled {
+		return nil
+	}
+	r := &redactor{keys: map[string]struct{}{}}
+	for _, k := range opts.keys {
+		r.keys[strings.ToLower(k)] = struct{}{}
+	}
+	r.patterns = append(r.patterns, opts.patterns...)
+	return r
+}
+
+// sensitiveKey 键名按分隔符和驼峰拆分, 任一片段、相邻两段或整体命中即脱敏
+// access_token accessToken X-Api-Key 均可命中
+func (r *redactor) sensitiveKey(key string) bool {
+	if v, ok := r.hits.Load(key); ok {
+		return v.(bool)
+	}
+	hit := r.matchKey(key)
+	r.hits.Store(key, hit)
+	return hit
+}
+
+func (r *redactor) matchKey(key string) bool {
+	var (
+		words = []string{}
+		word  = []rune{}
+		full  = []rune{}
+		prev  rune
+	)
+	for _, c := range key {
+		switch {
+		case !unicode.IsLetter(c) && !unicode.IsDigit(c):
+			words, word = append(words, string(word)), word[:0]
+		case unicode.IsUpper(c) && unicode.IsLower(prev):
+			words, word = append(words, string(word)), append(word[:0], unicode.ToLower(c))
+			full = append(full, unicode.ToLower(c))
+		default:
+			word = append(word, unicode.ToLower(c))
+			full = append(full, unicode.ToLower(c))
+		}
+		prev = c
+	}
+	words = append(words, string(word))
+	for i, w := range words {
+		if _, ok := r.keys[w]; ok {
+			return true
+		}
+		if i > 0 {
+			if _, ok := r.keys[words[i-1]+w]; ok {
+				return true
+			}
+		}
+	}
+	_, ok := r.keys[string(full)]
+	return ok
+}
+
+func (r *redactor) redactString(s string) string {
+	if len(s) <= 0 {
+		return s
+	}
+	// 不满足必要条件时跳过正则, 大部分日志值无需匹配
+	h := newValueHint(s)
+	for _, p := range r.patterns {
+		if p.need != nil && !p.need(h) {
+			continue
+		}
+		s = p.re.ReplaceAllStringFunc(s, p.mask)
+	}
+	return redactSecrets(s)
+}
+
+// redactSecrets 替换配置中ENC(...)解密得到的明文
+func redactSecrets(s string) string {
+	secrets := x.Secrets()
+	if len(secrets) <= 0 {
+		return s
+	}
+	for _, v := range secrets {
+		if strings.Contains(s, v) {
+			s = strings.ReplaceAll(s, v, maskDefault(v))
+		}
+	}
+	return s
+}
+
+func (r *redactor) redactField(f zapcore.Field) zapcore.Field {
+	// 1. 已掩码
+	if _, ok := f.Interface.(Secret); ok {
+		return f
+	}
+	// 2. 按键名
+	if r.sensitiveKey(f.Key) {
+		switch f.Type {
+		case zapcore.StringType:
+			return zap.String(f.Key, maskDefault(f.String))
+		case zapcore.ByteStringType:
+			return zap.String(f.Key, maskDefault(string(f.Interface.([]byte))))
+		case zapcore.StringerType:
+			return zap.String(f.Key, maskDefault(fmt.Sprint(f.Interface)))
+		default:
+			return zap.String(f.Key, "****")
+		}
+	}
+	// 3. 按值模式
+	switch f.Type {
+	case zapcore.StringType:
+		f.String = r.redactString(f.String)
+	case zapcore.ByteStringType:
+		return zap.String(f.Key, r.redactString(string(f.Interface.([]byte))))
+	case zapcore.StringerType:
+		return zap.String(f.Key, r.redactString(fmt.Sprint(f.Interface)))
+	case zapcore.ErrorType:
+		if err, ok := f.Interface.(error); ok {
+			msg := err.Error()
+			if red := r.redactString(msg); red != msg {
+				return zap.String(f.Key, red)
+			}
+		}
+	case zapcore.ReflectType:
+		// 如直接输出配置对象
+		if len(x.Secrets()) <= 0 {
+			break
+		}
+		var (
+			buf = &bytes.Buffer{}
+			enc = json.NewEncoder(buf)
+		)
+		enc.SetEscapeHTML(false) // DSN中的&不转义
+		if err := enc.Encode(f.Interface); err == nil {
+			if s := strings.TrimSuffix(buf.String(), "\n"); redactSecrets(s) != s {
+				return zap.Reflect(f.Key, json.RawMessage(redactSecrets(s)))
+			}
+		}
+	}
+	return f
+}
+
+func (r *redactor) redactFields(fs []zapcore.Field) []zapcore.Field {
+	if len(fs) <= 0 {
+		return fs
+	}
+	out := make([]zapcore.Field, len(fs))
+	for i := range fs {
+		out[i] = r.redactField(fs[i])
+	}
+	return out
+}
+
+// redactCore 包装单个输出, 写入前脱敏消息和字段
+type redactCore struct {
+	zapcore.Core
+	r *redactor
+}
+
+func newRedactCore(core zapcore.Core, r *redactor) zapcore.Core {
+	if r == nil {
+		return core
+	}
+	return &redactCore{Core: core, r: r}
+}
+
+func (c *redactCore) With(fs []zapcore.Field) zapcore.Core {
+	return &redactCore{Core: c.Core.With(c.r.redactFields(fs)), r: c.r}
+}
+
+func (c *redactCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *redactCore) Write(ent zapcore.Entry, fs []zapcore.Field) error {
+	ent.Message = c.r.redactString(ent.Message)
+	return c.Core.Write(ent, c.r.redactFields(fs))
+}
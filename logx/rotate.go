@@ -0,0 +1,316 @@
+package logx
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/advancevillage/3rd/x"
+)
+
+const backupTmFmt = "2006-01-02T15-04-05.000"
+
+type FileOption = x.Options[fileOption]
+
+// WithFileMaxSize 单个文件最大字节数, 超过后切割, 0不限制
+func WithFileMaxSize(size int64) FileOption {
+	return x.NewFuncOptions(func(o *fileOption) {
+		o.maxSize = size
+	})
+}
+
+// WithFileRotateEvery 按时间切割, 如24小时每天切割一次
+func WithFileRotateEvery(interval time.Duration) FileOption {
+	return x.NewFuncOptions(func(o *fileOption) {
+		o.interval = interval
+	})
+}
+
+// WithFileMaxBackups 最多保留的历史文件数, 0不限制
+func WithFileMaxBackups(n int) FileOption {
+	return x.NewFuncOptions(func(o *fileOption) {
+		o.maxBackups = n
+	})
+}
+
+// WithFileMaxAge 历史文件最长保留时间, 0不限制
+func WithFileMaxAge(age time.Duration) FileOption {
+	return x.NewFuncOptions(func(o *fileOption) {
+		o.maxAge = age
+	})
+}
+
+// WithFileCompress 切割后的历史文件使用gzip压缩
+func WithFileCompress() FileOption {
+	return x.NewFuncOptions(func(o *fileOption) {
+		o.compress = true
+	})
+}
+
+type fileOption struct {
+	maxSize    int64         // 最大字节数
+	interval   time.Duration // 切割间隔
+	maxBackups int           // 历史文件数
+	maxAge     time.Duration // 历史文件保留时间
+	compress   bool          // 压缩历史文件
+}
+
+var defaultFileOption = fileOption{
+	maxSize:    100 << 20,
+	interval:   0,
+	maxBackups: 0,
+	maxAge:     0,
+	compress:   false,
+}
+
+// RotateWriter 按大小及时间切割的日志文件, 并发安全
+// 历史文件命名为 name-时间.ext, 压缩后追加.gz
+type RotateWriter struct {
+	opts fileOption
+	path string
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+	next time.Time // 下次按时间切割的时刻
+
+	mill chan struct{}  // 清理历史文件
+	wg   sync.WaitGroup // 等待清理结束
+}
+
+func NewRotateWriter(path string, opt ...FileOption) (*RotateWriter, error) {
+	opts := defaultFileOption
+	for _, o := range opt {
+		o.Apply(&opts)
+	}
+	w := &RotateWriter{opts: opts, path: path, mill: make(chan struct{}, 1)}
+	err := os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		return nil, err
+	}
+	err = w.open()
+	if err != nil {
+		return nil, err
+	}
+	w.wg.Add(1)
+	go w.millRun()
+	return w, nil
+}
+
+func (w *RotateWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return 0, os.ErrClosed
+	}
+	var (
+		now     = time.Now()
+		bySize  = w.opts.maxSize > 0 && w.size > 0 && w.size+int64(len(p)) > w.opts.maxSize
+		byClock = w.opts.interval > 0 && !now.Before(w.next)
+	)
+	// 切割失败时继续写入当前文件, 下次写入重试
+	var rerr error
+	if bySize || byClock {
+		rerr = w.rotate(now)
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	if err == nil {
+		err = rerr
+	}
+	return n, err
+}
+
+func (w *RotateWriter) Sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	return w.file.Sync()
+}
+
+// Close 刷盘并关闭文件, 等待历史文件清理完成
+func (w *RotateWriter) Close() error {
+	w.mu.Lock()
+	if w.file == nil {
+		w.mu.Unlock()
+		return nil
+	}
+	err := w.file.Sync()
+	if cerr := w.file.Close(); err == nil {
+		err = cerr
+	}
+	w.file = nil
+	close(w.mill)
+	w.mu.Unlock()
+	w.wg.Wait()
+	return err
+}
+
+// Rotate 立即切割
+func (w *RotateWriter) Rotate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return os.ErrClosed
+	}
+	return w.rotate(time.Now())
+}
+
+func (w *RotateWriter) open() error {
+	f, size, err := w.openFile()
+	if err != nil {
+		return err
+	}
+	w.setFile(f, size)
+	return nil
+}
+
+func (w *RotateWriter) openFile() (*os.File, int64, error) {
+	f, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, 0, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	return f, fi.Size(), nil
+}
+
+func (w *RotateWriter) setFile(f *os.File, size int64) {
+	w.file, w.size = f, size
+	if w.opts.interval > 0 {
+		w.next = time.Now().Truncate(w.opts.interval).Add(w.opts.interval)
+	}
+}
+
+// rotate 新文件打开成功前保留旧句柄, 任一步失败都不影响继续写入
+func (w *RotateWriter) rotate(now time.Time) error {
+	// 1. 重命名为历史文件, 上次切割已重命名时文件不存在
+	if w.size > 0 {
+		err := os.Rename(w.path, w.backupName(now))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	// 2. 打开新文件
+	f, size, err := w.openFile()
+	if err != nil {
+		return err
+	}
+	// 3. 关闭旧文件
+	err = w.file.Close()
+	w.setFile(f, size)
+	// 4. 通知清理
+	select {
+	case w.mill <- struct{}{}:
+	default:
+	}
+	return err
+}
+
+// backupName 同一毫秒内多次切割时顺延, 避免覆盖
+func (w *RotateWriter) backupName(t time.Time) string {
+	var (
+		dir  = filepath.Dir(w.path)
+		base = filepath.Base(w.path)
+		ext  = filepath.Ext(base)
+	)
+	for {
+		name := filepath.Join(dir, fmt.Sprintf("%s-%s%s", strings.TrimSuffix(base, ext), t.Format(backupTmFmt), ext))
+		_, err := os.Stat(name)
+		_, gerr := os.Stat(name + ".gz")
+		if os.IsNotExist(err) && os.IsNotExist(gerr) {
+			return name
+		}
+		t = t.Add(time.Millisecond)
+	}
+}
+
+func (w *RotateWriter) millRun() {
+	defer w.wg.Done()
+	for range w.mill {
+		w.millRunOnce()
+	}
+}
+
+type backupFile struct {
+	path string
+	t    time.Time
+}
+
+// millRunOnce 压缩并删除超出数量或过期的历史文件
+func (w *RotateWriter) millRunOnce() {
+	var (
+		dir    = filepath.Dir(w.path)
+		base   = filepath.Base(w.path)
+		ext    = filepath.Ext(base)
+		prefix = strings.TrimSuffix(base, ext) + "-"
+	)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	backups := []backupFile{}
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		ts := strings.TrimPrefix(name, prefix)
+		ts = strings.TrimSuffix(strings.TrimSuffix(ts, ".gz"), ext)
+		t, err := time.ParseInLocation(backupTmFmt, ts, time.Local)
+		if err != nil {
+			continue
+		}
+		backups = append(backups, backupFile{path: filepath.Join(dir, name), t: t})
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].t.After(backups[j].t) })
+
+	for i, b := range backups {
+		switch {
+		case w.opts.maxBackups > 0 && i >= w.opts.maxBackups:
+			os.Remove(b.path)
+
+		case w.opts.maxAge > 0 && time.Since(b.t) > w.opts.maxAge:
+			os.Remove(b.path)
+
+		case w.opts.compress && !strings.HasSuffix(b.path, ".gz"):
+			compressFile(b.path)
+		}
+	}
+}
+
+func compressFile(src string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(src+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(out)
+	_, err = io.Copy(gz, in)
+	if err == nil {
+		err = gz.Close()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(src + ".gz")
+		return err
+	}
+	return os.Remove(src)
+}
@@ -0,0 +1,144 @@
+package logx
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_rotate(t *testing.T) {
+	var data = map[string]struct {
+		opts   []FileOption
+		writes int
+		sleep  time.Duration
+		check  func(t *testing.T, backups []string)
+	}{
+		"case-size": {
+			opts:   []FileOption{WithFileMaxSize(100)},
+			writes: 11,
+			check: func(t *testing.T, backups []string) {
+				assert.Equal(t, 2, len(backups))
+			},
+		},
+		"case-backups-compress": {
+			opts:   []FileOption{WithFileMaxSize(50), WithFileMaxBackups(2), WithFileCompress()},
+			writes: 10,
+			check: func(t *testing.T, backups []string) {
+				assert.Equal(t, 2, len(backups))
+				for _, b := range backups {
+					assert.True(t, strings.HasSuffix(b, ".log.gz"))
+				}
+			},
+		},
+		"case-time": {
+			opts:   []FileOption{WithFileMaxSize(0), WithFileRotateEvery(50 * time.Millisecond)},
+			writes: 3,
+			sleep:  60 * time.Millisecond,
+			check: func(t *testing.T, backups []string) {
+				assert.True(t, len(backups) >= 2)
+			},
+		},
+	}
+	for n, v := range data {
+		f := func(t *testing.T) {
+			var (
+				dir  = t.TempDir()
+				path = filepath.Join(dir, "app.log")
+			)
+			w, err := NewRotateWriter(path, v.opts...)
+			assert.Nil(t, err)
+			for range v.writes {
+				// 每行20字节
+				_, err = w.Write([]byte("0123456789abcdefghi\n"))
+				assert.Nil(t, err)
+				time.Sleep(v.sleep + time.Millisecond)
+			}
+			assert.Nil(t, w.Close())
+
+			backups, err := filepath.Glob(filepath.Join(dir, "app-*"))
+			assert.Nil(t, err)
+			v.check(t, backups)
+		}
+		t.Run(n, f)
+	}
+}
+
+func Test_rotate_failed(t *testing.T) {
+	var (
+		dir  = filepath.Join(t.TempDir(), "logs")
+		path = filepath.Join(dir, "app.log")
+		line = []byte("0123456789abcdefghi\n")
+	)
+	w, err := NewRotateWriter(path, WithFileMaxSize(30))
+	assert.Nil(t, err)
+	_, err = w.Write(line)
+	assert.Nil(t, err)
+
+	// 1. 目录被删除, 切割失败仍写入旧文件
+	assert.Nil(t, os.RemoveAll(dir))
+	n, err := w.Write(line)
+	assert.NotNil(t, err)
+	assert.NotErrorIs(t, err, os.ErrClosed)
+	assert.Equal(t, len(line), n)
+
+	// 2. 目录恢复后下次写入重新切割
+	assert.Nil(t, os.MkdirAll(dir, 0o755))
+	_, err = w.Write(line)
+	assert.Nil(t, err)
+	assert.Nil(t, w.Close())
+	buf, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, line, buf)
+}
+
+func Test_file_output(t *testing.T) {
+	var (
+		dir     = t.TempDir()
+		all     = filepath.Join(dir, "app.log")
+		errs    = filepath.Join(dir, "error.log")
+		wg      sync.WaitGroup
+		workers = 8
+	)
+	l, err := NewLogger("info", WithoutStdout(), WithFileOutput(all, WithFileMaxSize(4<<10)), WithErrorFileOutput(errs))
+	assert.Nil(t, err)
+
+	ctx := context.WithValue(context.TODO(), TraceId, "trace")
+	for i := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range 50 {
+				l.Debugw(ctx, "debug", "i", i, "j", j)
+				l.Infow(ctx, "info", "i", i, "j", j)
+			}
+			l.Errorw(ctx, "error", "i", i)
+		}()
+	}
+	wg.Wait()
+	assert.Nil(t, Close(l))
+
+	// 1. 错误文件只有错误日志
+	buf, err := os.ReadFile(errs)
+	assert.Nil(t, err)
+	assert.Equal(t, workers, strings.Count(string(buf), "\n"))
+	assert.NotContains(t, string(buf), `"msg":"info"`)
+
+	// 2. 全量文件按大小切割, 不含debug日志且无丢失
+	files, err := filepath.Glob(filepath.Join(dir, "app*.log"))
+	assert.Nil(t, err)
+	assert.True(t, len(files) > 1)
+	lines := 0
+	for _, f := range files {
+		buf, err := os.ReadFile(f)
+		assert.Nil(t, err)
+		assert.NotContains(t, string(buf), `"msg":"debug"`)
+		lines += strings.Count(string(buf), "\n")
+	}
+	assert.Equal(t, workers*51, lines)
+}
@@ -0,0 +1,125 @@
+package logx
+
+import (
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+type sampleOption struct {
+	interval   time.Duration         // 采样周期
+	first      int                   // 每条消息先输出条数
+	thereafter int                   // 之后每N条输出1条
+	caps       map[zapcore.Level]int // 级别上限
+}
+
+type sampleKey struct {
+	lvl zapcore.Level
+	msg string
+}
+
+type sampler struct {
+	opts    sampleOption
+	z       *zap.Logger
+	mu      sync.Mutex
+	counts  map[sampleKey]int
+	levels  map[zapcore.Level]int // 周期内已输出
+	dropped map[zapcore.Level]int // 周期内丢弃
+	done    chan struct{}
+	exit    chan struct{}
+	once    sync.Once
+}
+
+func newSampler(z *zap.Logger, opts sampleOption) *sampler {
+	if opts.interval <= 0 {
+		return nil
+	}
+	s := &sampler{
+		opts:    opts,
+		z:       z,
+		counts:  map[sampleKey]int{},
+		levels:  map[zapcore.Level]int{},
+		dropped: map[zapcore.Level]int{},
+		done:    make(chan struct{}),
+		exit:    make(chan struct{}),
+	}
+	go s.loop()
+	return s
+}
+
+func (s *sampler) allow(lvl zapcore.Level, msg string) bool {
+	if s == nil {
+		return true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// 1. 级别上限
+	if limit, ok := s.opts.caps[lvl]; ok && s.levels[lvl] >= limit {
+		s.dropped[lvl]++
+		return false
+	}
+
+	// 2. 先first条, 之后每thereafter条
+	k := sampleKey{lvl: lvl, msg: msg}
+	n := s.counts[k] + 1
+	s.counts[k] = n
+	if n > s.opts.first && (s.opts.thereafter <= 0 || (n-s.opts.first)%s.opts.thereafter != 0) {
+		s.dropped[lvl]++
+		return false
+	}
+	s.levels[lvl]++
+	return true
+}
+
+func (s *sampler) loop() {
+	t := time.NewTicker(s.opts.interval)
+	defer t.Stop()
+	defer close(s.exit)
+	for {
+		select {
+		case <-s.done:
+			s.reset()
+			return
+		case <-t.C:
+			s.reset()
+		}
+	}
+}
+
+// reset 进入下一周期, 有丢弃时输出汇总
+func (s *sampler) reset() {
+	s.mu.Lock()
+	var (
+		dropped = s.dropped
+		total   = 0
+	)
+	s.counts = map[sampleKey]int{}
+	s.levels = map[zapcore.Level]int{}
+	s.dropped = map[zapcore.Level]int{}
+	s.mu.Unlock()
+
+	fields := make([]zap.Field, 0, len(dropped)+2)
+	for lvl := zapcore.DebugLevel; lvl <= zapcore.FatalLevel; lvl++ {
+		if n := dropped[lvl]; n > 0 {
+			fields = append(fields, zap.Int(lvl.String(), n))
+			total += n
+		}
+	}
+	if total <= 0 {
+		return
+	}
+	fields = append(fields, zap.Int("total", total), zap.Duration("interval", s.opts.interval))
+	s.z.Warn("logx: entries dropped by sampling", fields...)
+}
+
+// close 停止采样并输出最后一个周期的汇总
+func (s *sampler) close() {
+	if s == nil {
+		return
+	}
+	s.once.Do(func() { close(s.done) })
+	<-s.exit
+}
@@ -0,0 +1,90 @@
+package logx
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_sample(t *testing.T) {
+	var data = map[string]struct {
+		opts    []Option
+		errors  int
+		infos   int
+		expErr  int
+		expInfo int
+		dropped string
+	}{
+		"case-first-thereafter": {
+			opts:    []Option{WithSampling(time.Hour, 3, 10)},
+			errors:  100,
+			infos:   2,
+			expErr:  3 + 9,
+			expInfo: 2,
+			dropped: `"error":88,"total":88`,
+		},
+		"case-first-only": {
+			opts:    []Option{WithSampling(time.Hour, 5, 0)},
+			errors:  100,
+			infos:   100,
+			expErr:  5,
+			expInfo: 5,
+			dropped: `"info":95,"error":95,"total":190`,
+		},
+		"case-level-cap": {
+			opts:    []Option{WithSampling(time.Hour, 100, 1), WithLevelCap("error", 20)},
+			errors:  100,
+			infos:   50,
+			expErr:  20,
+			expInfo: 50,
+			dropped: `"error":80,"total":80`,
+		},
+		"case-disabled": {
+			errors:  100,
+			infos:   100,
+			expErr:  100,
+			expInfo: 100,
+		},
+	}
+	for n, v := range data {
+		f := func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			l, err := NewLogger("info", append([]Option{WithoutStdout(), WithOutput(buf, "")}, v.opts...)...)
+			assert.Nil(t, err)
+			for i := range v.errors {
+				l.Errorw(context.TODO(), "xreadgroup failed", "i", i)
+			}
+			for i := range v.infos {
+				l.Infow(context.TODO(), "descriptor loop", "i", i)
+			}
+			assert.Nil(t, Close(l))
+
+			assert.Equal(t, v.expErr, strings.Count(buf.String(), `"msg":"xreadgroup failed"`))
+			assert.Equal(t, v.expInfo, strings.Count(buf.String(), `"msg":"descriptor loop"`))
+			if len(v.dropped) > 0 {
+				assert.Contains(t, buf.String(), v.dropped)
+			} else {
+				assert.NotContains(t, buf.String(), "dropped by sampling")
+			}
+		}
+		t.Run(n, f)
+	}
+}
+
+func Test_sample_interval(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l, err := NewLogger("info", WithoutStdout(), WithOutput(buf, ""), WithSampling(50*time.Millisecond, 1, 0))
+	assert.Nil(t, err)
+	for range 3 {
+		l.Warnw(context.TODO(), "flood")
+		l.Warnw(context.TODO(), "flood")
+		time.Sleep(80 * time.Millisecond)
+	}
+	assert.Nil(t, Close(l))
+	assert.Equal(t, 3, strings.Count(buf.String(), `"msg":"flood"`))
+	assert.Equal(t, 3, strings.Count(buf.String(), `"warn":1,"total":1`))
+}
@@ -0,0 +1,299 @@
+package netx
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/advancevillage/3rd/logx"
+)
+
+var ErrCertNotFound = errors.New("cert: no certificate found")
+
+// CertProvider 服务端证书, 证书更新后原子替换, 新连接立即生效
+type CertProvider interface {
+	GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error)
+}
+
+// TrustProvider 客户端信任证书
+type TrustProvider interface {
+	RootCAs() *x509.CertPool
+}
+
+type CertOption = Option[certOptions]
+
+// WithCertInterval 检查证书变化的间隔, 小于等于0时不检查
+func WithCertInterval(interval time.Duration) CertOption {
+	return newFuncOption(func(o *certOptions) {
+		o.interval = interval
+	})
+}
+
+// WithCertExpiryWarning 证书剩余有效期小于warning时告警
+func WithCertExpiryWarning(warning time.Duration) CertOption {
+	return newFuncOption(func(o *certOptions) {
+		o.warning = warning
+	})
+}
+
+type certOptions struct {
+	interval time.Duration // 检查间隔
+	warning  time.Duration // 过期告警
+}
+
+var defaultCertOptions = certOptions{
+	interval: time.Minute,
+	warning:  7 * 24 * time.Hour,
+}
+
+var _ CertProvider = (*certProvider)(nil)
+
+type certProvider struct {
+	opts   certOptions
+	logger logx.ILogger
+	cert   atomic.Pointer[tls.Certificate]
+	load   func(ctx context.Context) (*tls.Certificate, error)
+}
+
+// NewFileCertProvider 监听证书及私钥文件, 文件变化时重新加载(如certbot续期)
+func NewFileCertProvider(ctx context.Context, logger logx.ILogger, crt, key string, opt ...CertOption) (CertProvider, error) {
+	load := func(ctx context.Context) (*tls.Certificate, error) {
+		cert, err := tls.LoadX509KeyPair(crt, key)
+		if err != nil {
+			return nil, err
+		}
+		return &cert, nil
+	}
+	return newCertProvider(ctx, logger, load, func() string { return fileStamp(crt, key) }, opt...)
+}
+
+// NewFuncCertProvider 每个检查间隔调用f获取证书, 可对接证书管理服务
+func NewFuncCertProvider(ctx context.Context, logger logx.ILogger, f func(ctx context.Context) (*tls.Certificate, error), opt ...CertOption) (CertProvider, error) {
+	return newCertProvider(ctx, logger, f, nil, opt...)
+}
+
+func newCertProvider(ctx context.Context, logger logx.ILogger, load func(ctx context.Context) (*tls.Certificate, error), stamp func() string, opt ...CertOption) (*certProvider, error) {
+	opts := defaultCertOptions
+	for _, o := range opt {
+		o.apply(&opts)
+	}
+	p := &certProvider{opts: opts, logger: logger, load: load}
+	err := p.reload(ctx)
+	if err != nil {
+		return nil, err
+	}
+	go watchCert(ctx, opts, stamp, p.reload, p.expiry)
+	return p, nil
+}
+
+func (p *certProvider) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return p.cert.Load(), nil
+}
+
+func (p *certProvider) reload(ctx context.Context) error {
+	cert, err := p.load(ctx)
+	if err != nil {
+		p.logger.Errorw(ctx, "cert: load certificate failed", "err", err)
+		return err
+	}
+	if cert.Leaf == nil && len(cert.Certificate) > 0 {
+		cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			p.logger.Errorw(ctx, "cert: parse certificate failed", "err", err)
+			return err
+		}
+	}
+	if cert.Leaf == nil {
+		return ErrCertNotFound
+	}
+	old := p.cert.Swap(cert)
+	if old == nil || old.Leaf.SerialNumber.Cmp(cert.Leaf.SerialNumber) != 0 {
+		p.logger.Infow(ctx, "cert: certificate loaded", "subject", cert.Leaf.Subject.String(), "dns", cert.Leaf.DNSNames, "notAfter", cert.Leaf.NotAfter.Format(time.RFC3339))
+		p.expiry(ctx)
+	}
+	return nil
+}
+
+func (p *certProvider) expiry(ctx context.Context) {
+	if cert := p.cert.Load(); cert != nil {
+		checkCertExpiry(ctx, p.logger, p.opts.warning, cert.Leaf)
+	}
+}
+
+var _ TrustProvider = (*trustProvider)(nil)
+
+type trustProvider struct {
+	opts   certOptions
+	logger logx.ILogger
+	crt    string
+	pool   atomic.Pointer[x509.CertPool]
+	certs  atomic.Pointer[[]*x509.Certificate]
+}
+
+// NewFileTrustProvider 监听PEM格式的信任证书文件, 文件变化时重新加载
+func NewFileTrustProvider(ctx context.Context, logger logx.ILogger, crt string, opt ...CertOption) (TrustProvider, error) {
+	opts := defaultCertOptions
+	for _, o := range opt {
+		o.apply(&opts)
+	}
+	p := &trustProvider{opts: opts, logger: logger, crt: crt}
+	err := p.reload(ctx)
+	if err != nil {
+		return nil, err
+	}
+	go watchCert(ctx, opts, func() string { return fileStamp(crt) }, p.reload, p.expiry)
+	return p, nil
+}
+
+func (p *trustProvider) RootCAs() *x509.CertPool {
+	return p.pool.Load()
+}
+
+func (p *trustProvider) reload(ctx context.Context) error {
+	buf, err := os.ReadFile(p.crt)
+	if err != nil {
+		p.logger.Errorw(ctx, "cert: read trust bundle failed", "err", err, "crt", p.crt)
+		return err
+	}
+	var (
+		pool  = x509.NewCertPool()
+		certs = []*x509.Certificate{}
+	)
+	for block, rest := pem.Decode(buf); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			p.logger.Errorw(ctx, "cert: parse trust bundle failed", "err", err, "crt", p.crt)
+			return err
+		}
+		pool.AddCert(cert)
+		certs = append(certs, cert)
+	}
+	if len(certs) <= 0 {
+		p.logger.Errorw(ctx, "cert: empty trust bundle", "crt", p.crt)
+		return ErrCertNotFound
+	}
+	p.pool.Store(pool)
+	p.certs.Store(&certs)
+	p.logger.Infow(ctx, "cert: trust bundle loaded", "crt", p.crt, "count", len(certs))
+	p.expiry(ctx)
+	return nil
+}
+
+func (p *trustProvider) expiry(ctx context.Context) {
+	certs := p.certs.Load()
+	if certs == nil {
+		return
+	}
+	for _, cert := range *certs {
+		checkCertExpiry(ctx, p.logger, p.opts.warning, cert)
+	}
+}
+
+// newServerCertProvider 未指定证书提供者时监听证书文件
+func newServerCertProvider(ctx context.Context, logger logx.ILogger, opts serverOptions) (CertProvider, error) {
+	if opts.certs != nil {
+		return opts.certs, nil
+	}
+	certs, err := NewFileCertProvider(ctx, logger, opts.crt, opts.key)
+	if err != nil {
+		logger.Errorw(ctx, "read cert file failed", "err", err, "crt", opts.crt, "key", opts.key)
+		return nil, err
+	}
+	return certs, nil
+}
+
+// newClientTLSConfig 握手时使用最新的信任证书校验服务端证书链
+func newClientTLSConfig(trust TrustProvider, domain string) *tls.Config {
+	return &tls.Config{
+		ServerName: domain,
+		// 由VerifyConnection校验, 信任证书可在运行时替换
+		InsecureSkipVerify: true,
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) <= 0 {
+				return ErrCertNotFound
+			}
+			opts := x509.VerifyOptions{
+				DNSName:       cs.ServerName,
+				Roots:         trust.RootCAs(),
+				Intermediates: x509.NewCertPool(),
+			}
+			for _, cert := range cs.PeerCertificates[1:] {
+				opts.Intermediates.AddCert(cert)
+			}
+			_, err := cs.PeerCertificates[0].Verify(opts)
+			return err
+		},
+	}
+}
+
+// watchCert 定期检查变化, stamp为空时每次均重新加载; 加载失败保留旧证书
+func watchCert(ctx context.Context, opts certOptions, stamp func() string, reload func(ctx context.Context) error, expiry func(ctx context.Context)) {
+	if opts.interval <= 0 {
+		return
+	}
+	var (
+		t     = time.NewTicker(opts.interval)
+		last  = ""
+		check = time.Now()
+	)
+	defer t.Stop()
+	if stamp != nil {
+		last = stamp()
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-t.C:
+			cur := ""
+			if stamp != nil {
+				cur = stamp()
+			}
+			if stamp == nil || cur != last {
+				if reload(ctx) == nil {
+					last = cur
+				}
+			}
+			// 每小时检查一次有效期
+			if time.Since(check) >= time.Hour {
+				check = time.Now()
+				expiry(ctx)
+			}
+		}
+	}
+}
+
+func checkCertExpiry(ctx context.Context, logger logx.ILogger, warning time.Duration, cert *x509.Certificate) {
+	left := time.Until(cert.NotAfter)
+	switch {
+	case left <= 0:
+		logger.Errorw(ctx, "cert: certificate expired", "subject", cert.Subject.String(), "notAfter", cert.NotAfter.Format(time.RFC3339))
+
+	case left <= warning:
+		logger.Warnw(ctx, "cert: certificate expiring soon", "subject", cert.Subject.String(), "notAfter", cert.NotAfter.Format(time.RFC3339), "left", left.Round(time.Minute).String())
+	}
+}
+
+// fileStamp 文件大小及修改时间
+func fileStamp(files ...string) string {
+	stamp := ""
+	for _, f := range files {
+		fi, err := os.Stat(f)
+		if err != nil {
+			stamp += "-;"
+			continue
+		}
+		stamp += fmt.Sprintf("%d-%d;", fi.Size(), fi.ModTime().UnixNano())
+	}
+	return stamp
+}
@@ -0,0 +1,178 @@
+package netx
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/advancevillage/3rd/logx"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeTestCert 生成自签名证书
+func writeTestCert(t *testing.T, crt, key string, serial int64) {
+	pk, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	tpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: "3rd"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &pk.PublicKey, pk)
+	assert.Nil(t, err)
+	kder, err := x509.MarshalECPrivateKey(pk)
+	assert.Nil(t, err)
+	assert.Nil(t, os.WriteFile(crt, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	assert.Nil(t, os.WriteFile(key, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: kder}), 0o600))
+}
+
+func Test_cert_reload(t *testing.T) {
+	logger, err := logx.NewLogger("debug")
+	assert.Nil(t, err)
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	var (
+		dir  = t.TempDir()
+		crt  = filepath.Join(dir, "cert.pem")
+		key  = filepath.Join(dir, "privkey.pem")
+		opts = []CertOption{WithCertInterval(20 * time.Millisecond), WithCertExpiryWarning(48 * time.Hour)}
+	)
+	writeTestCert(t, crt, key, 1)
+
+	certs, err := NewFileCertProvider(ctx, logger, crt, key, opts...)
+	assert.Nil(t, err)
+	trust, err := NewFileTrustProvider(ctx, logger, crt, opts...)
+	assert.Nil(t, err)
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	// StartTLS会注入内置证书, 直接包装监听器
+	srv.Listener = tls.NewListener(srv.Listener, &tls.Config{GetCertificate: certs.GetCertificate})
+	srv.Start()
+	defer srv.Close()
+	url := strings.Replace(srv.URL, "http://", "https://", 1)
+
+	do := func() error {
+		// 每次新建连接以触发握手
+		c := &http.Client{Transport: &http.Transport{TLSClientConfig: newClientTLSConfig(trust, "")}}
+		reply, err := c.Get(url)
+		if err != nil {
+			return err
+		}
+		reply.Body.Close()
+		return nil
+	}
+
+	t.Run("case-initial", func(t *testing.T) {
+		cert, err := certs.GetCertificate(nil)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(1), cert.Leaf.SerialNumber.Int64())
+		assert.Nil(t, do())
+	})
+
+	t.Run("case-rotate", func(t *testing.T) {
+		writeTestCert(t, crt, key, 2)
+		assert.Eventually(t, func() bool {
+			cert, _ := certs.GetCertificate(nil)
+			return cert.Leaf.SerialNumber.Int64() == 2
+		}, time.Second, 10*time.Millisecond)
+		assert.Eventually(t, func() bool { return do() == nil }, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("case-broken", func(t *testing.T) {
+		// 加载失败保留旧证书
+		assert.Nil(t, os.WriteFile(key, []byte("broken"), 0o600))
+		time.Sleep(100 * time.Millisecond)
+		cert, err := certs.GetCertificate(nil)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(2), cert.Leaf.SerialNumber.Int64())
+	})
+
+	t.Run("case-untrusted", func(t *testing.T) {
+		writeTestCert(t, filepath.Join(dir, "other.pem"), filepath.Join(dir, "other.key"), 3)
+		other, err := NewFileTrustProvider(ctx, logger, filepath.Join(dir, "other.pem"), opts...)
+		assert.Nil(t, err)
+		c := &http.Client{Transport: &http.Transport{TLSClientConfig: newClientTLSConfig(other, "")}}
+		_, err = c.Get(url)
+		assert.NotNil(t, err)
+	})
+}
+
+func Test_cert_server_tls(t *testing.T) {
+	logger, err := logx.NewLogger("debug")
+	assert.Nil(t, err)
+
+	var (
+		dir = t.TempDir()
+		crt = filepath.Join(dir, "cert.pem")
+		key = filepath.Join(dir, "privkey.pem")
+	)
+	writeTestCert(t, crt, key, 1)
+
+	var data = map[string]struct {
+		opts []ServerOption
+		tls  bool
+	}{
+		"case-credential": {
+			opts: []ServerOption{WithServerCredential(crt, key)},
+			tls:  false,
+		},
+		"case-tls": {
+			opts: []ServerOption{WithServerCredential(crt, key), WithServerTLS()},
+			tls:  true,
+		},
+	}
+	for n, v := range data {
+		f := func(t *testing.T) {
+			s, err := newHttpSrv(context.TODO(), logger, v.opts...)
+			assert.Nil(t, err)
+			assert.Equal(t, v.tls, s.certs != nil)
+		}
+		t.Run(n, f)
+	}
+}
+
+func Test_cert_no_polling(t *testing.T) {
+	logger, err := logx.NewLogger("debug")
+	assert.Nil(t, err)
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	var (
+		dir = t.TempDir()
+		crt = filepath.Join(dir, "cert.pem")
+		key = filepath.Join(dir, "privkey.pem")
+	)
+	writeTestCert(t, crt, key, 1)
+
+	// 间隔为0时只加载一次
+	certs, err := NewFileCertProvider(ctx, logger, crt, key, WithCertInterval(0))
+	assert.Nil(t, err)
+	writeTestCert(t, crt, key, 2)
+	time.Sleep(50 * time.Millisecond)
+	cert, err := certs.GetCertificate(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), cert.Leaf.SerialNumber.Int64())
+}
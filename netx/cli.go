@@ -5,6 +5,7 @@ import (
 	"net/http"
 
 	"github.com/advancevillage/3rd/logx"
+	"github.com/advancevillage/3rd/tracex"
 	"github.com/advancevillage/3rd/x"
 	"google.golang.org/grpc"
 )
@@ -57,12 +58,48 @@ func WithClientCredential(crt, domain string) ClientOption {
 	})
 }
 
+// WithClientTrustProvider 使用信任证书提供者, 支持信任证书热更新
+func WithClientTrustProvider(p TrustProvider) ClientOption {
+	return newFuncOption(func(o *clientOptions) {
+		o.trust = p
+	})
+}
+
 func WithClientProxy(proxy string) ClientOption {
 	return newFuncOption(func(o *clientOptions) {
 		o.proxy = proxy
 	})
 }
 
+// WithClientRegistry 通过注册中心发现服务, 配合 registry:///service-name 使用
+// http客户端首次访问服务时订阅变化, 订阅在创建客户端的ctx取消后结束
+func WithClientRegistry(reg Registry) ClientOption {
+	return newFuncOption(func(o *clientOptions) {
+		o.registry = reg
+	})
+}
+
+// WithClientTarget gRPC拨号地址, 优先于WithClientAddr, 例如 registry:///service-name
+func WithClientTarget(target string) ClientOption {
+	return newFuncOption(func(o *clientOptions) {
+		o.target = target
+	})
+}
+
+// WithClientBalancer gRPC客户端负载均衡策略 round_robin/pick_first
+func WithClientBalancer(balancer string) ClientOption {
+	return newFuncOption(func(o *clientOptions) {
+		o.balancer = balancer
+	})
+}
+
+// WithClientTracer 为每个请求创建客户端span, 未设置时仍透传上下文中的traceparent
+func WithClientTracer(t tracex.Tracer) ClientOption {
+	return newFuncOption(func(o *clientOptions) {
+		o.tracer = t
+	})
+}
+
 type clientOptions struct {
 	hdr     map[string]interface{} // 请求头
 	host    string                 // 服务地址
@@ -71,6 +108,14 @@ type clientOptions struct {
 	domain  string                 // 域名
 	timeout int                    // 超时时间 秒
 	proxy   string                 // 代理地址
+
+	registry Registry // 注册中心
+	target   string   // 拨号地址
+	balancer string   // 负载均衡
+
+	trust TrustProvider // 信任证书
+
+	tracer tracex.Tracer // 链路追踪
 }
 
 var defaultClientOptions = clientOptions{
@@ -80,4 +125,6 @@ var defaultClientOptions = clientOptions{
 	crt:     "cert.pem",
 	domain:  "api.softpart.cn",
 	timeout: 3,
+
+	balancer: "round_robin",
 }
@@ -0,0 +1,322 @@
+package netx
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ugorji/go/codec"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	MIMEJSON     = "application/json"
+	MIMEProtobuf = "application/x-protobuf"
+	MIMEMsgPack  = "application/x-msgpack"
+)
+
+var ErrCodecUnsupported = errors.New("codec: unsupported type")
+
+// Codec 请求体/响应体编解码器, 通过Content-Type/Accept选择
+type Codec interface {
+	ContentType() string
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+type codecRegistry struct {
+	mu     sync.RWMutex
+	codecs map[string]Codec
+}
+
+var codecs = &codecRegistry{codecs: make(map[string]Codec)}
+
+func init() {
+	RegisterCodec(jsonCodec{})
+	RegisterCodec(protoCodec{}, "application/protobuf")
+	RegisterCodec(msgpackCodec{}, "application/msgpack")
+}
+
+// RegisterCodec 注册编解码器, alias为同一编解码器的其他媒体类型
+func RegisterCodec(c Codec, alias ...string) {
+	codecs.mu.Lock()
+	defer codecs.mu.Unlock()
+	for _, ct := range append([]string{c.ContentType()}, alias...) {
+		codecs.codecs[strings.ToLower(ct)] = c
+	}
+}
+
+// GetCodec 按媒体类型查找编解码器, 忽略参数(如charset)
+func GetCodec(contentType string) (Codec, bool) {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, false
+	}
+	codecs.mu.RLock()
+	defer codecs.mu.RUnlock()
+	c, ok := codecs.codecs[mt]
+	return c, ok
+}
+
+// NegotiateCodec 按Accept的q值顺序选择编解码器, 无匹配时使用JSON
+func NegotiateCodec(accept string) Codec {
+	type acceptRange struct {
+		mt string
+		q  float64
+	}
+	var ranges []acceptRange
+	for _, part := range strings.Split(accept, ",") {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			q, err = strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+		ranges = append(ranges, acceptRange{mt: mt, q: q})
+	}
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].q > ranges[j].q })
+
+	codecs.mu.RLock()
+	defer codecs.mu.RUnlock()
+	for _, r := range ranges {
+		if c, ok := codecs.codecs[r.mt]; ok {
+			return c
+		}
+		if r.mt == "*/*" || r.mt == "application/*" {
+			break
+		}
+	}
+	return codecs.codecs[MIMEJSON]
+}
+
+var _ Codec = jsonCodec{}
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string { return MIMEJSON }
+
+func (jsonCodec) Marshal(v any) ([]byte, error) { return json.Marshal(v) }
+
+func (jsonCodec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+
+var _ Codec = msgpackCodec{}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) ContentType() string { return MIMEMsgPack }
+
+func (msgpackCodec) handle() *codec.MsgpackHandle {
+	h := &codec.MsgpackHandle{WriteExt: true}
+	h.RawToString = true
+	return h
+}
+
+func (c msgpackCodec) Marshal(v any) ([]byte, error) {
+	var buf []byte
+	err := codec.NewEncoderBytes(&buf, c.handle()).Encode(v)
+	return buf, err
+}
+
+func (c msgpackCodec) Unmarshal(data []byte, v any) error {
+	return codec.NewDecoderBytes(data, c.handle()).Decode(v)
+}
+
+var _ Codec = protoCodec{}
+
+// protoCodec 编码proto.Message; 响应信封按以下结构编码, data为业务消息的序列化结果
+//
+//	message Envelope {
+//	  int32 code = 1;
+//	  string message = 2;
+//	  bytes data = 3;
+//	  repeated string errors = 4;
+//	}
+type protoCodec struct{}
+
+func (protoCodec) ContentType() string { return MIMEProtobuf }
+
+func (protoCodec) Marshal(v any) ([]byte, error) {
+	switch m := v.(type) {
+	case proto.Message:
+		return proto.Marshal(m)
+
+	case *Envelope:
+		var b []byte
+		if m.Code != 0 {
+			b = protowire.AppendTag(b, 1, protowire.VarintType)
+			b = protowire.AppendVarint(b, uint64(int32(m.Code)))
+		}
+		if len(m.Message) > 0 {
+			b = protowire.AppendTag(b, 2, protowire.BytesType)
+			b = protowire.AppendString(b, m.Message)
+		}
+		if m.Data != nil {
+			pm, ok := m.Data.(proto.Message)
+			if !ok {
+				return nil, fmt.Errorf("%w: %T", ErrCodecUnsupported, m.Data)
+			}
+			data, err := proto.Marshal(pm)
+			if err != nil {
+				return nil, err
+			}
+			b = protowire.AppendTag(b, 3, protowire.BytesType)
+			b = protowire.AppendBytes(b, data)
+		}
+		for _, e := range m.Errors {
+			b = protowire.AppendTag(b, 4, protowire.BytesType)
+			b = protowire.AppendString(b, e)
+		}
+		return b, nil
+
+	default:
+		return nil, fmt.Errorf("%w: %T", ErrCodecUnsupported, v)
+	}
+}
+
+func (protoCodec) Unmarshal(data []byte, v any) error {
+	switch m := v.(type) {
+	case proto.Message:
+		return proto.Unmarshal(data, m)
+
+	case *Envelope:
+		for len(data) > 0 {
+			num, typ, n := protowire.ConsumeTag(data)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			data = data[n:]
+			switch {
+			case num == 1 && typ == protowire.VarintType:
+				u, n := protowire.ConsumeVarint(data)
+				if n < 0 {
+					return protowire.ParseError(n)
+				}
+				m.Code, data = int(int32(u)), data[n:]
+
+			case num == 2 && typ == protowire.BytesType:
+				s, n := protowire.ConsumeString(data)
+				if n < 0 {
+					return protowire.ParseError(n)
+				}
+				m.Message, data = s, data[n:]
+
+			case num == 3 && typ == protowire.BytesType:
+				b, n := protowire.ConsumeBytes(data)
+				if n < 0 {
+					return protowire.ParseError(n)
+				}
+				data = data[n:]
+				if pm, ok := m.Data.(proto.Message); ok {
+					err := proto.Unmarshal(b, pm)
+					if err != nil {
+						return err
+					}
+				} else {
+					m.Data = append([]byte(nil), b...)
+				}
+
+			case num == 4 && typ == protowire.BytesType:
+				s, n := protowire.ConsumeString(data)
+				if n < 0 {
+					return protowire.ParseError(n)
+				}
+				m.Errors, data = append(m.Errors, s), data[n:]
+
+			default:
+				n := protowire.ConsumeFieldValue(num, typ, data)
+				if n < 0 {
+					return protowire.ParseError(n)
+				}
+				data = data[n:]
+			}
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("%w: %T", ErrCodecUnsupported, v)
+	}
+}
+
+// Envelope 统一响应结构 {code,message,data,errors}
+type Envelope struct {
+	Code    int      `json:"code"`
+	Message string   `json:"message"`
+	Data    any      `json:"data,omitempty"`
+	Errors  []string `json:"errors,omitempty"`
+}
+
+// HttpEncoder 响应实现该接口时, 按请求Accept协商编码
+type HttpEncoder interface {
+	Encode(accept string) (contentType string, body []byte, err error)
+}
+
+var (
+	_ HttpResponse = (*envelopeHttpResponse)(nil)
+	_ HttpEncoder  = (*envelopeHttpResponse)(nil)
+)
+
+type envelopeHttpResponse struct {
+	env        *Envelope
+	body       []byte // 默认JSON编码
+	header     http.Header
+	statusCode int
+}
+
+func newEnvelopeHttpResponse(env *Envelope, header http.Header, statusCode int) (*envelopeHttpResponse, error) {
+	body, err := json.Marshal(env)
+	if err != nil {
+		return nil, err
+	}
+	if header == nil {
+		header = http.Header{}
+	}
+	return &envelopeHttpResponse{
+		env:        env,
+		body:       body,
+		header:     header,
+		statusCode: statusCode,
+	}, nil
+}
+
+func (c *envelopeHttpResponse) Body() []byte {
+	return c.body
+}
+
+func (c *envelopeHttpResponse) Header() http.Header {
+	return c.header
+}
+
+func (c *envelopeHttpResponse) StatusCode() int {
+	return c.statusCode
+}
+
+func (c *envelopeHttpResponse) Encode(accept string) (string, []byte, error) {
+	cc := NegotiateCodec(accept)
+	if cc.ContentType() == MIMEJSON {
+		return MIMEJSON, c.body, nil
+	}
+	buf, err := cc.Marshal(c.env)
+	// 数据无法按协商类型编码时回退JSON
+	if errors.Is(err, ErrCodecUnsupported) {
+		return MIMEJSON, c.body, nil
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	return cc.ContentType(), buf, nil
+}
@@ -0,0 +1,116 @@
+package netx
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/advancevillage/3rd/logx"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_negotiate(t *testing.T) {
+	var data = map[string]struct {
+		accept string
+		exp    string
+	}{
+		"case-empty":    {accept: "", exp: MIMEJSON},
+		"case-any":      {accept: "*/*", exp: MIMEJSON},
+		"case-protobuf": {accept: "application/x-protobuf", exp: MIMEProtobuf},
+		"case-alias":    {accept: "application/msgpack", exp: MIMEMsgPack},
+		"case-q":        {accept: "application/json;q=0.5, application/x-msgpack;q=0.9", exp: MIMEMsgPack},
+		"case-unknown":  {accept: "text/html", exp: MIMEJSON},
+	}
+	for n, v := range data {
+		f := func(t *testing.T) {
+			assert.Equal(t, v.exp, NegotiateCodec(v.accept).ContentType())
+		}
+		t.Run(n, f)
+	}
+}
+
+func Test_codec(t *testing.T) {
+	logger, err := logx.NewLogger("debug")
+	assert.Nil(t, err)
+
+	type Account struct {
+		Name string `json:"name"`
+		Age  int    `json:"age"`
+	}
+
+	s, err := newHttpSrv(context.TODO(), logger,
+		WithHttpService(http.MethodPost, "/account", func(ctx context.Context, r *http.Request) (HttpResponse, error) {
+			act := &Account{}
+			err := ShouldBind(r, act)
+			if err != nil {
+				return NewBadRequestHttpResponse(err), nil
+			}
+			return NewStatusOkHttpResponse(act, http.Header{}), nil
+		}),
+		WithHttpService(http.MethodGet, "/ping", func(ctx context.Context, r *http.Request) (HttpResponse, error) {
+			return NewStatusOkHttpResponse(&PingReply{T: 1995}, http.Header{}), nil
+		}),
+	)
+	assert.Nil(t, err)
+
+	t.Run("case-msgpack", func(t *testing.T) {
+		c, ok := GetCodec(MIMEMsgPack)
+		assert.True(t, ok)
+		body, err := c.Marshal(&Account{Name: "pyro", Age: 3})
+		assert.Nil(t, err)
+
+		req := httptest.NewRequest(http.MethodPost, "/account", bytes.NewReader(body))
+		req.Header.Set("Content-Type", MIMEMsgPack)
+		req.Header.Set("Accept", MIMEMsgPack)
+		rec := httptest.NewRecorder()
+		s.srv.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, MIMEMsgPack, rec.Header().Get("Content-Type"))
+
+		reply := &Envelope{Data: &Account{}}
+		err = c.Unmarshal(rec.Body.Bytes(), reply)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, reply.Code)
+		assert.Equal(t, &Account{Name: "pyro", Age: 3}, reply.Data)
+	})
+
+	t.Run("case-protobuf", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+		req.Header.Set("Accept", MIMEProtobuf)
+		rec := httptest.NewRecorder()
+		s.srv.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, MIMEProtobuf, rec.Header().Get("Content-Type"))
+
+		c, ok := GetCodec(MIMEProtobuf)
+		assert.True(t, ok)
+		reply := &Envelope{Data: &PingReply{}}
+		err = c.Unmarshal(rec.Body.Bytes(), reply)
+		assert.Nil(t, err)
+		assert.Equal(t, "success", reply.Message)
+		assert.Equal(t, int64(1995), reply.Data.(*PingReply).T)
+	})
+
+	t.Run("case-protobuf-unsupported", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/account", bytes.NewReader([]byte(`{"name":"pyro"}`)))
+		req.Header.Set("Content-Type", MIMEJSON)
+		req.Header.Set("Accept", MIMEProtobuf)
+		rec := httptest.NewRecorder()
+		s.srv.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, MIMEJSON, rec.Header().Get("Content-Type"))
+		assert.Equal(t, "Accept", rec.Header().Get("Vary"))
+		assert.JSONEq(t, `{"code":200,"message":"success","data":{"name":"pyro","age":0}}`, rec.Body.String())
+	})
+
+	t.Run("case-json", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/account", bytes.NewReader([]byte(`{"name":"pyro","age":3}`)))
+		req.Header.Set("Content-Type", MIMEJSON)
+		rec := httptest.NewRecorder()
+		s.srv.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"code":200,"message":"success","data":{"name":"pyro","age":3}}`, rec.Body.String())
+	})
+}
@@ -29,11 +29,18 @@ func newGrpcCli(ctx context.Context, logger logx.ILogger, opt ...ClientOption) (
 	c := &grpcCli{logger: logger, opts: opts}
 
 	// 1. 安全凭证
-	creds, err := credentials.NewClientTLSFromFile(c.opts.crt, c.opts.domain)
-	if err != nil {
-		c.logger.Errorw(ctx, "read cert file failed", "err", err, "crt", c.opts.crt, "domain", c.opts.domain)
-		return nil, err
+	var (
+		trust = c.opts.trust
+		err   error
+	)
+	if trust == nil {
+		trust, err = NewFileTrustProvider(ctx, logger, c.opts.crt)
+		if err != nil {
+			c.logger.Errorw(ctx, "read cert file failed", "err", err, "crt", c.opts.crt, "domain", c.opts.domain)
+			return nil, err
+		}
 	}
+	creds := credentials.NewTLS(newClientTLSConfig(trust, c.opts.domain))
 
 	ka := keepalive.ClientParameters{
 		Time:                10 * time.Second, // 多久发一次心跳 ping
@@ -41,14 +48,33 @@ func newGrpcCli(ctx context.Context, logger logx.ILogger, opt ...ClientOption) (
 		PermitWithoutStream: true,             // 即使没有 RPC 也发心跳
 	}
 
-	// 2. 连接拨号
-	c.conn, err = grpc.NewClient(fmt.Sprintf("%s:%d", c.opts.host, c.opts.port),
-		grpc.WithTransportCredentials(creds),
-		grpc.WithKeepaliveParams(ka),
-		grpc.WithAuthority(c.opts.domain),
+	// 2. 拨号参数
+	var (
+		target = c.opts.target
+		dopts  = []grpc.DialOption{
+			grpc.WithTransportCredentials(creds),
+			grpc.WithKeepaliveParams(ka),
+			grpc.WithAuthority(c.opts.domain),
+			grpc.WithChainUnaryInterceptor(newGrpcClientUnaryInterceptor(c.opts.tracer)),
+			grpc.WithChainStreamInterceptor(newGrpcClientStreamInterceptor(c.opts.tracer)),
+		}
 	)
+	if len(target) <= 0 {
+		target = fmt.Sprintf("%s:%d", c.opts.host, c.opts.port)
+	}
+
+	// 3. 服务发现
+	if c.opts.registry != nil {
+		dopts = append(dopts,
+			grpc.WithResolvers(newRegistryResolverBuilder(c.opts.registry, c.logger)),
+			grpc.WithDefaultServiceConfig(fmt.Sprintf(`{"loadBalancingConfig":[{"%s":{}}]}`, c.opts.balancer)),
+		)
+	}
+
+	// 4. 连接拨号
+	c.conn, err = grpc.NewClient(target, dopts...)
 	if err != nil {
-		c.logger.Errorw(ctx, "grpc dial failed", "err", err, "host", c.opts.host, "port", c.opts.port)
+		c.logger.Errorw(ctx, "grpc dial failed", "err", err, "target", target)
 		return nil, err
 	}
 
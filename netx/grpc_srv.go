@@ -2,6 +2,7 @@ package netx
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"net"
 	"time"
@@ -37,11 +38,11 @@ func newGrpcSrv(ctx context.Context, logger logx.ILogger, opt ...ServerOption) (
 	s.rctx, s.rcancel = context.WithCancel(ctx)
 
 	// 3. 安全凭证
-	creds, err := credentials.NewServerTLSFromFile(s.opts.crt, s.opts.key)
+	certs, err := newServerCertProvider(s.rctx, s.logger, s.opts)
 	if err != nil {
-		s.logger.Errorw(s.rctx, "read cert file failed", "err", err, "crt", s.opts.crt, "key", s.opts.key)
 		return nil, err
 	}
+	creds := credentials.NewTLS(&tls.Config{GetCertificate: certs.GetCertificate})
 
 	// 4. 构建服务
 	kaep := keepalive.EnforcementPolicy{
@@ -61,6 +62,8 @@ func newGrpcSrv(ctx context.Context, logger logx.ILogger, opt ...ServerOption) (
 		grpc.Creds(creds),
 		grpc.KeepaliveParams(kasp),
 		grpc.KeepaliveEnforcementPolicy(kaep),
+		grpc.ChainUnaryInterceptor(newGrpcServerUnaryInterceptor(s.opts.tracer)),
+		grpc.ChainStreamInterceptor(newGrpcServerStreamInterceptor(s.opts.tracer)),
 	)
 
 	// 5. 注册服务
@@ -74,10 +77,14 @@ func newGrpcSrv(ctx context.Context, logger logx.ILogger, opt ...ServerOption) (
 func (s *grpcSrv) Start() {
 	go s.start()
 	go waitQuitSignal(s.rcancel)
+	deregister := selfRegister(s.rctx, s.logger, s.opts, "grpc")
 	<-s.rctx.Done()
+	deregister()
 	s.logger.Infow(s.rctx, "grpc server closed", "host", s.opts.host, "port", s.opts.port)
 	s.srv.GracefulStop()
-	time.Sleep(time.Second)
+
+	// 写完缓冲中的日志, 日志可能被多个服务共享, 由创建者关闭
+	s.logger.Sync()
 }
 
 func (s *grpcSrv) start() {
@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"context"
 	"encoding/hex"
-	"encoding/json"
 	"fmt"
 	"io"
 	"mime/multipart"
@@ -14,6 +13,7 @@ import (
 	"time"
 
 	"github.com/advancevillage/3rd/logx"
+	"github.com/advancevillage/3rd/tracex"
 	"github.com/advancevillage/3rd/x"
 )
 
@@ -43,26 +43,44 @@ func NewNotFoundHttpResponse(err error) HttpResponse {
 	return newCodeHttpResponse(http.StatusNotFound, "not found", err)
 }
 
+func NewMethodNotAllowedHttpResponse(err error) HttpResponse {
+	return newCodeHttpResponse(http.StatusMethodNotAllowed, "method not allowed", err)
+}
+
+func NewConflictHttpResponse(err error) HttpResponse {
+	return newCodeHttpResponse(http.StatusConflict, "conflict", err)
+}
+
+func NewUnprocessableEntityHttpResponse(err error) HttpResponse {
+	return newCodeHttpResponse(http.StatusUnprocessableEntity, "unprocessable entity", err)
+}
+
 func NewInternalServerErrorHttpResponse(err error) HttpResponse {
 	return newCodeHttpResponse(http.StatusInternalServerError, "internal server error", err)
 }
 
+func NewBadGatewayHttpResponse(err error) HttpResponse {
+	return newCodeHttpResponse(http.StatusBadGateway, "bad gateway", err)
+}
+
+func NewServiceUnavailableHttpResponse(err error) HttpResponse {
+	return newCodeHttpResponse(http.StatusServiceUnavailable, "service unavailable", err)
+}
+
 func NewStatusOkHttpResponse(body any, hdr http.Header) HttpResponse {
-	b := x.NewBuilder(x.WithKV("code", http.StatusOK), x.WithKV("message", "success"), x.WithKV("data", body))
-	buf, err := json.Marshal(b.Build())
+	r, err := newEnvelopeHttpResponse(&Envelope{Code: http.StatusOK, Message: "success", Data: body}, hdr, http.StatusOK)
 	if err != nil {
 		return NewInternalServerErrorHttpResponse(err)
 	}
-	return newHttpResponse(buf, hdr, http.StatusOK)
+	return r
 }
 
 func newCodeHttpResponse(code int, message string, err error) HttpResponse {
-	b := x.NewBuilder(x.WithKV("code", code), x.WithKV("message", message), x.WithKV("errors", []any{err.Error()}))
-	body, err := json.Marshal(b.Build())
+	r, err := newEnvelopeHttpResponse(&Envelope{Code: code, Message: message, Errors: []string{err.Error()}}, http.Header{}, code)
 	if err != nil {
 		return NewEmptyResonse()
 	}
-	return newHttpResponse(body, http.Header{}, code)
+	return r
 }
 
 var _ HttpResponse = (*emptyHttpResponse)(nil)
@@ -151,6 +169,7 @@ var _ HttpClient = (*httpCli)(nil)
 type httpCli struct {
 	opts   clientOptions
 	logger logx.ILogger
+	picker *registryPicker
 }
 
 func newHttpClient(ctx context.Context, logger logx.ILogger, opt ...ClientOption) (*httpCli, error) {
@@ -158,7 +177,7 @@ func newHttpClient(ctx context.Context, logger logx.ILogger, opt ...ClientOption
 	for _, o := range opt {
 		o.apply(&opts)
 	}
-	return &httpCli{opts: opts, logger: logger}, nil
+	return &httpCli{opts: opts, logger: logger, picker: newRegistryPicker(ctx, logger, opts.registry)}, nil
 }
 
 func (c *httpCli) Get(ctx context.Context, uri string, params x.Builder, headers x.Builder) (HttpResponse, error) {
@@ -172,6 +191,10 @@ func (c *httpCli) Get(ctx context.Context, uri string, params x.Builder, headers
 		hdr      = headers.Build()
 	)
 	// 2. 构造请求
+	uri, err = c.picker.resolve(uri)
+	if err != nil {
+		return nil, err
+	}
 	request, err = http.NewRequest(http.MethodGet, uri, nil)
 	if err != nil {
 		return nil, err
@@ -194,7 +217,7 @@ func (c *httpCli) Get(ctx context.Context, uri string, params x.Builder, headers
 		}
 	}
 	// 5. 发送HTTP请求
-	response, err = client.Do(request)
+	response, err = c.do(ctx, client, request)
 	if err != nil {
 		return nil, err
 	}
@@ -218,6 +241,10 @@ func (c *httpCli) Post(ctx context.Context, uri string, headers x.Builder, buf [
 		hdr      = headers.Build()
 	)
 	// 2. 构造请求
+	uri, err = c.picker.resolve(uri)
+	if err != nil {
+		return nil, err
+	}
 	request, err = http.NewRequest(http.MethodPost, uri, bytes.NewReader(buf))
 	if err != nil {
 		return nil, err
@@ -234,7 +261,7 @@ func (c *httpCli) Post(ctx context.Context, uri string, headers x.Builder, buf [
 		}
 	}
 	// 4. 发送HTTP请求
-	response, err = client.Do(request)
+	response, err = c.do(ctx, client, request)
 	if err != nil {
 		return nil, err
 	}
@@ -260,6 +287,10 @@ func (c *httpCli) PostForm(ctx context.Context, uri string, params x.Builder, he
 		hdr      = headers.Build()
 	)
 	// 2. 创建请求
+	uri, err = c.picker.resolve(uri)
+	if err != nil {
+		return nil, err
+	}
 	request, err = http.NewRequest(http.MethodPost, uri, nil)
 	if err != nil {
 		return nil, err
@@ -281,7 +312,7 @@ func (c *httpCli) PostForm(ctx context.Context, uri string, params x.Builder, he
 		}
 	}
 	// 5. 发送HTTP请求
-	response, err = client.Do(request)
+	response, err = c.do(ctx, client, request)
 	if err != nil {
 		return nil, err
 	}
@@ -334,6 +365,10 @@ func (c *httpCli) Upload(ctx context.Context, uri string, params x.Builder, head
 		return nil, err
 	}
 	// 5. 构建请求
+	uri, err = c.picker.resolve(uri)
+	if err != nil {
+		return nil, err
+	}
 	request, err = http.NewRequest(http.MethodPost, uri, body)
 	if err != nil {
 		return nil, err
@@ -351,7 +386,7 @@ func (c *httpCli) Upload(ctx context.Context, uri string, params x.Builder, head
 		}
 	}
 	// 7. 发送请求
-	response, err = client.Do(request)
+	response, err = c.do(ctx, client, request)
 	if err != nil {
 		return nil, err
 	}
@@ -379,11 +414,44 @@ func (c *httpCli) proxy(ctx context.Context) *http.Transport {
 	return &http.Transport{Proxy: http.ProxyURL(proxy)}
 }
 
+// do 发送请求, 透传traceparent, 设置tracer时记录客户端span
+func (c *httpCli) do(ctx context.Context, client *http.Client, request *http.Request) (*http.Response, error) {
+	var span tracex.Span
+	if c.opts.tracer != nil {
+		ctx, span = c.opts.tracer.Start(ctx, request.Method+" "+request.URL.Path,
+			tracex.WithSpanKind(tracex.SpanKindClient),
+			tracex.WithSpanAttributes("http.method", request.Method, "http.url", request.URL.String()),
+		)
+		defer span.End()
+	}
+	tracex.Inject(ctx, tracex.HeaderCarrier(request.Header))
+	response, err := client.Do(request)
+	if span != nil {
+		switch {
+		case err != nil:
+			span.RecordError(err)
+		case response.StatusCode >= http.StatusInternalServerError:
+			span.SetAttributes("http.status_code", response.StatusCode)
+			span.SetStatus(tracex.StatusError, http.StatusText(response.StatusCode))
+		default:
+			span.SetAttributes("http.status_code", response.StatusCode)
+		}
+	}
+	return response, err
+}
+
 func (c *httpCli) buildClient(ctx context.Context) *http.Client {
 	client := &http.Client{Timeout: time.Second * time.Duration(c.opts.timeout)}
 	proxy := c.proxy(ctx)
 	if proxy != nil {
 		client.Transport = proxy
 	}
+	if c.opts.trust != nil {
+		if proxy == nil {
+			proxy = http.DefaultTransport.(*http.Transport).Clone()
+		}
+		proxy.TLSClientConfig = newClientTLSConfig(c.opts.trust, "")
+		client.Transport = proxy
+	}
 	return client
 }
@@ -2,8 +2,11 @@ package netx
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"io/fs"
 	"net/http"
 	"net/url"
 	"strings"
@@ -11,9 +14,13 @@ import (
 
 	"github.com/advancevillage/3rd/logx"
 	"github.com/advancevillage/3rd/mathx"
+	"github.com/advancevillage/3rd/tracex"
 	"github.com/gin-gonic/gin"
 )
 
+// httpShutdownTimeout 退出时等待处理中请求的最长时间
+const httpShutdownTimeout = 10 * time.Second
+
 type ctxKeyResponseWriter struct{}
 
 type httpRouter struct {
@@ -26,7 +33,9 @@ type httpSrv struct {
 	opts   serverOptions
 	logger logx.ILogger // 日志
 
-	srv     *gin.Engine        // https server
+	srv     *gin.Engine        // 路由
+	hs      *http.Server       // http server
+	certs   CertProvider       // 证书, 未启用TLS时为空
 	rctx    context.Context    // root context
 	rcancel context.CancelFunc // root cancel
 }
@@ -56,21 +65,64 @@ func newHttpSrv(ctx context.Context, logger logx.ILogger, opt ...ServerOption) (
 		s.route(r.method, r.path, r.handle...)
 	}
 
+	// 6. 静态资源
+	for _, r := range opts.fs {
+		s.static(r.prefix, r.fsys, r.opts...)
+	}
+
+	// 7. 安全凭证
+	if opts.tls {
+		certs, err := newServerCertProvider(s.rctx, s.logger, opts)
+		if err != nil {
+			return nil, err
+		}
+		s.certs = certs
+	}
+
+	// 8. 服务
+	s.hs = &http.Server{Addr: fmt.Sprintf("%s:%d", opts.host, opts.port), Handler: s.srv}
+	if s.certs != nil {
+		s.hs.TLSConfig = &tls.Config{GetCertificate: s.certs.GetCertificate}
+	}
+
 	return s, nil
 }
 
 func (s *httpSrv) Start() {
-	go s.start()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.start()
+	}()
 	go waitQuitSignal(s.rcancel)
+	deregister := selfRegister(s.rctx, s.logger, s.opts, "http")
 	<-s.rctx.Done()
+	deregister()
+
+	// 停止接收新请求, 等待处理中的请求结束, 超时后强制关闭连接
+	ctx, cancel := context.WithTimeout(context.Background(), httpShutdownTimeout)
+	defer cancel()
+	err := s.hs.Shutdown(ctx)
+	if err != nil {
+		s.logger.Warnw(s.rctx, "http server shutdown timeout", "err", err, "host", s.opts.host, "port", s.opts.port)
+		s.hs.Close()
+	}
+	<-done
 	s.logger.Infow(s.rctx, "http server closed", "host", s.opts.host, "port", s.opts.port)
-	time.Sleep(time.Second)
+
+	// 写完缓冲中的日志, 日志可能被多个服务共享, 由创建者关闭
+	s.logger.Sync()
 }
 
 func (s *httpSrv) start() {
 	s.logger.Infow(s.rctx, "https server start", "host", s.opts.host, "port", s.opts.port)
-	err := s.srv.Run(fmt.Sprintf("%s:%d", s.opts.host, s.opts.port))
-	if err != nil {
+	var err error
+	if s.certs != nil {
+		err = s.hs.ListenAndServeTLS("", "")
+	} else {
+		err = s.hs.ListenAndServe()
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
 		s.logger.Errorw(s.rctx, "https server failed", "err", err, "host", s.opts.host, "port", s.opts.port)
 	}
 }
@@ -93,41 +145,50 @@ func (s *httpSrv) route(method, path string, f ...HttpRegister) {
 			if err != nil {
 				c.Abort()
 				r = NewInternalServerErrorHttpResponse(err)
-				c.Data(r.StatusCode(), "application/json", r.Body())
+				c.Data(s.render(ctx, c, r))
 				return
 			}
-			// 3. 设置响应头
+			// 3. 设置响应头, 中间件的实体头只描述自身响应体, 不能带到最终响应
+			inner := idx < n-1 && r.StatusCode() == http.StatusOK
 			for k, v := range r.Header() {
 				switch {
 				case len(v) <= 0:
 					// pass
+				case inner && isEntityHeader(k):
+					// pass
 				case strings.HasPrefix(k, rEQUEXT_CTX):
 					s.updateRequestContext(c, strings.TrimLeft(k, rEQUEXT_CTX), strings.Join(v, ";"))
 
+				case k == "Set-Cookie":
+					// 多个cookie不能合并
+					for _, vv := range v {
+						c.Writer.Header().Add(k, vv)
+					}
+
 				default:
 					c.Header(k, strings.Join(v, ";"))
 				}
 			}
-			// 4. 提取Content-Type
-			ct := r.Header().Get("Content-Type")
-			if len(ct) <= 0 {
-				ct = "application/json"
-			}
+			// 4. 协商Content-Type
+			code, ct, body := s.render(ctx, c, r)
 			// 5. 设置耗时请求头
 			c.Header(X_Request_Latency, fmt.Sprintf("%dms", time.Now().UnixNano()/1e6-c.GetInt64(X_Request_Latency)))
 			// 6. 非200状态码
-			if r.StatusCode() != http.StatusOK {
+			if code != http.StatusOK {
 				c.Abort()
-				c.Data(r.StatusCode(), ct, r.Body())
+				s.write(ctx, c, r, code, ct, body)
 				return
 			}
 			// 7. 中间件执行
 			if idx < n-1 {
+				if st, ok := r.(*streamHttpResponse); ok {
+					st.close()
+				}
 				c.Next()
 				return
 			}
 			// 8. 设置响应
-			c.Data(r.StatusCode(), ct, r.Body())
+			s.write(ctx, c, r, code, ct, body)
 		}
 		fs = append(fs, hf)
 	}
@@ -138,12 +199,95 @@ func (s *httpSrv) route(method, path string, f ...HttpRegister) {
 	}
 }
 
+func (s *httpSrv) static(prefix string, fsys fs.FS, opt ...StaticOption) {
+	var (
+		h  = newStaticHandler(fsys, opt...)
+		hf = func(c *gin.Context) {
+			c.Header(X_Request_Latency, fmt.Sprintf("%dms", time.Now().UnixNano()/1e6-c.GetInt64(X_Request_Latency)))
+			h.serve(c.Writer, c.Request, c.Param("filepath"))
+		}
+	)
+	prefix = strings.TrimRight(prefix, "/")
+	// 根路径的通配路由与其他路由冲突, 由NoRoute承接
+	if len(prefix) <= 0 {
+		s.srv.NoRoute(func(c *gin.Context) {
+			c.Params = append(c.Params, gin.Param{Key: "filepath", Value: c.Request.URL.Path})
+			hf(c)
+		})
+		return
+	}
+	s.srv.GET(prefix+"/*filepath", hf)
+	s.srv.HEAD(prefix+"/*filepath", hf)
+}
+
+// isEntityHeader 描述响应体的头部
+func isEntityHeader(k string) bool {
+	switch http.CanonicalHeaderKey(k) {
+	case "Content-Length", "Content-Type", "Content-Encoding", "Content-Range",
+		"Content-Disposition", "Content-Language", "Content-Location", "Etag", "Last-Modified":
+		return true
+	default:
+		return false
+	}
+}
+
+// render 结构化响应按Accept协商编码, 其余响应沿用Content-Type
+func (s *httpSrv) render(ctx context.Context, c *gin.Context, r HttpResponse) (int, string, []byte) {
+	if e, ok := r.(HttpEncoder); ok {
+		c.Header("Vary", "Accept")
+		ct, body, err := e.Encode(c.GetHeader("Accept"))
+		if err == nil {
+			c.Header("Content-Type", ct)
+			return r.StatusCode(), ct, body
+		}
+		s.logger.Errorw(ctx, "encode response failed", "err", err, "accept", c.GetHeader("Accept"))
+		r = NewInternalServerErrorHttpResponse(err)
+		return r.StatusCode(), MIMEJSON, r.Body()
+	}
+	ct := r.Header().Get("Content-Type")
+	if _, ok := r.(HttpStreamer); ok && len(ct) <= 0 {
+		ct = "application/octet-stream"
+	}
+	if len(ct) <= 0 {
+		ct = MIMEJSON
+	}
+	return r.StatusCode(), ct, r.Body()
+}
+
+// write 流式响应先写出响应头再写入响应体, HEAD请求不写响应体
+func (s *httpSrv) write(ctx context.Context, c *gin.Context, r HttpResponse, code int, ct string, body []byte) {
+	st, ok := r.(HttpStreamer)
+	if !ok {
+		c.Data(code, ct, body)
+		return
+	}
+	c.Header("Content-Type", ct)
+	c.Status(code)
+	c.Writer.WriteHeaderNow()
+	if c.Request.Method == http.MethodHead {
+		if sr, ok := r.(*streamHttpResponse); ok {
+			sr.close()
+		}
+		return
+	}
+	err := st.Stream(ctx, c.Writer)
+	if err != nil {
+		s.logger.Warnw(ctx, "stream response interrupted", "err", err)
+	}
+}
+
 func (s *httpSrv) withTraceMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var (
 			rctx  = url.Values{}
+			ctx   = tracex.Extract(c.Request.Context(), tracex.HeaderCarrier(c.Request.Header))
 			trace = c.GetHeader(logx.TraceId)
+			span  tracex.Span
 		)
+		// 1. 未携带trace时沿用上游traceparent
+		if sc := tracex.SpanContextFromContext(ctx); len(trace) <= 0 && sc.IsValid() {
+			trace = sc.TraceId.String()
+		}
 		if len(trace) <= 0 {
 			trace = mathx.UUID()
 		}
@@ -152,7 +296,27 @@ func (s *httpSrv) withTraceMiddleware() gin.HandlerFunc {
 		rctx.Add(logx.MethodId, c.Request.Method)
 		c.Set(rEQUEXT_CTX, rctx.Encode())
 		c.Header(logx.TraceId, fmt.Sprint(trace))
+
+		// 2. 服务端span
+		ctx = logx.TraceKey.WithValue(ctx, trace)
+		if s.opts.tracer != nil {
+			ctx, span = s.opts.tracer.Start(ctx, c.Request.Method+" "+c.FullPath(),
+				tracex.WithSpanKind(tracex.SpanKindServer),
+				tracex.WithSpanAttributes("http.method", c.Request.Method, "http.target", c.Request.RequestURI, "http.route", c.FullPath()),
+			)
+		}
+		c.Request = c.Request.WithContext(ctx)
 		c.Next()
+
+		// 3. 结束span
+		if span != nil {
+			code := c.Writer.Status()
+			span.SetAttributes("http.status_code", code)
+			if code >= http.StatusInternalServerError {
+				span.SetStatus(tracex.StatusError, http.StatusText(code))
+			}
+			span.End()
+		}
 	}
 }
 
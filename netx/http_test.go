@@ -5,7 +5,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -81,7 +84,7 @@ func Test_http(t *testing.T) {
 	s, err := NewHttpServer(ctx, logger, opts...)
 	assert.Nil(t, err)
 	go s.Start()
-	time.Sleep(time.Second * 2)
+	time.Sleep(time.Millisecond * 500)
 
 	for n, v := range data {
 		f := func(t *testing.T) {
@@ -158,3 +161,64 @@ func Test_should(t *testing.T) {
 		t.Run(n, f)
 	}
 }
+
+func Test_http_shared_logger(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	logger, err := logx.NewLogger("debug", logx.WithoutStdout(), logx.WithFileOutput(path))
+	assert.Nil(t, err)
+	defer logger.Close()
+
+	// 1. 临时端口
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	port := l.Addr().(*net.TCPAddr).Port
+	assert.Nil(t, l.Close())
+
+	var (
+		ctx, cancel = context.WithCancel(context.TODO())
+		arrived     = make(chan struct{})
+		done        = make(chan struct{})
+	)
+	s, err := NewHttpServer(ctx, logger, WithServerAddr("127.0.0.1", port),
+		WithHttpService(http.MethodGet, "/slow", func(ctx context.Context, r *http.Request) (HttpResponse, error) {
+			close(arrived)
+			time.Sleep(200 * time.Millisecond)
+			logger.Infow(ctx, "in-flight-request-done")
+			return NewEmptyResonse(), nil
+		}))
+	assert.Nil(t, err)
+	go func() {
+		s.Start()
+		close(done)
+	}()
+
+	// 2. 处理中的请求在退出前完成
+	reply := make(chan int, 1)
+	go func() {
+		var rsp *http.Response
+		assert.Eventually(t, func() bool {
+			var err error
+			rsp, err = http.Get(fmt.Sprintf("http://127.0.0.1:%d/slow", port))
+			return err == nil
+		}, time.Second, 10*time.Millisecond)
+		rsp.Body.Close()
+		reply <- rsp.StatusCode
+	}()
+	<-arrived
+	cancel()
+	<-done
+	assert.Equal(t, http.StatusOK, <-reply)
+
+	// 3. 端口已释放
+	l, err = net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	assert.Nil(t, err)
+	l.Close()
+
+	// 4. 服务退出后共享的日志仍可写入
+	logger.Infow(context.TODO(), "after-server-closed")
+	assert.Nil(t, logger.Sync())
+	buf, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Contains(t, string(buf), "in-flight-request-done")
+	assert.Contains(t, string(buf), "after-server-closed")
+}
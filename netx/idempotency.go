@@ -0,0 +1,244 @@
+package netx
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/advancevillage/3rd/dbx"
+	"github.com/advancevillage/3rd/logx"
+	"github.com/advancevillage/3rd/mathx"
+)
+
+const (
+	X_Idempotency_Key      = "Idempotency-Key"
+	X_Idempotency_Replayed = "Idempotency-Replayed"
+)
+
+var (
+	ErrIdempotencyKeyMissing  = errors.New("idempotency: key missing")
+	ErrIdempotencyKeyInFlight = errors.New("idempotency: request in flight")
+	ErrIdempotencyKeyReused   = errors.New("idempotency: key reused with different request")
+)
+
+// HttpMiddleware 包装HttpRegister, 可在业务处理前后执行逻辑
+type HttpMiddleware func(HttpRegister) HttpRegister
+
+type IdempotencyOption = Option[idempotencyOptions]
+
+// WithIdempotencyTTL 首次响应缓存时长
+func WithIdempotencyTTL(ttl time.Duration) IdempotencyOption {
+	return newFuncOption(func(o *idempotencyOptions) {
+		o.ttl = ttl
+	})
+}
+
+// WithIdempotencyLockTTL 执行期间锁的时长, 需大于业务最长处理时间
+func WithIdempotencyLockTTL(ttl time.Duration) IdempotencyOption {
+	return newFuncOption(func(o *idempotencyOptions) {
+		o.lockTTL = ttl
+	})
+}
+
+func WithIdempotencyPrefix(prefix string) IdempotencyOption {
+	return newFuncOption(func(o *idempotencyOptions) {
+		o.prefix = prefix
+	})
+}
+
+// WithIdempotencyRequired 缺少Idempotency-Key时直接拒绝请求
+func WithIdempotencyRequired() IdempotencyOption {
+	return newFuncOption(func(o *idempotencyOptions) {
+		o.required = true
+	})
+}
+
+type idempotencyOptions struct {
+	ttl      time.Duration // 响应缓存时长
+	lockTTL  time.Duration // 执行锁时长
+	prefix   string        // 缓存键前缀
+	required bool          // 是否必须携带幂等键
+}
+
+var defaultIdempotencyOptions = idempotencyOptions{
+	ttl:      24 * time.Hour,
+	lockTTL:  time.Minute,
+	prefix:   "3rd:idempotency",
+	required: false,
+}
+
+// idempotencyRecord 首次请求的响应快照
+type idempotencyRecord struct {
+	Fingerprint string      `json:"fingerprint"`
+	StatusCode  int         `json:"status"`
+	Header      http.Header `json:"header"`
+	Body        []byte      `json:"body"`
+	Envelope    bool        `json:"envelope,omitempty"` // Body为JSON编码的Envelope, 重放时按Accept重新协商
+}
+
+type idempotencySrv struct {
+	opts   idempotencyOptions
+	logger logx.ILogger
+	locker dbx.CacheLocker
+	cacher dbx.Cacher
+}
+
+func NewIdempotencyMiddleware(ctx context.Context, logger logx.ILogger, locker dbx.CacheLocker, cacher dbx.Cacher, opt ...IdempotencyOption) HttpMiddleware {
+	// 1. 设置配置
+	opts := defaultIdempotencyOptions
+	for _, o := range opt {
+		o.apply(&opts)
+	}
+	// 2. 创建服务
+	s := &idempotencySrv{
+		opts:   opts,
+		logger: logger,
+		locker: locker,
+		cacher: cacher,
+	}
+	logger.Infow(ctx, "idempotency: middleware created", "ttl", opts.ttl, "lockTTL", opts.lockTTL, "required", opts.required)
+	return s.wrap
+}
+
+func (s *idempotencySrv) wrap(f HttpRegister) HttpRegister {
+	return func(ctx context.Context, r *http.Request) (HttpResponse, error) {
+		// 1. 提取幂等键
+		key := r.Header.Get(X_Idempotency_Key)
+		if len(key) <= 0 {
+			if s.opts.required {
+				return NewBadRequestHttpResponse(ErrIdempotencyKeyMissing), nil
+			}
+			return f(ctx, r)
+		}
+
+		// 2. 请求指纹
+		fp, err := s.fingerprint(r)
+		if err != nil {
+			return NewBadRequestHttpResponse(err), nil
+		}
+
+		var (
+			rk = fmt.Sprintf("%s:%s:%s:%s", s.opts.prefix, r.Method, r.URL.Path, key)
+			lk = fmt.Sprintf("%s:lock", rk)
+			rc = s.cacher.CreateStringCacher(ctx, rk, s.opts.ttl)
+		)
+
+		// 3. 重放已完成的响应
+		if reply, ok := s.replay(ctx, rc, fp); ok {
+			return reply, nil
+		}
+
+		// 4. 加锁
+		token := mathx.UUID()
+		ok, err := s.locker.Lock(ctx, lk, token, s.opts.lockTTL)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			s.logger.Warnw(ctx, "idempotency: request in flight", "key", key)
+			return NewConflictHttpResponse(ErrIdempotencyKeyInFlight), nil
+		}
+		defer func() {
+			_, err := s.locker.Unlock(ctx, lk, token)
+			if err != nil {
+				s.logger.Errorw(ctx, "idempotency: unlock failed", "err", err, "key", key)
+			}
+		}()
+
+		// 5. 加锁期间可能已完成
+		if reply, ok := s.replay(ctx, rc, fp); ok {
+			return reply, nil
+		}
+
+		// 6. 执行请求
+		reply, err := f(ctx, r)
+		if err != nil {
+			return nil, err
+		}
+
+		// 7. 服务端错误允许重试, 流式响应无法重放, 均不缓存
+		if reply.StatusCode() >= http.StatusInternalServerError {
+			return reply, nil
+		}
+		if _, ok := reply.(HttpStreamer); ok {
+			return reply, nil
+		}
+
+		// 8. 保存响应
+		_, env := reply.(*envelopeHttpResponse)
+		buf, err := json.Marshal(&idempotencyRecord{
+			Fingerprint: fp,
+			StatusCode:  reply.StatusCode(),
+			Header:      reply.Header(),
+			Body:        reply.Body(),
+			Envelope:    env,
+		})
+		if err != nil {
+			s.logger.Errorw(ctx, "idempotency: marshal record failed", "err", err, "key", key)
+			return reply, nil
+		}
+		err = rc.Set(ctx, string(buf))
+		if err != nil {
+			s.logger.Errorw(ctx, "idempotency: save record failed", "err", err, "key", key)
+		}
+		return reply, nil
+	}
+}
+
+func (s *idempotencySrv) replay(ctx context.Context, rc dbx.StringCacher, fp string) (HttpResponse, bool) {
+	str, err := rc.Get(ctx)
+	if err != nil || len(str) <= 0 {
+		return nil, false
+	}
+	record := &idempotencyRecord{}
+	err = json.Unmarshal([]byte(str), record)
+	if err != nil {
+		s.logger.Errorw(ctx, "idempotency: unmarshal record failed", "err", err)
+		return nil, false
+	}
+	if record.Fingerprint != fp {
+		return NewUnprocessableEntityHttpResponse(ErrIdempotencyKeyReused), true
+	}
+	hdr := record.Header.Clone()
+	if hdr == nil {
+		hdr = http.Header{}
+	}
+	hdr.Set(X_Idempotency_Replayed, "true")
+	s.logger.Infow(ctx, "idempotency: replay response", "status", record.StatusCode)
+	if !record.Envelope {
+		return newHttpResponse(record.Body, hdr, record.StatusCode), true
+	}
+	// 结构化响应还原为Envelope, 由render按本次请求的Accept编码
+	env := &Envelope{}
+	err = json.Unmarshal(record.Body, env)
+	if err != nil {
+		s.logger.Errorw(ctx, "idempotency: unmarshal envelope failed", "err", err)
+		return newHttpResponse(record.Body, hdr, record.StatusCode), true
+	}
+	return &envelopeHttpResponse{env: env, body: record.Body, header: hdr, statusCode: record.StatusCode}, true
+}
+
+// fingerprint 计算请求体摘要, 同一幂等键不允许携带不同请求体
+func (s *idempotencySrv) fingerprint(r *http.Request) (string, error) {
+	h := sha256.New()
+	h.Write([]byte(r.Method))
+	h.Write([]byte(r.URL.RequestURI()))
+	if r.Body == nil {
+		return hex.EncodeToString(h.Sum(nil)), nil
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return "", err
+	}
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewBuffer(body))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,251 @@
+package netx
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/advancevillage/3rd/dbx"
+	"github.com/advancevillage/3rd/logx"
+	"github.com/advancevillage/3rd/mathx"
+	"github.com/advancevillage/3rd/x"
+	"github.com/stretchr/testify/assert"
+)
+
+type testMemCache struct {
+	mu       sync.Mutex
+	kv       map[string]string
+	hash     map[string]map[string]string
+	deadline map[string]time.Time // 锁过期时间
+}
+
+func newTestMemCache() *testMemCache {
+	return &testMemCache{kv: make(map[string]string), hash: make(map[string]map[string]string), deadline: make(map[string]time.Time)}
+}
+
+func (c *testMemCache) Lock(ctx context.Context, key string, val string, ttl time.Duration) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.kv[key]; ok && !c.expired(key) {
+		return false, nil
+	}
+	c.kv[key] = val
+	if ttl > 0 {
+		c.deadline[key] = time.Now().Add(ttl)
+	}
+	return true, nil
+}
+
+func (c *testMemCache) Renew(ctx context.Context, key string, val string, ttl time.Duration) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.kv[key] != val || c.expired(key) {
+		return false, nil
+	}
+	c.deadline[key] = time.Now().Add(ttl)
+	return true, nil
+}
+
+func (c *testMemCache) expired(key string) bool {
+	d, ok := c.deadline[key]
+	return ok && time.Now().After(d)
+}
+
+func (c *testMemCache) Unlock(ctx context.Context, key string, val string) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.kv[key] != val {
+		return false, nil
+	}
+	delete(c.kv, key)
+	return true, nil
+}
+
+func (c *testMemCache) CreateHashCacher(ctx context.Context, key string, exp time.Duration) dbx.HashCacher {
+	return &testMemHashCache{c: c, key: key}
+}
+
+func (c *testMemCache) CreateStringCacher(ctx context.Context, key string, exp time.Duration) dbx.StringCacher {
+	return &testMemStringCache{c: c, key: key}
+}
+
+type testMemHashCache struct {
+	c   *testMemCache
+	key string
+}
+
+func (h *testMemHashCache) Get(ctx context.Context, fields ...string) (x.Builder, error) {
+	h.c.mu.Lock()
+	defer h.c.mu.Unlock()
+	kv := []x.Option{}
+	for _, f := range fields {
+		if v, ok := h.c.hash[h.key][f]; ok {
+			kv = append(kv, x.WithKV(f, v))
+		}
+	}
+	return x.NewBuilder(kv...), nil
+}
+
+func (h *testMemHashCache) GetAll(ctx context.Context) (x.Builder, error) {
+	h.c.mu.Lock()
+	defer h.c.mu.Unlock()
+	kv := []x.Option{}
+	for f, v := range h.c.hash[h.key] {
+		kv = append(kv, x.WithKV(f, v))
+	}
+	return x.NewBuilder(kv...), nil
+}
+
+func (h *testMemHashCache) Del(ctx context.Context, fields ...string) error {
+	h.c.mu.Lock()
+	defer h.c.mu.Unlock()
+	for _, f := range fields {
+		delete(h.c.hash[h.key], f)
+	}
+	return nil
+}
+
+func (h *testMemHashCache) Set(ctx context.Context, b x.Builder) error {
+	h.c.mu.Lock()
+	defer h.c.mu.Unlock()
+	if h.c.hash[h.key] == nil {
+		h.c.hash[h.key] = make(map[string]string)
+	}
+	for f, v := range b.Build() {
+		h.c.hash[h.key][f] = fmt.Sprint(v)
+	}
+	return nil
+}
+
+func (h *testMemHashCache) Incr(ctx context.Context, b x.Builder) error {
+	return nil
+}
+
+type testMemStringCache struct {
+	c   *testMemCache
+	key string
+}
+
+func (s *testMemStringCache) Get(ctx context.Context) (string, error) {
+	s.c.mu.Lock()
+	defer s.c.mu.Unlock()
+	return s.c.kv[s.key], nil
+}
+
+func (s *testMemStringCache) Set(ctx context.Context, value any) error {
+	s.c.mu.Lock()
+	defer s.c.mu.Unlock()
+	s.c.kv[s.key] = value.(string)
+	return nil
+}
+
+func (s *testMemStringCache) Del(ctx context.Context) error {
+	s.c.mu.Lock()
+	defer s.c.mu.Unlock()
+	delete(s.c.kv, s.key)
+	return nil
+}
+
+func (s *testMemStringCache) Incr(ctx context.Context, incr int64) error {
+	return nil
+}
+
+func Test_idempotency(t *testing.T) {
+	logger, err := logx.NewLogger("debug")
+	assert.Nil(t, err)
+	ctx := context.WithValue(context.TODO(), logx.TraceId, mathx.UUID())
+
+	newRequest := func(key string, body string) *http.Request {
+		r, err := http.NewRequest(http.MethodPost, "/pay", strings.NewReader(body))
+		assert.Nil(t, err)
+		if len(key) > 0 {
+			r.Header.Set(X_Idempotency_Key, key)
+		}
+		return r
+	}
+
+	t.Run("case-replay", func(t *testing.T) {
+		var (
+			cache = newTestMemCache()
+			count = int32(0)
+			mw    = NewIdempotencyMiddleware(ctx, logger, cache, cache)
+			key   = mathx.UUID()
+		)
+		f := mw(func(ctx context.Context, r *http.Request) (HttpResponse, error) {
+			n := atomic.AddInt32(&count, 1)
+			return NewStatusOkHttpResponse(x.NewBuilder(x.WithKV("n", n)).Build(), http.Header{}), nil
+		})
+
+		r1, err := f(ctx, newRequest(key, `{"amount":1}`))
+		assert.Nil(t, err)
+		r2, err := f(ctx, newRequest(key, `{"amount":1}`))
+		assert.Nil(t, err)
+		assert.Equal(t, int32(1), count)
+		assert.Equal(t, r1.StatusCode(), r2.StatusCode())
+		assert.Equal(t, r1.Body(), r2.Body())
+		assert.Equal(t, "true", r2.Header().Get(X_Idempotency_Replayed))
+
+		// 重放响应按本次Accept协商编码
+		e, ok := r2.(HttpEncoder)
+		assert.True(t, ok)
+		ct, body, err := e.Encode(MIMEMsgPack)
+		assert.Nil(t, err)
+		assert.Equal(t, MIMEMsgPack, ct)
+		reply := &Envelope{}
+		c, _ := GetCodec(MIMEMsgPack)
+		assert.Nil(t, c.Unmarshal(body, reply))
+		assert.Equal(t, http.StatusOK, reply.Code)
+		assert.Equal(t, "success", reply.Message)
+
+		r3, err := f(ctx, newRequest(key, `{"amount":2}`))
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusUnprocessableEntity, r3.StatusCode())
+		assert.Equal(t, int32(1), count)
+	})
+
+	t.Run("case-conflict", func(t *testing.T) {
+		var (
+			cache   = newTestMemCache()
+			key     = mathx.UUID()
+			mw      = NewIdempotencyMiddleware(ctx, logger, cache, cache)
+			started = make(chan struct{})
+			release = make(chan struct{})
+		)
+		f := mw(func(ctx context.Context, r *http.Request) (HttpResponse, error) {
+			close(started)
+			<-release
+			return NewEmptyResonse(), nil
+		})
+
+		done := make(chan HttpResponse)
+		go func() {
+			r, err := f(ctx, newRequest(key, "{}"))
+			assert.Nil(t, err)
+			done <- r
+		}()
+		<-started
+		r, err := f(ctx, newRequest(key, "{}"))
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusConflict, r.StatusCode())
+		close(release)
+		assert.Equal(t, http.StatusOK, (<-done).StatusCode())
+	})
+
+	t.Run("case-required", func(t *testing.T) {
+		var (
+			cache = newTestMemCache()
+			mw    = NewIdempotencyMiddleware(ctx, logger, cache, cache, WithIdempotencyRequired())
+		)
+		f := mw(func(ctx context.Context, r *http.Request) (HttpResponse, error) {
+			return NewEmptyResonse(), nil
+		})
+		r, err := f(ctx, newRequest("", "{}"))
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusBadRequest, r.StatusCode())
+	})
+}
@@ -0,0 +1,67 @@
+package netx
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/advancevillage/3rd/logx"
+)
+
+var ErrLogLevelUnsupported = errors.New("loglevel: logger does not support runtime level")
+
+type logLevelRequest struct {
+	Name  string `json:"name"`                     // 为空表示全局级别
+	Level string `json:"level" binding:"required"` // debug info warn error
+}
+
+type logLevelSrv struct {
+	logger logx.ILogger
+	levels logx.LevelController
+}
+
+// NewLogLevelHandler 运行时日志级别管理, 建议挂载在管理端口并加鉴权
+// GET 查询全部级别
+// PUT/POST {"name":"dbx","level":"debug"} 设置级别, name为空设置全局级别
+// DELETE ?name=dbx 删除命名日志的级别, 恢复继承
+func NewLogLevelHandler(ctx context.Context, logger logx.ILogger) (HttpRegister, error) {
+	levels, ok := logx.Levels(logger)
+	if !ok {
+		return nil, ErrLogLevelUnsupported
+	}
+	s := &logLevelSrv{logger: logger, levels: levels}
+	return s.serve, nil
+}
+
+func (s *logLevelSrv) serve(ctx context.Context, r *http.Request) (HttpResponse, error) {
+	switch r.Method {
+	case http.MethodGet:
+		return NewStatusOkHttpResponse(s.levels.Levels(), nil), nil
+
+	case http.MethodPut, http.MethodPost:
+		req := &logLevelRequest{}
+		err := ShouldBind(r, req)
+		if err != nil {
+			return NewBadRequestHttpResponse(err), nil
+		}
+		old := s.levels.Level(req.Name)
+		err = s.levels.SetLevel(req.Name, req.Level)
+		if err != nil {
+			return NewBadRequestHttpResponse(err), nil
+		}
+		s.logger.Warnw(ctx, "loglevel: level changed", "name", req.Name, "old", old, "new", req.Level)
+		return NewStatusOkHttpResponse(s.levels.Levels(), nil), nil
+
+	case http.MethodDelete:
+		name := r.URL.Query().Get("name")
+		if len(name) <= 0 {
+			return NewBadRequestHttpResponse(errors.New("loglevel: name required")), nil
+		}
+		s.levels.UnsetLevel(name)
+		s.logger.Warnw(ctx, "loglevel: level unset", "name", name)
+		return NewStatusOkHttpResponse(s.levels.Levels(), nil), nil
+
+	default:
+		return NewMethodNotAllowedHttpResponse(errors.New(r.Method)), nil
+	}
+}
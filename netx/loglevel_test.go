@@ -0,0 +1,67 @@
+package netx
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/advancevillage/3rd/logx"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_loglevel(t *testing.T) {
+	logger, err := logx.NewLogger("info")
+	assert.Nil(t, err)
+	h, err := NewLogLevelHandler(context.TODO(), logger)
+	assert.Nil(t, err)
+	s, err := newHttpSrv(context.TODO(), logger, WithHttpService("ANY", "/admin/log/level", h))
+	assert.Nil(t, err)
+	levels, _ := logx.Levels(logger)
+
+	var data = map[string]struct {
+		method string
+		uri    string
+		body   string
+		code   int
+		check  func(t *testing.T)
+	}{
+		"case-get": {
+			method: http.MethodGet, uri: "/admin/log/level", code: http.StatusOK,
+		},
+		"case-set-named": {
+			method: http.MethodPut, uri: "/admin/log/level", body: `{"name":"dbx","level":"debug"}`, code: http.StatusOK,
+			check: func(t *testing.T) {
+				assert.Equal(t, "debug", levels.Level("dbx.redis"))
+				assert.Equal(t, "info", levels.Level(""))
+			},
+		},
+		"case-invalid": {
+			method: http.MethodPost, uri: "/admin/log/level", body: `{"level":"verbose"}`, code: http.StatusBadRequest,
+		},
+		"case-missing": {
+			method: http.MethodPost, uri: "/admin/log/level", body: `{"name":"dbx"}`, code: http.StatusBadRequest,
+		},
+		"case-unset": {
+			method: http.MethodDelete, uri: "/admin/log/level?name=dbx", code: http.StatusOK,
+			check: func(t *testing.T) {
+				assert.Equal(t, "info", levels.Level("dbx.redis"))
+			},
+		},
+	}
+	for _, n := range []string{"case-get", "case-set-named", "case-invalid", "case-missing", "case-unset"} {
+		v := data[n]
+		f := func(t *testing.T) {
+			req := httptest.NewRequest(v.method, v.uri, bytes.NewReader([]byte(v.body)))
+			req.Header.Set("Content-Type", MIMEJSON)
+			rec := httptest.NewRecorder()
+			s.srv.ServeHTTP(rec, req)
+			assert.Equal(t, v.code, rec.Code)
+			if v.check != nil {
+				v.check(t)
+			}
+		}
+		t.Run(n, f)
+	}
+}
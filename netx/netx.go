@@ -2,6 +2,7 @@ package netx
 
 import (
 	"context"
+	"io"
 	"mime/multipart"
 	"net/http"
 	"os"
@@ -28,8 +29,25 @@ func waitQuitSignal(cancel context.CancelFunc) {
 	cancel()
 }
 
+// ShouldBind 优先使用已注册的Codec按Content-Type解码, 表单等类型交由gin绑定
 func ShouldBind(r *http.Request, obj any) error {
-	return binding.Default(r.Method, r.Header.Get("Content-Type")).Bind(r, obj)
+	ct := r.Header.Get("Content-Type")
+	c, ok := GetCodec(ct)
+	if !ok || r.Method == http.MethodGet || r.Body == nil {
+		return binding.Default(r.Method, ct).Bind(r, obj)
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	err = c.Unmarshal(body, obj)
+	if err != nil {
+		return err
+	}
+	if binding.Validator == nil {
+		return nil
+	}
+	return binding.Validator.ValidateStruct(obj)
 }
 
 func ShoudBindQuery(r *http.Request, obj any) error {
@@ -0,0 +1,444 @@
+package netx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/advancevillage/3rd/logx"
+	"github.com/advancevillage/3rd/tracex"
+	"github.com/gin-gonic/gin"
+)
+
+var ErrNoUpstream = errors.New("proxy: no upstream available")
+
+// Upstream 反向代理的上游节点
+type Upstream interface {
+	Host() string  // 节点地址 host:port
+	Active() int64 // 进行中的请求数
+	Healthy() bool // 是否未被摘除
+}
+
+// Balancer 负载均衡策略, ups为当前可用的节点
+type Balancer interface {
+	Pick(r *http.Request, ups []Upstream) Upstream
+}
+
+type ProxyOption = Option[proxyOptions]
+
+func WithProxyBalancer(b Balancer) ProxyOption {
+	return newFuncOption(func(o *proxyOptions) {
+		o.balancer = b
+	})
+}
+
+// WithProxyStripPrefix 转发前去掉请求路径前缀
+func WithProxyStripPrefix(prefix string) ProxyOption {
+	return newFuncOption(func(o *proxyOptions) {
+		o.strip = prefix
+	})
+}
+
+// WithProxyRequestHeader 设置转发请求头, value为空时删除
+func WithProxyRequestHeader(key, value string) ProxyOption {
+	return newFuncOption(func(o *proxyOptions) {
+		o.reqHdr = append(o.reqHdr, [2]string{key, value})
+	})
+}
+
+// WithProxyResponseHeader 设置返回响应头, value为空时删除
+func WithProxyResponseHeader(key, value string) ProxyOption {
+	return newFuncOption(func(o *proxyOptions) {
+		o.rspHdr = append(o.rspHdr, [2]string{key, value})
+	})
+}
+
+// WithProxyPreserveHost 保留客户端Host请求头
+func WithProxyPreserveHost() ProxyOption {
+	return newFuncOption(func(o *proxyOptions) {
+		o.preserveHost = true
+	})
+}
+
+// WithProxyPassiveHealth 被动健康检查: 连续失败maxFails次后摘除节点failTimeout
+func WithProxyPassiveHealth(maxFails int, failTimeout time.Duration) ProxyOption {
+	return newFuncOption(func(o *proxyOptions) {
+		o.maxFails = maxFails
+		o.failTimeout = failTimeout
+	})
+}
+
+func WithProxyTransport(rt http.RoundTripper) ProxyOption {
+	return newFuncOption(func(o *proxyOptions) {
+		o.transport = rt
+	})
+}
+
+type proxyOptions struct {
+	balancer     Balancer          // 负载均衡
+	strip        string            // 去除路径前缀
+	reqHdr       [][2]string       // 请求头改写
+	rspHdr       [][2]string       // 响应头改写
+	preserveHost bool              // 保留Host
+	maxFails     int               // 最大连续失败次数
+	failTimeout  time.Duration     // 摘除时长
+	transport    http.RoundTripper // 传输层
+}
+
+var defaultProxyOptions = proxyOptions{
+	maxFails:    3,
+	failTimeout: 10 * time.Second,
+	transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: 3 * time.Second, KeepAlive: 30 * time.Second}).DialContext,
+		MaxIdleConns:          256,
+		MaxIdleConnsPerHost:   64,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   5 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	},
+}
+
+var _ Upstream = (*upstream)(nil)
+
+type upstream struct {
+	u        *url.URL
+	active   int64
+	mu       sync.Mutex
+	fails    int
+	ejectEnd time.Time
+}
+
+func (u *upstream) Host() string {
+	return u.u.Host
+}
+
+func (u *upstream) Active() int64 {
+	return atomic.LoadInt64(&u.active)
+}
+
+func (u *upstream) Healthy() bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return time.Now().After(u.ejectEnd)
+}
+
+// report 记录转发结果, 返回节点是否被摘除
+func (u *upstream) report(ok bool, maxFails int, failTimeout time.Duration) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if ok {
+		u.fails = 0
+		return false
+	}
+	u.fails += 1
+	if maxFails <= 0 || u.fails < maxFails {
+		return false
+	}
+	u.fails = 0
+	u.ejectEnd = time.Now().Add(failTimeout)
+	return true
+}
+
+type ctxKeyUpstream struct{}
+
+type httpProxy struct {
+	opts   proxyOptions
+	logger logx.ILogger
+	ups    []*upstream
+	rp     *httputil.ReverseProxy
+}
+
+// NewHttpProxy 创建反向代理路由, 请求与响应均以流的方式转发, 需作为最后一个HttpRegister
+func NewHttpProxy(ctx context.Context, logger logx.ILogger, targets []string, opt ...ProxyOption) (HttpRegister, error) {
+	// 1. 设置配置
+	opts := defaultProxyOptions
+	opts.balancer = NewRoundRobinBalancer()
+	for _, o := range opt {
+		o.apply(&opts)
+	}
+	// 2. 解析上游
+	if len(targets) <= 0 {
+		return nil, ErrNoUpstream
+	}
+	p := &httpProxy{opts: opts, logger: logger}
+	for _, t := range targets {
+		u, err := url.Parse(t)
+		if err != nil {
+			logger.Errorw(ctx, "proxy: parse upstream failed", "err", err, "upstream", t)
+			return nil, err
+		}
+		if len(u.Scheme) <= 0 || len(u.Host) <= 0 {
+			return nil, fmt.Errorf("proxy: invalid upstream %s", t)
+		}
+		p.ups = append(p.ups, &upstream{u: u})
+	}
+	// 3. 反向代理
+	p.rp = &httputil.ReverseProxy{
+		Rewrite:        p.rewrite,
+		Transport:      opts.transport,
+		ModifyResponse: p.modifyResponse,
+		ErrorHandler:   p.errorHandler,
+	}
+	logger.Infow(ctx, "proxy: created", "upstreams", targets)
+	return p.serve, nil
+}
+
+func (p *httpProxy) serve(ctx context.Context, r *http.Request) (HttpResponse, error) {
+	// 1. 透传数据, 直接写入
+	writer, ok := ctx.Value(ctxKeyResponseWriter{}).(gin.ResponseWriter)
+	if !ok {
+		return newHttpResponse([]byte("proxy: no response writer"), http.Header{}, http.StatusInternalServerError), nil
+	}
+	// 2. 选择节点
+	up := p.pick(r)
+	if up == nil {
+		return NewServiceUnavailableHttpResponse(ErrNoUpstream), nil
+	}
+	// 3. 转发
+	atomic.AddInt64(&up.active, 1)
+	defer atomic.AddInt64(&up.active, -1)
+	p.rp.ServeHTTP(proxyWriter{writer}, r.WithContext(context.WithValue(ctx, ctxKeyUpstream{}, up)))
+	return newHttpResponse(nil, http.Header{}, http.StatusOK), nil
+}
+
+// proxyWriter 屏蔽gin.ResponseWriter的CloseNotify, 客户端断开由请求上下文感知
+type proxyWriter struct {
+	http.ResponseWriter
+}
+
+func (w proxyWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w proxyWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// pick 优先从健康节点中选择, 全部摘除时退化为全部节点
+func (p *httpProxy) pick(r *http.Request) *upstream {
+	var (
+		healthy = make([]Upstream, 0, len(p.ups))
+		all     = make([]Upstream, 0, len(p.ups))
+	)
+	for _, u := range p.ups {
+		all = append(all, u)
+		if u.Healthy() {
+			healthy = append(healthy, u)
+		}
+	}
+	if len(healthy) <= 0 {
+		healthy = all
+	}
+	up, ok := p.opts.balancer.Pick(r, healthy).(*upstream)
+	if !ok {
+		return nil
+	}
+	return up
+}
+
+func (p *httpProxy) rewrite(pr *httputil.ProxyRequest) {
+	up := pr.In.Context().Value(ctxKeyUpstream{}).(*upstream)
+	// 1. 目标地址
+	if len(p.opts.strip) > 0 {
+		pr.Out.URL.Path = strings.TrimPrefix(pr.Out.URL.Path, p.opts.strip)
+		pr.Out.URL.RawPath = strings.TrimPrefix(pr.Out.URL.RawPath, p.opts.strip)
+	}
+	pr.SetURL(up.u)
+	pr.SetXForwarded()
+	if p.opts.preserveHost {
+		pr.Out.Host = pr.In.Host
+	}
+	// 2. 链路追踪
+	if trace, ok := logx.TraceKey.Value(pr.In.Context()); ok && len(trace) > 0 {
+		pr.Out.Header.Set(logx.TraceId, trace)
+	}
+	tracex.Inject(pr.In.Context(), tracex.HeaderCarrier(pr.Out.Header))
+	// 3. 改写请求头
+	for _, kv := range p.opts.reqHdr {
+		if len(kv[1]) <= 0 {
+			pr.Out.Header.Del(kv[0])
+		} else {
+			pr.Out.Header.Set(kv[0], kv[1])
+		}
+	}
+}
+
+func (p *httpProxy) modifyResponse(rsp *http.Response) error {
+	var (
+		ctx = rsp.Request.Context()
+		up  = ctx.Value(ctxKeyUpstream{}).(*upstream)
+	)
+	// 1. 被动健康检查
+	switch rsp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		p.report(ctx, up, false)
+	default:
+		p.report(ctx, up, true)
+	}
+	// 2. SSE关闭中间层缓冲
+	if strings.HasPrefix(rsp.Header.Get("Content-Type"), "text/event-stream") {
+		rsp.Header.Set("X-Accel-Buffering", "no")
+	}
+	// 3. 改写响应头
+	for _, kv := range p.opts.rspHdr {
+		if len(kv[1]) <= 0 {
+			rsp.Header.Del(kv[0])
+		} else {
+			rsp.Header.Set(kv[0], kv[1])
+		}
+	}
+	return nil
+}
+
+func (p *httpProxy) errorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	var (
+		ctx = r.Context()
+		up  = ctx.Value(ctxKeyUpstream{}).(*upstream)
+	)
+	// 客户端主动断开不计入失败
+	if errors.Is(err, context.Canceled) {
+		p.logger.Infow(ctx, "proxy: client closed", "upstream", up.Host())
+		return
+	}
+	p.logger.Errorw(ctx, "proxy: upstream failed", "err", err, "upstream", up.Host())
+	p.report(ctx, up, false)
+	reply := NewBadGatewayHttpResponse(err)
+	w.Header().Set("Content-Type", MIMEJSON)
+	w.WriteHeader(reply.StatusCode())
+	w.Write(reply.Body())
+}
+
+func (p *httpProxy) report(ctx context.Context, up *upstream, ok bool) {
+	if up.report(ok, p.opts.maxFails, p.opts.failTimeout) {
+		p.logger.Warnw(ctx, "proxy: upstream ejected", "upstream", up.Host(), "timeout", p.opts.failTimeout)
+	}
+}
+
+var _ Balancer = (*roundRobinBalancer)(nil)
+
+type roundRobinBalancer struct {
+	n uint64
+}
+
+func NewRoundRobinBalancer() Balancer {
+	return &roundRobinBalancer{}
+}
+
+func (b *roundRobinBalancer) Pick(r *http.Request, ups []Upstream) Upstream {
+	if len(ups) <= 0 {
+		return nil
+	}
+	n := atomic.AddUint64(&b.n, 1)
+	return ups[(n-1)%uint64(len(ups))]
+}
+
+var _ Balancer = (*leastConnBalancer)(nil)
+
+type leastConnBalancer struct {
+	rr roundRobinBalancer
+}
+
+func NewLeastConnBalancer() Balancer {
+	return &leastConnBalancer{}
+}
+
+// Pick 选择进行中请求最少的节点, 相同时轮询
+func (b *leastConnBalancer) Pick(r *http.Request, ups []Upstream) Upstream {
+	if len(ups) <= 0 {
+		return nil
+	}
+	var (
+		least = ups[0].Active()
+		cands = []Upstream{}
+	)
+	for _, u := range ups {
+		a := u.Active()
+		switch {
+		case a < least:
+			least = a
+			cands = append(cands[:0], u)
+		case a == least:
+			cands = append(cands, u)
+		}
+	}
+	return b.rr.Pick(r, cands)
+}
+
+var _ Balancer = (*consistentHashBalancer)(nil)
+
+type consistentHashBalancer struct {
+	key      func(r *http.Request) string
+	replicas int
+	rings    sync.Map // 节点集合 -> 哈希环
+}
+
+type hashRing []struct {
+	hash uint32
+	up   Upstream
+}
+
+// NewConsistentHashBalancer 一致性哈希, key为空时使用客户端IP
+func NewConsistentHashBalancer(key func(r *http.Request) string) Balancer {
+	if key == nil {
+		key = func(r *http.Request) string {
+			host, _, err := net.SplitHostPort(r.RemoteAddr)
+			if err != nil {
+				return r.RemoteAddr
+			}
+			return host
+		}
+	}
+	return &consistentHashBalancer{key: key, replicas: 160}
+}
+
+func (b *consistentHashBalancer) Pick(r *http.Request, ups []Upstream) Upstream {
+	if len(ups) <= 0 {
+		return nil
+	}
+	var (
+		ring = b.ring(ups)
+		h    = crc32.ChecksumIEEE([]byte(b.key(r)))
+		i    = sort.Search(len(ring), func(i int) bool { return ring[i].hash >= h })
+	)
+	if i >= len(ring) {
+		i = 0
+	}
+	return ring[i].up
+}
+
+// ring 健康节点集合变化时重建哈希环
+func (b *consistentHashBalancer) ring(ups []Upstream) hashRing {
+	hosts := make([]string, 0, len(ups))
+	for _, u := range ups {
+		hosts = append(hosts, u.Host())
+	}
+	sig := strings.Join(hosts, ",")
+	if v, ok := b.rings.Load(sig); ok {
+		return v.(hashRing)
+	}
+	ring := make(hashRing, 0, len(ups)*b.replicas)
+	for _, u := range ups {
+		for i := 0; i < b.replicas; i++ {
+			ring = append(ring, struct {
+				hash uint32
+				up   Upstream
+			}{hash: crc32.ChecksumIEEE([]byte(fmt.Sprintf("%s#%d", u.Host(), i))), up: u})
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool { return ring[i].hash < ring[j].hash })
+	b.rings.Store(sig, ring)
+	return ring
+}
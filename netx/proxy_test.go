@@ -0,0 +1,168 @@
+package netx
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/advancevillage/3rd/logx"
+	"github.com/advancevillage/3rd/mathx"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_reverse_proxy(t *testing.T) {
+	logger, err := logx.NewLogger("debug")
+	assert.Nil(t, err)
+	ctx := context.TODO()
+
+	newUpstream := func(name string, code int) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Upstream", name)
+			w.Header().Set("X-Trace", r.Header.Get(logx.TraceId))
+			w.Header().Set("X-Tenant", r.Header.Get("X-Tenant"))
+			if r.URL.Path == "/events" {
+				w.Header().Set("Content-Type", "text/event-stream")
+				for i := 0; i < 3; i++ {
+					fmt.Fprintf(w, "id:%d\ndata:%s\n\n", i, name)
+					w.(http.Flusher).Flush()
+				}
+				return
+			}
+			w.WriteHeader(code)
+			fmt.Fprintf(w, "%s%s", name, r.URL.Path)
+		}))
+	}
+
+	do := func(s *httpSrv, path string, hdr map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for k, v := range hdr {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		s.srv.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("case-round-robin", func(t *testing.T) {
+		u1, u2 := newUpstream("u1", http.StatusOK), newUpstream("u2", http.StatusOK)
+		defer u1.Close()
+		defer u2.Close()
+
+		p, err := NewHttpProxy(ctx, logger, []string{u1.URL, u2.URL},
+			WithProxyStripPrefix("/api"),
+			WithProxyRequestHeader("X-Tenant", "3rd"),
+			WithProxyResponseHeader("X-Upstream-Proxy", "3rd"),
+		)
+		assert.Nil(t, err)
+		s, err := newHttpSrv(ctx, logger, WithHttpService("ANY", "/api/*path", p))
+		assert.Nil(t, err)
+
+		var (
+			trace = mathx.UUID()
+			seen  = map[string]int{}
+		)
+		for i := 0; i < 4; i++ {
+			rec := do(s, "/api/account", map[string]string{logx.TraceId: trace})
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, trace, rec.Header().Get("X-Trace"))
+			assert.Equal(t, "3rd", rec.Header().Get("X-Tenant"))
+			assert.Equal(t, "3rd", rec.Header().Get("X-Upstream-Proxy"))
+			assert.Equal(t, rec.Header().Get("X-Upstream")+"/account", rec.Body.String())
+			seen[rec.Header().Get("X-Upstream")] += 1
+		}
+		assert.Equal(t, map[string]int{"u1": 2, "u2": 2}, seen)
+	})
+
+	t.Run("case-passive-health", func(t *testing.T) {
+		u1, u2 := newUpstream("u1", http.StatusServiceUnavailable), newUpstream("u2", http.StatusOK)
+		defer u1.Close()
+		defer u2.Close()
+
+		p, err := NewHttpProxy(ctx, logger, []string{u1.URL, u2.URL}, WithProxyPassiveHealth(1, time.Minute))
+		assert.Nil(t, err)
+		s, err := newHttpSrv(ctx, logger, WithHttpService("ANY", "/*path", p))
+		assert.Nil(t, err)
+
+		codes := []int{}
+		for i := 0; i < 4; i++ {
+			codes = append(codes, do(s, "/account", nil).Code)
+		}
+		assert.Equal(t, []int{http.StatusServiceUnavailable, http.StatusOK, http.StatusOK, http.StatusOK}, codes)
+	})
+
+	t.Run("case-consistent-hash", func(t *testing.T) {
+		u1, u2, u3 := newUpstream("u1", http.StatusOK), newUpstream("u2", http.StatusOK), newUpstream("u3", http.StatusOK)
+		defer u1.Close()
+		defer u2.Close()
+		defer u3.Close()
+
+		b := NewConsistentHashBalancer(func(r *http.Request) string { return r.Header.Get("X-User") })
+		p, err := NewHttpProxy(ctx, logger, []string{u1.URL, u2.URL, u3.URL}, WithProxyBalancer(b))
+		assert.Nil(t, err)
+		s, err := newHttpSrv(ctx, logger, WithHttpService("ANY", "/*path", p))
+		assert.Nil(t, err)
+
+		for i := 0; i < 10; i++ {
+			user := mathx.RandStr(8)
+			exp := do(s, "/account", map[string]string{"X-User": user}).Header().Get("X-Upstream")
+			for j := 0; j < 3; j++ {
+				assert.Equal(t, exp, do(s, "/account", map[string]string{"X-User": user}).Header().Get("X-Upstream"))
+			}
+		}
+	})
+
+	t.Run("case-sse", func(t *testing.T) {
+		u1 := newUpstream("u1", http.StatusOK)
+		defer u1.Close()
+
+		p, err := NewHttpProxy(ctx, logger, []string{u1.URL})
+		assert.Nil(t, err)
+		s, err := newHttpSrv(ctx, logger, WithHttpService("ANY", "/*path", p))
+		assert.Nil(t, err)
+		srv := httptest.NewServer(s.srv)
+		defer srv.Close()
+
+		rsp, err := http.Get(srv.URL + "/events")
+		assert.Nil(t, err)
+		defer rsp.Body.Close()
+		body, err := io.ReadAll(rsp.Body)
+		assert.Nil(t, err)
+		assert.Equal(t, "text/event-stream", rsp.Header.Get("Content-Type"))
+		assert.Equal(t, "no", rsp.Header.Get("X-Accel-Buffering"))
+		assert.Equal(t, "id:0\ndata:u1\n\nid:1\ndata:u1\n\nid:2\ndata:u1\n\n", string(body))
+	})
+
+	t.Run("case-bad-gateway", func(t *testing.T) {
+		p, err := NewHttpProxy(ctx, logger, []string{"http://127.0.0.1:1"})
+		assert.Nil(t, err)
+		s, err := newHttpSrv(ctx, logger, WithHttpService("ANY", "/*path", p))
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusBadGateway, do(s, "/account", nil).Code)
+	})
+}
+
+type testUpstream struct {
+	host   string
+	active int64
+}
+
+func (u *testUpstream) Host() string  { return u.host }
+func (u *testUpstream) Active() int64 { return u.active }
+func (u *testUpstream) Healthy() bool { return true }
+
+func Test_least_conn(t *testing.T) {
+	var (
+		b   = NewLeastConnBalancer()
+		ups = []Upstream{&testUpstream{"u1", 3}, &testUpstream{"u2", 1}, &testUpstream{"u3", 1}}
+		r   = httptest.NewRequest(http.MethodGet, "/", nil)
+	)
+	seen := map[string]int{}
+	for i := 0; i < 4; i++ {
+		seen[b.Pick(r, ups).Host()] += 1
+	}
+	assert.Equal(t, map[string]int{"u2": 2, "u3": 2}, seen)
+}
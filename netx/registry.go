@@ -0,0 +1,364 @@
+package netx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/advancevillage/3rd/dbx"
+	"github.com/advancevillage/3rd/logx"
+	"github.com/advancevillage/3rd/x"
+)
+
+const RegistryScheme = "registry"
+
+var ErrServiceNotFound = errors.New("registry: service not found")
+
+// ServiceInstance 服务实例
+type ServiceInstance struct {
+	Id       string            `json:"id"`
+	Name     string            `json:"name"`
+	Host     string            `json:"host"`
+	Port     int               `json:"port"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+func (s *ServiceInstance) Addr() string {
+	return net.JoinHostPort(s.Host, fmt.Sprint(s.Port))
+}
+
+func (s *ServiceInstance) id() string {
+	if len(s.Id) > 0 {
+		return s.Id
+	}
+	return s.Addr()
+}
+
+// Registry 服务注册与发现
+type Registry interface {
+	Register(ctx context.Context, ins *ServiceInstance, ttl time.Duration) error
+	Heartbeat(ctx context.Context, ins *ServiceInstance, ttl time.Duration) error
+	Deregister(ctx context.Context, ins *ServiceInstance) error
+	// Watch 首次立即推送全量实例, 之后实例变化时推送, ctx结束后关闭通道
+	Watch(ctx context.Context, name string) (<-chan []*ServiceInstance, error)
+}
+
+// sortInstances 按id排序, 便于比较
+func sortInstances(ins []*ServiceInstance) []*ServiceInstance {
+	sort.Slice(ins, func(i, j int) bool { return ins[i].id() < ins[j].id() })
+	return ins
+}
+
+func sameInstances(a, b []*ServiceInstance) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		x, _ := json.Marshal(a[i])
+		y, _ := json.Marshal(b[i])
+		if string(x) != string(y) {
+			return false
+		}
+	}
+	return true
+}
+
+var _ Registry = (*staticRegistry)(nil)
+
+// staticRegistry 内存注册中心, 用于测试及固定节点
+type staticRegistry struct {
+	mu       sync.RWMutex
+	services map[string]map[string]*ServiceInstance
+	watchers map[string][]chan []*ServiceInstance
+}
+
+func NewStaticRegistry(ins ...*ServiceInstance) Registry {
+	r := &staticRegistry{
+		services: make(map[string]map[string]*ServiceInstance),
+		watchers: make(map[string][]chan []*ServiceInstance),
+	}
+	for _, i := range ins {
+		r.Register(context.TODO(), i, 0)
+	}
+	return r
+}
+
+func (r *staticRegistry) Register(ctx context.Context, ins *ServiceInstance, ttl time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.services[ins.Name]; !ok {
+		r.services[ins.Name] = make(map[string]*ServiceInstance)
+	}
+	r.services[ins.Name][ins.id()] = ins
+	r.notify(ins.Name)
+	return nil
+}
+
+func (r *staticRegistry) Heartbeat(ctx context.Context, ins *ServiceInstance, ttl time.Duration) error {
+	return nil
+}
+
+func (r *staticRegistry) Deregister(ctx context.Context, ins *ServiceInstance) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.services[ins.Name], ins.id())
+	r.notify(ins.Name)
+	return nil
+}
+
+func (r *staticRegistry) Watch(ctx context.Context, name string) (<-chan []*ServiceInstance, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ch := make(chan []*ServiceInstance, 1)
+	ch <- r.list(name)
+	r.watchers[name] = append(r.watchers[name], ch)
+	go func() {
+		<-ctx.Done()
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		ws := r.watchers[name]
+		for i := range ws {
+			if ws[i] == ch {
+				r.watchers[name] = append(ws[:i], ws[i+1:]...)
+				break
+			}
+		}
+		close(ch)
+	}()
+	return ch, nil
+}
+
+func (r *staticRegistry) list(name string) []*ServiceInstance {
+	ins := make([]*ServiceInstance, 0, len(r.services[name]))
+	for _, i := range r.services[name] {
+		ins = append(ins, i)
+	}
+	return sortInstances(ins)
+}
+
+// notify 持有锁调用, 丢弃未消费的旧快照
+func (r *staticRegistry) notify(name string) {
+	ins := r.list(name)
+	for _, ch := range r.watchers[name] {
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- ins
+	}
+}
+
+type RegistryOption = Option[registryOptions]
+
+func WithRegistryPrefix(prefix string) RegistryOption {
+	return newFuncOption(func(o *registryOptions) {
+		o.prefix = prefix
+	})
+}
+
+// WithRegistryInterval 监听轮询间隔
+func WithRegistryInterval(interval time.Duration) RegistryOption {
+	return newFuncOption(func(o *registryOptions) {
+		o.interval = interval
+	})
+}
+
+type registryOptions struct {
+	prefix   string        // 缓存键前缀
+	interval time.Duration // 轮询间隔
+}
+
+var defaultRegistryOptions = registryOptions{
+	prefix:   "3rd:registry",
+	interval: 3 * time.Second,
+}
+
+var _ Registry = (*redisRegistry)(nil)
+
+// redisRegistry 每个服务一个hash, field为实例id, value为实例及过期时间
+type redisRegistry struct {
+	opts   registryOptions
+	logger logx.ILogger
+	cacher dbx.Cacher
+}
+
+type registryRecord struct {
+	Instance *ServiceInstance `json:"instance"`
+	Deadline int64            `json:"deadline"` // 过期时间 毫秒
+}
+
+func NewRedisRegistry(ctx context.Context, logger logx.ILogger, cacher dbx.Cacher, opt ...RegistryOption) Registry {
+	opts := defaultRegistryOptions
+	for _, o := range opt {
+		o.apply(&opts)
+	}
+	return &redisRegistry{opts: opts, logger: logger, cacher: cacher}
+}
+
+func (r *redisRegistry) hash(ctx context.Context, name string, ttl time.Duration) dbx.HashCacher {
+	// 服务长期无心跳时整体过期
+	return r.cacher.CreateHashCacher(ctx, fmt.Sprintf("%s:%s", r.opts.prefix, name), 10*ttl)
+}
+
+func (r *redisRegistry) Register(ctx context.Context, ins *ServiceInstance, ttl time.Duration) error {
+	buf, err := json.Marshal(&registryRecord{Instance: ins, Deadline: time.Now().Add(ttl).UnixNano() / 1e6})
+	if err != nil {
+		return err
+	}
+	err = r.hash(ctx, ins.Name, ttl).Set(ctx, x.NewBuilder(x.WithKV(ins.id(), string(buf))))
+	if err != nil {
+		r.logger.Errorw(ctx, "registry: register failed", "err", err, "service", ins.Name, "addr", ins.Addr())
+		return err
+	}
+	return nil
+}
+
+func (r *redisRegistry) Heartbeat(ctx context.Context, ins *ServiceInstance, ttl time.Duration) error {
+	return r.Register(ctx, ins, ttl)
+}
+
+func (r *redisRegistry) Deregister(ctx context.Context, ins *ServiceInstance) error {
+	err := r.hash(ctx, ins.Name, 0).Del(ctx, ins.id())
+	if err != nil {
+		r.logger.Errorw(ctx, "registry: deregister failed", "err", err, "service", ins.Name, "addr", ins.Addr())
+		return err
+	}
+	r.logger.Infow(ctx, "registry: deregister success", "service", ins.Name, "addr", ins.Addr())
+	return nil
+}
+
+func (r *redisRegistry) Watch(ctx context.Context, name string) (<-chan []*ServiceInstance, error) {
+	ins, err := r.list(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan []*ServiceInstance, 1)
+	ch <- ins
+	go func() {
+		t := time.NewTicker(r.opts.interval)
+		defer t.Stop()
+		defer close(ch)
+		last := ins
+		for {
+			select {
+			case <-ctx.Done():
+				return
+
+			case <-t.C:
+				ins, err := r.list(ctx, name)
+				if err != nil || sameInstances(last, ins) {
+					continue
+				}
+				r.logger.Infow(ctx, "registry: service changed", "service", name, "count", len(ins))
+				last = ins
+				select {
+				case ch <- ins:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// list 过滤已过期的实例
+func (r *redisRegistry) list(ctx context.Context, name string) ([]*ServiceInstance, error) {
+	b, err := r.hash(ctx, name, 0).GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		now     = time.Now().UnixNano() / 1e6
+		ins     = []*ServiceInstance{}
+		expired = []string{}
+	)
+	for id, v := range b.Build() {
+		record := &registryRecord{}
+		err = json.Unmarshal([]byte(fmt.Sprint(v)), record)
+		if err != nil || record.Instance == nil {
+			r.logger.Warnw(ctx, "registry: invalid record", "service", name, "id", id, "err", err)
+			continue
+		}
+		if record.Deadline < now {
+			expired = append(expired, id)
+			continue
+		}
+		ins = append(ins, record.Instance)
+	}
+	// 清理异常退出未注销的实例, 存活实例下次心跳会重新写入
+	if len(expired) > 0 {
+		err = r.hash(ctx, name, 0).Del(ctx, expired...)
+		if err != nil {
+			r.logger.Warnw(ctx, "registry: remove expired failed", "err", err, "service", name, "ids", expired)
+		}
+	}
+	return sortInstances(ins), nil
+}
+
+// advertiseHost 监听全部地址时使用本机首个非回环IPv4注册
+func advertiseHost(host string) string {
+	if len(host) > 0 && host != "0.0.0.0" && host != "::" {
+		return host
+	}
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return "127.0.0.1"
+	}
+	for _, a := range addrs {
+		if ip, ok := a.(*net.IPNet); ok && !ip.IP.IsLoopback() && ip.IP.To4() != nil {
+			return ip.IP.String()
+		}
+	}
+	return "127.0.0.1"
+}
+
+// selfRegister 注册服务并定期心跳, 返回注销函数
+func selfRegister(ctx context.Context, logger logx.ILogger, opts serverOptions, scheme string) func() {
+	if opts.registry == nil {
+		return func() {}
+	}
+	var (
+		ttl = opts.registryTTL
+		ins = &ServiceInstance{
+			Name:     opts.name,
+			Host:     advertiseHost(opts.host),
+			Port:     opts.port,
+			Metadata: map[string]string{"scheme": scheme},
+		}
+		hctx, cancel = context.WithCancel(ctx)
+	)
+	err := opts.registry.Register(ctx, ins, ttl)
+	if err != nil {
+		logger.Errorw(ctx, "registry: self register failed", "err", err, "service", ins.Name, "addr", ins.Addr())
+	} else {
+		logger.Infow(ctx, "registry: self register success", "service", ins.Name, "addr", ins.Addr())
+	}
+	go func() {
+		t := time.NewTicker(ttl / 3)
+		defer t.Stop()
+		for {
+			select {
+			case <-hctx.Done():
+				return
+			case <-t.C:
+				err := opts.registry.Heartbeat(hctx, ins, ttl)
+				if err != nil {
+					logger.Errorw(hctx, "registry: heartbeat failed", "err", err, "service", ins.Name, "addr", ins.Addr())
+				}
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		// 根上下文已取消, 使用独立上下文注销
+		dctx, dcancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer dcancel()
+		opts.registry.Deregister(dctx, ins)
+	}
+}
@@ -0,0 +1,180 @@
+package netx
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/advancevillage/3rd/logx"
+	"github.com/advancevillage/3rd/x"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/resolver"
+)
+
+func Test_static_registry(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	var (
+		a   = &ServiceInstance{Name: "account", Host: "10.0.0.1", Port: 80}
+		b   = &ServiceInstance{Name: "account", Host: "10.0.0.2", Port: 80}
+		reg = NewStaticRegistry(a)
+	)
+	ch, err := reg.Watch(ctx, "account")
+	assert.Nil(t, err)
+	assert.Equal(t, []*ServiceInstance{a}, <-ch)
+
+	assert.Nil(t, reg.Register(ctx, b, time.Second))
+	assert.Equal(t, []*ServiceInstance{a, b}, <-ch)
+
+	assert.Nil(t, reg.Deregister(ctx, a))
+	assert.Equal(t, []*ServiceInstance{b}, <-ch)
+
+	cancel()
+	_, ok := <-ch
+	assert.False(t, ok)
+}
+
+type testResolverClientConn struct {
+	resolver.ClientConn
+	mu    sync.Mutex
+	addrs []string
+}
+
+func (c *testResolverClientConn) UpdateState(s resolver.State) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.addrs = c.addrs[:0]
+	for _, a := range s.Addresses {
+		c.addrs = append(c.addrs, a.Addr)
+	}
+	return nil
+}
+
+func (c *testResolverClientConn) ReportError(err error) {}
+
+func (c *testResolverClientConn) Addrs() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string{}, c.addrs...)
+}
+
+func Test_registry_resolver(t *testing.T) {
+	logger, err := logx.NewLogger("debug")
+	assert.Nil(t, err)
+
+	var (
+		reg = NewStaticRegistry(&ServiceInstance{Name: "account", Host: "10.0.0.1", Port: 13147})
+		b   = newRegistryResolverBuilder(reg, logger)
+		cc  = &testResolverClientConn{}
+	)
+	u, err := url.Parse("registry:///account")
+	assert.Nil(t, err)
+	r, err := b.Build(resolver.Target{URL: *u}, cc, resolver.BuildOptions{})
+	assert.Nil(t, err)
+	defer r.Close()
+
+	assert.Eventually(t, func() bool { return len(cc.Addrs()) == 1 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"10.0.0.1:13147"}, cc.Addrs())
+
+	reg.Register(context.TODO(), &ServiceInstance{Name: "account", Host: "10.0.0.2", Port: 13147}, time.Second)
+	assert.Eventually(t, func() bool { return len(cc.Addrs()) == 2 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"10.0.0.1:13147", "10.0.0.2:13147"}, cc.Addrs())
+}
+
+func Test_registry_http(t *testing.T) {
+	logger, err := logx.NewLogger("debug")
+	assert.Nil(t, err)
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	var (
+		reg  = NewStaticRegistry()
+		seen = map[string]int{}
+	)
+	for _, name := range []string{"u1", "u2"} {
+		name := name
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name + r.URL.Path))
+		}))
+		defer srv.Close()
+		u, err := url.Parse(srv.URL)
+		assert.Nil(t, err)
+		port, err := strconv.Atoi(u.Port())
+		assert.Nil(t, err)
+		reg.Register(ctx, &ServiceInstance{Name: "account", Host: u.Hostname(), Port: port}, time.Second)
+	}
+
+	c, err := NewHttpClient(ctx, logger, WithClientRegistry(reg))
+	assert.Nil(t, err)
+	for i := 0; i < 4; i++ {
+		r, err := c.Get(ctx, "registry://account/profile", x.NewBuilder(), x.NewBuilder())
+		assert.Nil(t, err)
+		seen[string(r.Body())] += 1
+	}
+	assert.Equal(t, map[string]int{"u1/profile": 2, "u2/profile": 2}, seen)
+
+	_, err = c.Get(ctx, "registry://missing/profile", x.NewBuilder(), x.NewBuilder())
+	assert.ErrorIs(t, err, ErrServiceNotFound)
+}
+
+func Test_registry_ttl(t *testing.T) {
+	logger, err := logx.NewLogger("debug")
+	assert.Nil(t, err)
+
+	var data = map[string]struct {
+		ttl time.Duration
+		exp time.Duration
+	}{
+		"case-zero":     {ttl: 0, exp: 15 * time.Second},
+		"case-negative": {ttl: -time.Second, exp: 15 * time.Second},
+		"case-tiny":     {ttl: time.Nanosecond, exp: time.Second},
+		"case-normal":   {ttl: 30 * time.Second, exp: 30 * time.Second},
+	}
+	for n, v := range data {
+		f := func(t *testing.T) {
+			opts := defaultServerOptions
+			WithServerRegistry(NewStaticRegistry(), v.ttl).apply(&opts)
+			assert.Equal(t, v.exp, opts.registryTTL)
+
+			// 心跳协程不能因ttl异常panic
+			deregister := selfRegister(context.TODO(), logger, opts, "http")
+			deregister()
+		}
+		t.Run(n, f)
+	}
+}
+
+func Test_registry_expired(t *testing.T) {
+	logger, err := logx.NewLogger("debug")
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	var (
+		cache = newTestMemCache()
+		reg   = NewRedisRegistry(ctx, logger, cache)
+		live  = &ServiceInstance{Name: "account", Host: "10.0.0.1", Port: 80}
+		dead  = &ServiceInstance{Name: "account", Host: "10.0.0.2", Port: 80}
+	)
+	assert.Nil(t, reg.Register(ctx, live, time.Minute))
+	assert.Nil(t, reg.Register(ctx, dead, time.Millisecond))
+	time.Sleep(5 * time.Millisecond)
+
+	// 过期实例不返回且从hash中删除
+	ch, err := reg.Watch(ctx, "account")
+	assert.Nil(t, err)
+	assert.Equal(t, []*ServiceInstance{live}, <-ch)
+	b, err := cache.CreateHashCacher(ctx, "3rd:registry:account", 0).GetAll(ctx)
+	assert.Nil(t, err)
+	_, ok := b.Value(dead.id())
+	assert.False(t, ok)
+	_, ok = b.Value(live.id())
+	assert.True(t, ok)
+}
@@ -0,0 +1,153 @@
+package netx
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync"
+	"sync/atomic"
+
+	"github.com/advancevillage/3rd/logx"
+	"google.golang.org/grpc/attributes"
+	"google.golang.org/grpc/resolver"
+)
+
+var _ resolver.Builder = (*registryResolverBuilder)(nil)
+
+// registryResolverBuilder gRPC解析 registry:///service-name
+type registryResolverBuilder struct {
+	reg    Registry
+	logger logx.ILogger
+}
+
+func newRegistryResolverBuilder(reg Registry, logger logx.ILogger) resolver.Builder {
+	return &registryResolverBuilder{reg: reg, logger: logger}
+}
+
+func (b *registryResolverBuilder) Scheme() string {
+	return RegistryScheme
+}
+
+func (b *registryResolverBuilder) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOptions) (resolver.Resolver, error) {
+	var (
+		name        = target.Endpoint()
+		ctx, cancel = context.WithCancel(context.Background())
+	)
+	ch, err := b.reg.Watch(ctx, name)
+	if err != nil {
+		cancel()
+		b.logger.Errorw(ctx, "registry: grpc resolver watch failed", "err", err, "service", name)
+		return nil, err
+	}
+	go func() {
+		for ins := range ch {
+			if len(ins) <= 0 {
+				b.logger.Warnw(ctx, "registry: grpc resolver no instance", "service", name)
+				cc.ReportError(fmt.Errorf("%w: %s", ErrServiceNotFound, name))
+				continue
+			}
+			addrs := make([]resolver.Address, 0, len(ins))
+			for _, i := range ins {
+				addrs = append(addrs, resolver.Address{
+					Addr:       i.Addr(),
+					Attributes: attributes.New(ctxKeyServiceInstance{}, i.id()),
+				})
+			}
+			err := cc.UpdateState(resolver.State{Addresses: addrs})
+			if err != nil {
+				b.logger.Warnw(ctx, "registry: grpc resolver update failed", "err", err, "service", name)
+			}
+		}
+	}()
+	return &registryResolver{cancel: cancel}, nil
+}
+
+type ctxKeyServiceInstance struct{}
+
+var _ resolver.Resolver = (*registryResolver)(nil)
+
+type registryResolver struct {
+	cancel context.CancelFunc
+}
+
+// ResolveNow 由Watch主动推送, 无需处理
+func (r *registryResolver) ResolveNow(resolver.ResolveNowOptions) {}
+
+func (r *registryResolver) Close() {
+	r.cancel()
+}
+
+// registryPicker http客户端按 registry://service-name/path 轮询选择实例
+// 订阅协程随ctx结束, 没有单独的Close
+type registryPicker struct {
+	ctx    context.Context
+	reg    Registry
+	logger logx.ILogger
+
+	mu       sync.Mutex
+	services map[string]*atomic.Value // name -> []*ServiceInstance
+	n        uint64
+}
+
+func newRegistryPicker(ctx context.Context, logger logx.ILogger, reg Registry) *registryPicker {
+	return &registryPicker{
+		ctx:      ctx,
+		reg:      reg,
+		logger:   logger,
+		services: make(map[string]*atomic.Value),
+	}
+}
+
+// resolve 将registry地址替换为实例地址, 其余地址原样返回
+func (p *registryPicker) resolve(uri string) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != RegistryScheme || p.reg == nil {
+		return uri, nil
+	}
+	ins, err := p.pick(u.Host)
+	if err != nil {
+		return "", err
+	}
+	u.Scheme = "http"
+	if s, ok := ins.Metadata["scheme"]; ok && (s == "http" || s == "https") {
+		u.Scheme = s
+	}
+	u.Host = ins.Addr()
+	return u.String(), nil
+}
+
+func (p *registryPicker) pick(name string) (*ServiceInstance, error) {
+	v, err := p.watch(name)
+	if err != nil {
+		return nil, err
+	}
+	ins, _ := v.Load().([]*ServiceInstance)
+	if len(ins) <= 0 {
+		return nil, fmt.Errorf("%w: %s", ErrServiceNotFound, name)
+	}
+	n := atomic.AddUint64(&p.n, 1)
+	return ins[(n-1)%uint64(len(ins))], nil
+}
+
+// watch 首次使用时订阅服务变化
+func (p *registryPicker) watch(name string) (*atomic.Value, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if v, ok := p.services[name]; ok {
+		return v, nil
+	}
+	ch, err := p.reg.Watch(p.ctx, name)
+	if err != nil {
+		p.logger.Errorw(p.ctx, "registry: http picker watch failed", "err", err, "service", name)
+		return nil, err
+	}
+	v := &atomic.Value{}
+	v.Store(<-ch)
+	go func() {
+		for ins := range ch {
+			v.Store(ins)
+		}
+	}()
+	p.services[name] = v
+	return v, nil
+}
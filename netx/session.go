@@ -0,0 +1,620 @@
+package netx
+
+import (
+	"context"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/advancevillage/3rd/cryptox/sm4"
+	"github.com/advancevillage/3rd/dbx"
+	"github.com/advancevillage/3rd/logx"
+	"github.com/advancevillage/3rd/x"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+const (
+	X_CSRF_Token = "X-CSRF-Token"
+
+	sessionCsrfKey = "_csrf"
+)
+
+var (
+	ErrSessionCookieInvalid = errors.New("session: invalid cookie")
+	ErrSessionCsrfInvalid   = errors.New("session: invalid csrf token")
+)
+
+// Session 请求上下文中的会话, 请求结束后由中间件统一保存
+type Session interface {
+	Id() string
+	Get(key string) (string, bool)
+	Set(key string, value string)
+	Delete(key string)
+	// Regenerate 更换会话id并保留数据, 登录等权限变化后调用防止会话固定
+	Regenerate()
+	// Destroy 清空数据并删除cookie
+	Destroy()
+	// CsrfToken 返回会话的CSRF令牌, 不存在时生成
+	CsrfToken() string
+	VerifyCsrfToken(token string) bool
+}
+
+type ctxKeySession struct{}
+
+// SessionFromContext 获取会话中间件注入的会话
+func SessionFromContext(ctx context.Context) (Session, bool) {
+	s, ok := ctx.Value(ctxKeySession{}).(Session)
+	return s, ok
+}
+
+// SessionStore 会话存储, Load在会话不存在或已过期时返回nil
+type SessionStore interface {
+	Load(ctx context.Context, id string) (map[string]string, error)
+	Save(ctx context.Context, id string, data map[string]string, ttl time.Duration) error
+	Delete(ctx context.Context, id string) error
+}
+
+type SessionOption = Option[sessionOptions]
+
+// WithSessionSecret cookie签名密钥
+func WithSessionSecret(secret []byte) SessionOption {
+	return newFuncOption(func(o *sessionOptions) {
+		o.secret = secret
+	})
+}
+
+// WithSessionEncryptKey cookie加密密钥, 16字节, 使用SM4-GCM加密会话id
+func WithSessionEncryptKey(key []byte) SessionOption {
+	return newFuncOption(func(o *sessionOptions) {
+		o.encryptKey = key
+	})
+}
+
+// WithSessionTTL 会话空闲超时, 每次请求顺延
+func WithSessionTTL(ttl time.Duration) SessionOption {
+	return newFuncOption(func(o *sessionOptions) {
+		o.ttl = ttl
+	})
+}
+
+func WithSessionCookieName(name string) SessionOption {
+	return newFuncOption(func(o *sessionOptions) {
+		o.name = name
+	})
+}
+
+func WithSessionCookieDomain(domain string) SessionOption {
+	return newFuncOption(func(o *sessionOptions) {
+		o.domain = domain
+	})
+}
+
+func WithSessionCookiePath(path string) SessionOption {
+	return newFuncOption(func(o *sessionOptions) {
+		o.path = path
+	})
+}
+
+// WithSessionCookieSecure 仅https传输cookie
+func WithSessionCookieSecure(secure bool) SessionOption {
+	return newFuncOption(func(o *sessionOptions) {
+		o.secure = secure
+	})
+}
+
+func WithSessionCookieSameSite(sameSite http.SameSite) SessionOption {
+	return newFuncOption(func(o *sessionOptions) {
+		o.sameSite = sameSite
+	})
+}
+
+// WithSessionCsrf 非安全方法须在请求头X-CSRF-Token或表单_csrf中携带令牌
+func WithSessionCsrf() SessionOption {
+	return newFuncOption(func(o *sessionOptions) {
+		o.csrf = true
+	})
+}
+
+type sessionOptions struct {
+	secret     []byte        // 签名密钥
+	encryptKey []byte        // 加密密钥
+	ttl        time.Duration // 空闲超时
+	name       string        // cookie名称
+	domain     string        // cookie域名
+	path       string        // cookie路径
+	secure     bool          // 仅https
+	sameSite   http.SameSite // 跨站策略
+	csrf       bool          // CSRF校验
+}
+
+var defaultSessionOptions = sessionOptions{
+	ttl:      30 * time.Minute,
+	name:     "3rd_session",
+	path:     "/",
+	secure:   true,
+	sameSite: http.SameSiteLaxMode,
+	csrf:     false,
+}
+
+type sessionSrv struct {
+	opts   sessionOptions
+	logger logx.ILogger
+	store  SessionStore
+	aead   cipher.AEAD
+}
+
+// NewSessionMiddleware cookie会话, cookie仅保存签名或加密后的会话id, 数据保存在store中
+func NewSessionMiddleware(ctx context.Context, logger logx.ILogger, store SessionStore, opt ...SessionOption) (HttpMiddleware, error) {
+	opts := defaultSessionOptions
+	for _, o := range opt {
+		o.apply(&opts)
+	}
+	s := &sessionSrv{opts: opts, logger: logger, store: store}
+	if len(opts.secret) <= 0 && len(opts.encryptKey) <= 0 {
+		return nil, errors.New("session: secret or encrypt key required")
+	}
+	if len(opts.encryptKey) > 0 {
+		block, err := sm4.NewCipher(opts.encryptKey)
+		if err != nil {
+			return nil, err
+		}
+		s.aead, err = cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return s.wrap, nil
+}
+
+func (s *sessionSrv) wrap(f HttpRegister) HttpRegister {
+	return func(ctx context.Context, r *http.Request) (HttpResponse, error) {
+		// 1. 加载会话
+		sess := s.load(ctx, r)
+		ctx = context.WithValue(ctx, ctxKeySession{}, Session(sess))
+
+		// 2. CSRF校验
+		if s.opts.csrf && !isSafeMethod(r.Method) {
+			token := r.Header.Get(X_CSRF_Token)
+			if len(token) <= 0 {
+				token = r.PostFormValue(sessionCsrfKey)
+			}
+			if !sess.VerifyCsrfToken(token) {
+				s.logger.Warnw(ctx, "session: csrf token mismatch", "method", r.Method)
+				return NewForbiddenHttpResponse(ErrSessionCsrfInvalid), nil
+			}
+		}
+
+		// 3. 执行请求
+		reply, err := f(ctx, r)
+		if err != nil {
+			return nil, err
+		}
+
+		// 4. 保存会话
+		cookie, err := s.save(ctx, sess)
+		if err != nil {
+			return nil, err
+		}
+		if cookie != nil {
+			reply.Header().Add("Set-Cookie", cookie.String())
+		}
+		return reply, nil
+	}
+}
+
+func (s *sessionSrv) load(ctx context.Context, r *http.Request) *session {
+	c, err := r.Cookie(s.opts.name)
+	if err != nil {
+		return newSession()
+	}
+	id, err := s.decode(c.Value)
+	if err != nil {
+		s.logger.Warnw(ctx, "session: decode cookie failed", "err", err)
+		return newSession()
+	}
+	data, err := s.store.Load(ctx, id)
+	if err != nil {
+		s.logger.Errorw(ctx, "session: load failed", "err", err)
+		return newSession()
+	}
+	if data == nil {
+		return newSession()
+	}
+	return &session{id: id, data: data}
+}
+
+// save 返回需要写出的cookie, 无需写出时返回nil
+func (s *sessionSrv) save(ctx context.Context, sess *session) (*http.Cookie, error) {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+
+	// 1. 删除旧会话
+	for _, id := range sess.stale {
+		err := s.store.Delete(ctx, id)
+		if err != nil {
+			s.logger.Errorw(ctx, "session: delete failed", "err", err)
+			return nil, err
+		}
+	}
+
+	// 2. 销毁会话
+	if sess.destroyed {
+		if sess.isNew && len(sess.stale) <= 0 {
+			return nil, nil
+		}
+		return s.cookie("", -1), nil
+	}
+
+	// 3. 空会话不保存
+	if len(sess.data) <= 0 {
+		if sess.isNew {
+			return nil, nil
+		}
+		err := s.store.Delete(ctx, sess.id)
+		if err != nil {
+			return nil, err
+		}
+		return s.cookie("", -1), nil
+	}
+
+	// 4. 保存并顺延有效期
+	err := s.store.Save(ctx, sess.id, sess.data, s.opts.ttl)
+	if err != nil {
+		s.logger.Errorw(ctx, "session: save failed", "err", err)
+		return nil, err
+	}
+	value, err := s.encode(sess.id)
+	if err != nil {
+		return nil, err
+	}
+	return s.cookie(value, int(s.opts.ttl.Seconds())), nil
+}
+
+func (s *sessionSrv) cookie(value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     s.opts.name,
+		Value:    value,
+		Path:     s.opts.path,
+		Domain:   s.opts.domain,
+		MaxAge:   maxAge,
+		Secure:   s.opts.secure,
+		HttpOnly: true,
+		SameSite: s.opts.sameSite,
+	}
+}
+
+// encode 加密 base64(nonce|密文), 签名 id.base64(hmac)
+func (s *sessionSrv) encode(id string) (string, error) {
+	if s.aead != nil {
+		nonce := make([]byte, s.aead.NonceSize())
+		_, err := rand.Read(nonce)
+		if err != nil {
+			return "", err
+		}
+		return base64.RawURLEncoding.EncodeToString(s.aead.Seal(nonce, nonce, []byte(id), []byte(s.opts.name))), nil
+	}
+	return fmt.Sprintf("%s.%s", id, base64.RawURLEncoding.EncodeToString(s.sign(id))), nil
+}
+
+func (s *sessionSrv) decode(value string) (string, error) {
+	if s.aead != nil {
+		buf, err := base64.RawURLEncoding.DecodeString(value)
+		if err != nil || len(buf) < s.aead.NonceSize() {
+			return "", ErrSessionCookieInvalid
+		}
+		id, err := s.aead.Open(nil, buf[:s.aead.NonceSize()], buf[s.aead.NonceSize():], []byte(s.opts.name))
+		if err != nil {
+			return "", ErrSessionCookieInvalid
+		}
+		return string(id), nil
+	}
+	id, sig, ok := strings.Cut(value, ".")
+	if !ok {
+		return "", ErrSessionCookieInvalid
+	}
+	buf, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(buf, s.sign(id)) {
+		return "", ErrSessionCookieInvalid
+	}
+	return id, nil
+}
+
+func (s *sessionSrv) sign(id string) []byte {
+	h := hmac.New(sha256.New, s.opts.secret)
+	h.Write([]byte(id))
+	return h.Sum(nil)
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+
+	default:
+		return false
+	}
+}
+
+func randomToken() string {
+	buf := make([]byte, 32)
+	rand.Read(buf)
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+var _ Session = (*session)(nil)
+
+type session struct {
+	mu        sync.Mutex
+	id        string
+	data      map[string]string
+	stale     []string // 需要删除的旧会话id
+	isNew     bool     // 本次请求新建
+	destroyed bool     // 已销毁
+}
+
+func newSession() *session {
+	return &session{id: randomToken(), data: make(map[string]string), isNew: true}
+}
+
+func (s *session) Id() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.id
+}
+
+func (s *session) Get(key string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.data[key]
+	return v, ok
+}
+
+func (s *session) Set(key string, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data[key] = value
+	s.destroyed = false
+}
+
+func (s *session) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.data, key)
+}
+
+func (s *session) Regenerate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.isNew {
+		s.stale = append(s.stale, s.id)
+	}
+	s.id, s.isNew = randomToken(), true
+	// 同时更换CSRF令牌
+	delete(s.data, sessionCsrfKey)
+}
+
+func (s *session) Destroy() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.isNew {
+		s.stale = append(s.stale, s.id)
+	}
+	s.id, s.isNew, s.destroyed = randomToken(), true, true
+	s.data = make(map[string]string)
+}
+
+func (s *session) CsrfToken() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	token, ok := s.data[sessionCsrfKey]
+	if !ok {
+		token = randomToken()
+		s.data[sessionCsrfKey] = token
+		s.destroyed = false
+	}
+	return token
+}
+
+func (s *session) VerifyCsrfToken(token string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	expect, ok := s.data[sessionCsrfKey]
+	if !ok || len(token) <= 0 {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(expect), []byte(token)) == 1
+}
+
+var _ SessionStore = (*memorySessionStore)(nil)
+
+type memorySessionEntry struct {
+	data     map[string]string
+	deadline time.Time
+}
+
+type memorySessionStore struct {
+	mu      sync.Mutex
+	entries map[string]*memorySessionEntry
+}
+
+// NewMemorySessionStore 进程内存储, 仅用于单实例或测试
+func NewMemorySessionStore() SessionStore {
+	return &memorySessionStore{entries: make(map[string]*memorySessionEntry)}
+}
+
+func (m *memorySessionStore) Load(ctx context.Context, id string) (map[string]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.entries[id]
+	if !ok {
+		return nil, nil
+	}
+	if time.Now().After(e.deadline) {
+		delete(m.entries, id)
+		return nil, nil
+	}
+	data := make(map[string]string, len(e.data))
+	for k, v := range e.data {
+		data[k] = v
+	}
+	return data, nil
+}
+
+func (m *memorySessionStore) Save(ctx context.Context, id string, data map[string]string, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// 顺带清理过期会话
+	now := time.Now()
+	for k, e := range m.entries {
+		if now.After(e.deadline) {
+			delete(m.entries, k)
+		}
+	}
+	cp := make(map[string]string, len(data))
+	for k, v := range data {
+		cp[k] = v
+	}
+	m.entries[id] = &memorySessionEntry{data: cp, deadline: now.Add(ttl)}
+	return nil
+}
+
+func (m *memorySessionStore) Delete(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.entries, id)
+	return nil
+}
+
+var _ SessionStore = (*redisSessionStore)(nil)
+
+// redisSessionStore 每个会话一个hash, 有效期由key过期时间控制
+type redisSessionStore struct {
+	cacher dbx.Cacher
+	prefix string
+}
+
+func NewRedisSessionStore(cacher dbx.Cacher, prefix string) SessionStore {
+	return &redisSessionStore{cacher: cacher, prefix: prefix}
+}
+
+func (m *redisSessionStore) hash(ctx context.Context, id string, ttl time.Duration) dbx.HashCacher {
+	return m.cacher.CreateHashCacher(ctx, fmt.Sprintf("%s:%s", m.prefix, id), ttl)
+}
+
+func (m *redisSessionStore) Load(ctx context.Context, id string) (map[string]string, error) {
+	b, err := m.hash(ctx, id, 0).GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	kv := b.Build()
+	if len(kv) <= 0 {
+		return nil, nil
+	}
+	data := make(map[string]string, len(kv))
+	for k, v := range kv {
+		data[k] = fmt.Sprint(v)
+	}
+	return data, nil
+}
+
+func (m *redisSessionStore) Save(ctx context.Context, id string, data map[string]string, ttl time.Duration) error {
+	var (
+		h   = m.hash(ctx, id, ttl)
+		del = []string{}
+		kv  = make([]x.Option, 0, len(data))
+	)
+	// 1. 删除已移除的字段
+	b, err := h.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+	for k := range b.Build() {
+		if _, ok := data[k]; !ok {
+			del = append(del, k)
+		}
+	}
+	err = h.Del(ctx, del...)
+	if err != nil {
+		return err
+	}
+	// 2. 写入并刷新过期时间
+	for k, v := range data {
+		kv = append(kv, x.WithKV(k, v))
+	}
+	return h.Set(ctx, x.NewBuilder(kv...))
+}
+
+func (m *redisSessionStore) Delete(ctx context.Context, id string) error {
+	h := m.hash(ctx, id, 0)
+	b, err := h.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+	fields := []string{}
+	for k := range b.Build() {
+		fields = append(fields, k)
+	}
+	return h.Del(ctx, fields...)
+}
+
+var _ SessionStore = (*levelSessionStore)(nil)
+
+// levelSessionStore LevelDB存储, 过期时间随数据保存, 读取时判断
+type levelSessionStore struct {
+	db     dbx.ILevelDB
+	prefix string
+}
+
+type levelSessionRecord struct {
+	Data     map[string]string `json:"data"`
+	Deadline int64             `json:"deadline"` // 过期时间 毫秒
+}
+
+func NewLevelDBSessionStore(db dbx.ILevelDB, prefix string) SessionStore {
+	return &levelSessionStore{db: db, prefix: prefix}
+}
+
+func (m *levelSessionStore) key(id string) []byte {
+	return []byte(fmt.Sprintf("%s:%s", m.prefix, id))
+}
+
+func (m *levelSessionStore) Load(ctx context.Context, id string) (map[string]string, error) {
+	buf, err := m.db.Get(m.key(id))
+	if errors.Is(err, leveldb.ErrNotFound) || len(buf) <= 0 {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	record := &levelSessionRecord{}
+	err = json.Unmarshal(buf, record)
+	if err != nil {
+		return nil, err
+	}
+	if record.Deadline < time.Now().UnixNano()/1e6 {
+		return nil, m.db.Del(m.key(id))
+	}
+	return record.Data, nil
+}
+
+func (m *levelSessionStore) Save(ctx context.Context, id string, data map[string]string, ttl time.Duration) error {
+	buf, err := json.Marshal(&levelSessionRecord{Data: data, Deadline: time.Now().Add(ttl).UnixNano() / 1e6})
+	if err != nil {
+		return err
+	}
+	return m.db.Put(m.key(id), buf)
+}
+
+func (m *levelSessionStore) Delete(ctx context.Context, id string) error {
+	return m.db.Del(m.key(id))
+}
@@ -0,0 +1,137 @@
+package netx
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/advancevillage/3rd/dbx"
+	"github.com/advancevillage/3rd/logx"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_session(t *testing.T) {
+	logger, err := logx.NewLogger("debug")
+	assert.Nil(t, err)
+	ldb, err := dbx.NewMemoryStore()
+	assert.Nil(t, err)
+
+	var data = map[string]struct {
+		store SessionStore
+		opts  []SessionOption
+	}{
+		"case-memory-signed": {
+			store: NewMemorySessionStore(),
+			opts:  []SessionOption{WithSessionSecret([]byte("secret"))},
+		},
+		"case-leveldb-encrypted": {
+			store: NewLevelDBSessionStore(ldb, "session"),
+			opts:  []SessionOption{WithSessionEncryptKey([]byte("0123456789abcdef"))},
+		},
+	}
+
+	for n, v := range data {
+		f := func(t *testing.T) {
+			mw, err := NewSessionMiddleware(context.TODO(), logger, v.store, append(v.opts, WithSessionCsrf())...)
+			assert.Nil(t, err)
+
+			sess := func(ctx context.Context) Session {
+				s, ok := SessionFromContext(ctx)
+				assert.True(t, ok)
+				return s
+			}
+			s, err := newHttpSrv(context.TODO(), logger,
+				WithHttpService(http.MethodGet, "/login", mw(func(ctx context.Context, r *http.Request) (HttpResponse, error) {
+					s := sess(ctx)
+					s.Regenerate()
+					s.Set("user", r.URL.Query().Get("user"))
+					return NewStatusOkHttpResponse(map[string]string{"csrf": s.CsrfToken()}, nil), nil
+				})),
+				WithHttpService(http.MethodGet, "/me", mw(func(ctx context.Context, r *http.Request) (HttpResponse, error) {
+					user, ok := sess(ctx).Get("user")
+					if !ok {
+						return NewUnauthorizedHttpResponse(ErrSessionCookieInvalid), nil
+					}
+					return NewStatusOkHttpResponse(user, nil), nil
+				})),
+				WithHttpService(http.MethodPost, "/logout", mw(func(ctx context.Context, r *http.Request) (HttpResponse, error) {
+					sess(ctx).Destroy()
+					return NewEmptyResonse(), nil
+				})),
+			)
+			assert.Nil(t, err)
+
+			do := func(method, path string, hdr map[string]string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+				req := httptest.NewRequest(method, path, nil)
+				for k, v := range hdr {
+					req.Header.Set(k, v)
+				}
+				for _, c := range cookies {
+					req.AddCookie(c)
+				}
+				rec := httptest.NewRecorder()
+				s.srv.ServeHTTP(rec, req)
+				return rec
+			}
+			cookieOf := func(rec *httptest.ResponseRecorder) *http.Cookie {
+				for _, c := range rec.Result().Cookies() {
+					if c.Name == "3rd_session" {
+						return c
+					}
+				}
+				return nil
+			}
+
+			// 1. 未登录
+			rec := do(http.MethodGet, "/me", nil)
+			assert.Equal(t, http.StatusUnauthorized, rec.Code)
+			assert.Nil(t, cookieOf(rec))
+
+			// 2. 登录
+			rec = do(http.MethodGet, "/login?user=pyro", nil)
+			assert.Equal(t, http.StatusOK, rec.Code)
+			c1 := cookieOf(rec)
+			assert.NotNil(t, c1)
+			assert.True(t, c1.HttpOnly)
+			assert.Equal(t, 1800, c1.MaxAge)
+
+			rec = do(http.MethodGet, "/me", nil, c1)
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Contains(t, rec.Body.String(), "pyro")
+			// 顺延有效期
+			assert.NotNil(t, cookieOf(rec))
+
+			// 3. 篡改cookie
+			rec = do(http.MethodGet, "/me", nil, &http.Cookie{Name: c1.Name, Value: c1.Value + "x"})
+			assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+			// 4. 重新登录更换会话id, 旧会话失效
+			rec = do(http.MethodGet, "/login?user=kk", nil, c1)
+			c2 := cookieOf(rec)
+			assert.NotEqual(t, c1.Value, c2.Value)
+			env := &struct {
+				Data struct {
+					Csrf string `json:"csrf"`
+				} `json:"data"`
+			}{}
+			assert.Nil(t, NegotiateCodec(MIMEJSON).Unmarshal(rec.Body.Bytes(), env))
+			rec = do(http.MethodGet, "/me", nil, c1)
+			assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+			// 5. CSRF
+			rec = do(http.MethodPost, "/logout", nil, c2)
+			assert.Equal(t, http.StatusForbidden, rec.Code)
+			rec = do(http.MethodPost, "/logout", map[string]string{X_CSRF_Token: "bad"}, c2)
+			assert.Equal(t, http.StatusForbidden, rec.Code)
+
+			// 6. 注销
+			rec = do(http.MethodPost, "/logout", map[string]string{X_CSRF_Token: env.Data.Csrf}, c2)
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.True(t, cookieOf(rec).MaxAge < 0)
+			rec = do(http.MethodGet, "/me", nil, c2)
+			assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		}
+		t.Run(n, f)
+	}
+}
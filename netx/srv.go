@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/advancevillage/3rd/logx"
+	"github.com/advancevillage/3rd/tracex"
 	grpc "google.golang.org/grpc"
 	"google.golang.org/grpc/metadata"
 )
@@ -50,6 +51,21 @@ func WithServerCredential(crt, key string) ServerOption {
 	})
 }
 
+// WithServerTLS http服务启用TLS, 证书取自WithServerCredential
+func WithServerTLS() ServerOption {
+	return newFuncOption(func(o *serverOptions) {
+		o.tls = true
+	})
+}
+
+// WithServerCertProvider 使用证书提供者, 支持证书热更新, http服务同时启用TLS
+func WithServerCertProvider(p CertProvider) ServerOption {
+	return newFuncOption(func(o *serverOptions) {
+		o.certs = p
+		o.tls = true
+	})
+}
+
 func WithGrpcService(f GrpcRegister) ServerOption {
 	return newFuncOption(func(o *serverOptions) {
 		o.ss = append(o.ss, f)
@@ -62,14 +78,40 @@ func WithHttpService(method, path string, f ...HttpRegister) ServerOption {
 	})
 }
 
+// WithServerTracer 为每个请求创建服务端span, 未设置时仍透传上游traceparent
+func WithServerTracer(t tracex.Tracer) ServerOption {
+	return newFuncOption(func(o *serverOptions) {
+		o.tracer = t
+	})
+}
+
+// WithServerRegistry 启动时注册服务, 每ttl/3心跳一次, 退出时注销; ttl小于等于0时使用默认值, 最小1s
+func WithServerRegistry(reg Registry, ttl time.Duration) ServerOption {
+	return newFuncOption(func(o *serverOptions) {
+		o.registry = reg
+		if ttl > 0 {
+			o.registryTTL = max(ttl, time.Second)
+		}
+	})
+}
+
 type serverOptions struct {
 	ss   []GrpcRegister // 注册gRPC服务
 	rs   []httpRouter   // 注册http服务
+	fs   []httpStatic   // 注册静态资源
 	host string         // 服务地址
 	port int            // 端口
 	crt  string         // 证书 文件
 	key  string         // 私钥 文件
 	name string         // 服务名称
+
+	tls   bool         // http服务是否启用TLS, gRPC始终启用
+	certs CertProvider // 证书提供者
+
+	registry    Registry      // 注册中心
+	registryTTL time.Duration // 注册有效期
+
+	tracer tracex.Tracer // 链路追踪
 }
 
 var defaultServerOptions = serverOptions{
@@ -80,6 +122,9 @@ var defaultServerOptions = serverOptions{
 	key:  "privkey.pem",
 	ss:   make([]GrpcRegister, 0, 1),
 	rs:   make([]httpRouter, 0, 1),
+	fs:   make([]httpStatic, 0, 1),
+
+	registryTTL: 15 * time.Second,
 }
 
 var _ HealthorServer = (*healthorService)(nil)
@@ -182,5 +227,5 @@ func (s *healthorService) withLoggerContext(ctx context.Context) context.Context
 		return ctx
 	}
 	traceIds := md.Get(logx.TraceId)
-	return context.WithValue(ctx, logx.TraceId, strings.Join(traceIds, ","))
+	return logx.TraceKey.WithValue(ctx, strings.Join(traceIds, ","))
 }
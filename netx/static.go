@@ -0,0 +1,223 @@
+package netx
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+type StaticOption = Option[staticOptions]
+
+// WithStaticIndex 目录默认文件
+func WithStaticIndex(index string) StaticOption {
+	return newFuncOption(func(o *staticOptions) {
+		o.index = index
+	})
+}
+
+// WithStaticSPA 单页应用: 无扩展名的路径不存在时回退到index
+func WithStaticSPA() StaticOption {
+	return newFuncOption(func(o *staticOptions) {
+		o.spa = true
+	})
+}
+
+// WithStaticMaxAge 静态资源缓存时长, index始终为no-cache
+func WithStaticMaxAge(maxAge time.Duration) StaticOption {
+	return newFuncOption(func(o *staticOptions) {
+		o.maxAge = maxAge
+	})
+}
+
+// WithStaticGzip 是否使用预压缩的.gz文件
+func WithStaticGzip(enable bool) StaticOption {
+	return newFuncOption(func(o *staticOptions) {
+		o.gzip = enable
+	})
+}
+
+type staticOptions struct {
+	index  string        // 目录默认文件
+	spa    bool          // 单页应用回退
+	gzip   bool          // 预压缩文件
+	maxAge time.Duration // 缓存时长
+}
+
+var defaultStaticOptions = staticOptions{
+	index:  "index.html",
+	spa:    false,
+	gzip:   true,
+	maxAge: 0,
+}
+
+// WithHttpStatic 以prefix为前缀提供fsys中的静态文件, 可传入embed.FS
+func WithHttpStatic(prefix string, fsys fs.FS, opt ...StaticOption) ServerOption {
+	return newFuncOption(func(o *serverOptions) {
+		o.fs = append(o.fs, httpStatic{prefix: prefix, fsys: fsys, opts: opt})
+	})
+}
+
+// WithHttpStaticDir 以prefix为前缀提供目录dir中的静态文件
+func WithHttpStaticDir(prefix string, dir string, opt ...StaticOption) ServerOption {
+	return WithHttpStatic(prefix, os.DirFS(dir), opt...)
+}
+
+type httpStatic struct {
+	prefix string
+	fsys   fs.FS
+	opts   []StaticOption
+}
+
+type staticHandler struct {
+	opts staticOptions
+	fsys fs.FS
+	etag sync.Map // 无修改时间的文件(embed.FS)缓存内容摘要
+}
+
+func newStaticHandler(fsys fs.FS, opt ...StaticOption) *staticHandler {
+	opts := defaultStaticOptions
+	for _, o := range opt {
+		o.apply(&opts)
+	}
+	return &staticHandler{opts: opts, fsys: fsys}
+}
+
+func (h *staticHandler) serve(w http.ResponseWriter, r *http.Request, name string) {
+	// 1. 仅支持读取
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		h.error(w, NewMethodNotAllowedHttpResponse(errors.New(r.Method)))
+		return
+	}
+
+	// 2. 定位文件
+	name, fi, err := h.lookup(name)
+	if err != nil {
+		h.error(w, NewNotFoundHttpResponse(err))
+		return
+	}
+
+	// 3. 预压缩文件
+	var (
+		hdr      = w.Header()
+		encoding = ""
+		file     = name
+	)
+	if h.opts.gzip {
+		hdr.Add("Vary", "Accept-Encoding")
+		if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			if gfi, err := fs.Stat(h.fsys, name+".gz"); err == nil && !gfi.IsDir() {
+				file, fi, encoding = name+".gz", gfi, "gzip"
+			}
+		}
+	}
+
+	// 4. 读取内容
+	f, err := h.fsys.Open(file)
+	if err != nil {
+		h.error(w, NewNotFoundHttpResponse(err))
+		return
+	}
+	defer f.Close()
+	rs, ok := f.(io.ReadSeeker)
+	if !ok {
+		buf, err := io.ReadAll(f)
+		if err != nil {
+			h.error(w, NewInternalServerErrorHttpResponse(err))
+			return
+		}
+		rs = bytes.NewReader(buf)
+	}
+
+	// 5. 响应头
+	ct := mime.TypeByExtension(path.Ext(name))
+	if len(ct) <= 0 {
+		ct = "application/octet-stream"
+	}
+	hdr.Set("Content-Type", ct)
+	if len(encoding) > 0 {
+		hdr.Set("Content-Encoding", encoding)
+	}
+	etag, err := h.etagOf(file, fi, rs)
+	if err != nil {
+		h.error(w, NewInternalServerErrorHttpResponse(err))
+		return
+	}
+	if len(encoding) > 0 {
+		etag = fmt.Sprintf(`%s-%s"`, strings.TrimSuffix(etag, `"`), encoding)
+	}
+	hdr.Set("ETag", etag)
+	switch {
+	case path.Base(name) == h.opts.index:
+		hdr.Set("Cache-Control", "no-cache")
+
+	case h.opts.maxAge > 0:
+		hdr.Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(h.opts.maxAge.Seconds())))
+	}
+
+	// 6. 条件请求/Range/Last-Modified
+	http.ServeContent(w, r, name, fi.ModTime(), rs)
+}
+
+// lookup 返回实际提供的文件名, 处理目录index与SPA回退
+func (h *staticHandler) lookup(name string) (string, fs.FileInfo, error) {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if len(name) <= 0 {
+		name = "."
+	}
+	fi, err := fs.Stat(h.fsys, name)
+	if err == nil && fi.IsDir() {
+		name = path.Join(name, h.opts.index)
+		fi, err = fs.Stat(h.fsys, name)
+	}
+	if errors.Is(err, fs.ErrNotExist) && h.opts.spa && len(path.Ext(name)) <= 0 {
+		name = h.opts.index
+		fi, err = fs.Stat(h.fsys, name)
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	if fi.IsDir() {
+		return "", nil, fs.ErrNotExist
+	}
+	return name, fi, nil
+}
+
+// etagOf 有修改时间使用 大小-时间, 否则使用内容摘要
+func (h *staticHandler) etagOf(name string, fi fs.FileInfo, rs io.ReadSeeker) (string, error) {
+	if !fi.ModTime().IsZero() {
+		return fmt.Sprintf(`"%x-%x"`, fi.Size(), fi.ModTime().UnixNano()), nil
+	}
+	if v, ok := h.etag.Load(name); ok {
+		return v.(string), nil
+	}
+	d := sha256.New()
+	_, err := io.Copy(d, rs)
+	if err != nil {
+		return "", err
+	}
+	_, err = rs.Seek(0, io.SeekStart)
+	if err != nil {
+		return "", err
+	}
+	etag := fmt.Sprintf(`"%s"`, hex.EncodeToString(d.Sum(nil))[:32])
+	h.etag.Store(name, etag)
+	return etag, nil
+}
+
+func (h *staticHandler) error(w http.ResponseWriter, r HttpResponse) {
+	w.Header().Set("Content-Type", MIMEJSON)
+	w.WriteHeader(r.StatusCode())
+	w.Write(r.Body())
+}
@@ -0,0 +1,118 @@
+package netx
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/advancevillage/3rd/logx"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_static(t *testing.T) {
+	logger, err := logx.NewLogger("debug")
+	assert.Nil(t, err)
+
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	_, err = w.Write([]byte("console.log('3rd')"))
+	assert.Nil(t, err)
+	assert.Nil(t, w.Close())
+
+	fsys := fstest.MapFS{
+		"index.html":   {Data: []byte("<html>3rd</html>"), ModTime: time.Unix(1700000000, 0)},
+		"app.js":       {Data: []byte("console.log('3rd')")},
+		"app.js.gz":    {Data: gz.Bytes()},
+		"data/abc.txt": {Data: []byte("0123456789"), ModTime: time.Unix(1700000000, 0)},
+	}
+
+	s, err := newHttpSrv(context.TODO(), logger,
+		WithHttpStatic("/admin", fsys, WithStaticSPA(), WithStaticMaxAge(time.Hour)),
+	)
+	assert.Nil(t, err)
+
+	do := func(path string, hdr map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for k, v := range hdr {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		s.srv.ServeHTTP(rec, req)
+		return rec
+	}
+
+	var data = map[string]struct {
+		path   string
+		hdr    map[string]string
+		code   int
+		body   []byte
+		header map[string]string
+	}{
+		"case-index": {
+			path:   "/admin/",
+			code:   http.StatusOK,
+			body:   []byte("<html>3rd</html>"),
+			header: map[string]string{"Cache-Control": "no-cache", "Content-Type": "text/html; charset=utf-8"},
+		},
+		"case-spa": {
+			path: "/admin/users/1995",
+			code: http.StatusOK,
+			body: []byte("<html>3rd</html>"),
+		},
+		"case-missing-asset": {
+			path: "/admin/missing.css",
+			code: http.StatusNotFound,
+		},
+		"case-range": {
+			path:   "/admin/data/abc.txt",
+			hdr:    map[string]string{"Range": "bytes=2-5"},
+			code:   http.StatusPartialContent,
+			body:   []byte("2345"),
+			header: map[string]string{"Content-Range": "bytes 2-5/10", "Cache-Control": "public, max-age=3600"},
+		},
+		"case-not-modified": {
+			path: "/admin/data/abc.txt",
+			hdr:  map[string]string{"If-Modified-Since": time.Unix(1700000000, 0).UTC().Format(http.TimeFormat)},
+			code: http.StatusNotModified,
+		},
+		"case-gzip": {
+			path:   "/admin/app.js",
+			hdr:    map[string]string{"Accept-Encoding": "gzip, br"},
+			code:   http.StatusOK,
+			body:   gz.Bytes(),
+			header: map[string]string{"Content-Encoding": "gzip"},
+		},
+		"case-plain": {
+			path: "/admin/app.js",
+			code: http.StatusOK,
+			body: []byte("console.log('3rd')"),
+		},
+	}
+
+	for n, v := range data {
+		f := func(t *testing.T) {
+			rec := do(v.path, v.hdr)
+			assert.Equal(t, v.code, rec.Code)
+			if v.body != nil {
+				assert.Equal(t, v.body, rec.Body.Bytes())
+			}
+			for k, hv := range v.header {
+				assert.Equal(t, hv, rec.Header().Get(k), k)
+			}
+		}
+		t.Run(n, f)
+	}
+
+	t.Run("case-etag", func(t *testing.T) {
+		rec := do("/admin/app.js", nil)
+		etag := rec.Header().Get("ETag")
+		assert.NotEmpty(t, etag)
+		rec = do("/admin/app.js", map[string]string{"If-None-Match": etag})
+		assert.Equal(t, http.StatusNotModified, rec.Code)
+	})
+}
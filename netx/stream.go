@@ -0,0 +1,149 @@
+package netx
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// HttpStreamer 流式响应, route在响应头写出后调用Stream写入响应体
+type HttpStreamer interface {
+	Stream(ctx context.Context, w http.ResponseWriter) error
+}
+
+// ChunkedWriter 分块写入回调, 每次Write后立即Flush
+type ChunkedWriter func(ctx context.Context, w io.Writer) error
+
+var (
+	_ HttpResponse = (*streamHttpResponse)(nil)
+	_ HttpStreamer = (*streamHttpResponse)(nil)
+)
+
+type streamHttpResponse struct {
+	header     http.Header
+	statusCode int
+	reader     io.Reader     // 响应体
+	size       int64         // 响应体长度, 小于0时未知
+	chunked    ChunkedWriter // 分块写入
+}
+
+// NewReaderHttpResponse 从reader流式读取响应体, size小于0时使用分块传输; reader实现io.Closer时写完关闭
+func NewReaderHttpResponse(reader io.Reader, size int64, hdr http.Header) HttpResponse {
+	if hdr == nil {
+		hdr = http.Header{}
+	}
+	if size >= 0 {
+		hdr.Set("Content-Length", strconv.FormatInt(size, 10))
+	}
+	return &streamHttpResponse{header: hdr, statusCode: http.StatusOK, reader: reader, size: size}
+}
+
+// NewFileHttpResponse 文件下载, 按文件名设置Content-Disposition与Content-Type
+func NewFileHttpResponse(reader io.Reader, name string, size int64, hdr http.Header) HttpResponse {
+	if hdr == nil {
+		hdr = http.Header{}
+	}
+	if len(hdr.Get("Content-Type")) <= 0 {
+		ct := mime.TypeByExtension(filepath.Ext(name))
+		if len(ct) <= 0 {
+			ct = "application/octet-stream"
+		}
+		hdr.Set("Content-Type", ct)
+	}
+	hdr.Set("Content-Disposition", contentDisposition("attachment", name))
+	return NewReaderHttpResponse(reader, size, hdr)
+}
+
+// NewChunkedHttpResponse 由回调分块写入响应体
+func NewChunkedHttpResponse(f ChunkedWriter, hdr http.Header) HttpResponse {
+	if hdr == nil {
+		hdr = http.Header{}
+	}
+	return &streamHttpResponse{header: hdr, statusCode: http.StatusOK, size: -1, chunked: f}
+}
+
+// Body 流式响应不缓存响应体
+func (c *streamHttpResponse) Body() []byte {
+	return nil
+}
+
+func (c *streamHttpResponse) Header() http.Header {
+	return c.header
+}
+
+func (c *streamHttpResponse) StatusCode() int {
+	return c.statusCode
+}
+
+func (c *streamHttpResponse) Stream(ctx context.Context, w http.ResponseWriter) error {
+	// 1. 分块回调
+	if c.chunked != nil {
+		return c.chunked(ctx, &flushWriter{ctx: ctx, w: w})
+	}
+	// 2. 读取响应体
+	if closer, ok := c.reader.(io.Closer); ok {
+		defer closer.Close()
+	}
+	if c.reader == nil {
+		return nil
+	}
+	_, err := io.Copy(w, &ctxReader{ctx: ctx, r: c.reader})
+	return err
+}
+
+// close 响应未被写出时释放资源
+func (c *streamHttpResponse) close() {
+	if closer, ok := c.reader.(io.Closer); ok {
+		closer.Close()
+	}
+}
+
+// ctxReader 客户端断开后停止读取
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+type flushWriter struct {
+	ctx context.Context
+	w   http.ResponseWriter
+}
+
+func (w *flushWriter) Write(p []byte) (int, error) {
+	if err := w.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := w.w.Write(p)
+	if f, ok := w.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return n, err
+}
+
+// contentDisposition RFC 6266, 非ASCII文件名使用filename*
+func contentDisposition(typ, name string) string {
+	name = filepath.Base(name)
+	ascii := strings.Map(func(r rune) rune {
+		if r < 0x20 || r > 0x7e || r == '"' || r == '\\' {
+			return '_'
+		}
+		return r
+	}, name)
+	if ascii == name {
+		return fmt.Sprintf(`%s; filename="%s"`, typ, name)
+	}
+	return fmt.Sprintf(`%s; filename="%s"; filename*=UTF-8''%s`, typ, ascii, url.PathEscape(name))
+}
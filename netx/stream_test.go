@@ -0,0 +1,117 @@
+package netx
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/advancevillage/3rd/logx"
+	"github.com/stretchr/testify/assert"
+)
+
+type testCloseReader struct {
+	io.Reader
+	closed bool
+}
+
+func (r *testCloseReader) Close() error {
+	r.closed = true
+	return nil
+}
+
+func Test_stream(t *testing.T) {
+	logger, err := logx.NewLogger("debug")
+	assert.Nil(t, err)
+
+	var (
+		body   = "hello stream"
+		reader = &testCloseReader{Reader: strings.NewReader(body)}
+		auth   = func(ctx context.Context, r *http.Request) (HttpResponse, error) {
+			if len(r.Header.Get("Authorization")) <= 0 {
+				return NewUnauthorizedHttpResponse(fmt.Errorf("unauthorized")), nil
+			}
+			return NewReaderHttpResponse(&testCloseReader{Reader: strings.NewReader("skip")}, 4, nil), nil
+		}
+	)
+	s, err := newHttpSrv(context.TODO(), logger,
+		WithHttpService(http.MethodGet, "/reader", func(ctx context.Context, r *http.Request) (HttpResponse, error) {
+			return NewReaderHttpResponse(reader, int64(len(body)), nil), nil
+		}),
+		WithHttpService(http.MethodGet, "/file", auth, func(ctx context.Context, r *http.Request) (HttpResponse, error) {
+			return NewFileHttpResponse(strings.NewReader("a,b\n1,2\n"), "报表.pdf", -1, nil), nil
+		}),
+		WithHttpService(http.MethodGet, "/chunked", func(ctx context.Context, r *http.Request) (HttpResponse, error) {
+			return NewChunkedHttpResponse(func(ctx context.Context, w io.Writer) error {
+				for i := range 3 {
+					_, err := fmt.Fprintf(w, "chunk-%d;", i)
+					if err != nil {
+						return err
+					}
+				}
+				return nil
+			}, http.Header{"Content-Type": []string{"text/plain"}}), nil
+		}),
+	)
+	assert.Nil(t, err)
+
+	do := func(path string, hdr map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for k, v := range hdr {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		s.srv.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("case-reader", func(t *testing.T) {
+		rec := do("/reader", nil)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, body, rec.Body.String())
+		assert.Equal(t, fmt.Sprint(len(body)), rec.Header().Get("Content-Length"))
+		assert.Equal(t, "application/octet-stream", rec.Header().Get("Content-Type"))
+		assert.NotEmpty(t, rec.Header().Get(X_Request_Latency))
+		assert.True(t, reader.closed)
+	})
+
+	t.Run("case-file", func(t *testing.T) {
+		rec := do("/file", map[string]string{"Authorization": "token"})
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "a,b\n1,2\n", rec.Body.String())
+		assert.Equal(t, `attachment; filename="__.pdf"; filename*=UTF-8''%E6%8A%A5%E8%A1%A8.pdf`, rec.Header().Get("Content-Disposition"))
+		assert.True(t, strings.HasPrefix(rec.Header().Get("Content-Type"), "application/pdf"))
+
+		rec = do("/file", nil)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.Empty(t, rec.Header().Get("Content-Disposition"))
+	})
+
+	t.Run("case-file-server", func(t *testing.T) {
+		// 中间件响应的Content-Length不能截断最终响应
+		ts := httptest.NewServer(s.srv)
+		defer ts.Close()
+		req, err := http.NewRequest(http.MethodGet, ts.URL+"/file", nil)
+		assert.Nil(t, err)
+		req.Header.Set("Authorization", "token")
+		rsp, err := http.DefaultClient.Do(req)
+		assert.Nil(t, err)
+		defer rsp.Body.Close()
+		buf, err := io.ReadAll(rsp.Body)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, rsp.StatusCode)
+		assert.Equal(t, "a,b\n1,2\n", string(buf))
+		assert.NotEqual(t, "4", rsp.Header.Get("Content-Length"))
+	})
+
+	t.Run("case-chunked", func(t *testing.T) {
+		rec := do("/chunked", nil)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "chunk-0;chunk-1;chunk-2;", rec.Body.String())
+		assert.Equal(t, "text/plain", rec.Header().Get("Content-Type"))
+		assert.True(t, rec.Flushed)
+	})
+}
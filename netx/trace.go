@@ -0,0 +1,121 @@
+package netx
+
+import (
+	"context"
+	"strings"
+
+	"github.com/advancevillage/3rd/logx"
+	"github.com/advancevillage/3rd/tracex"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var _ tracex.Carrier = metadataCarrier{}
+
+// metadataCarrier gRPC元数据的键均为小写
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	vs := metadata.MD(c).Get(key)
+	if len(vs) <= 0 {
+		return ""
+	}
+	return vs[0]
+}
+
+func (c metadataCarrier) Set(key string, val string) {
+	metadata.MD(c).Set(key, val)
+}
+
+// grpcServerContext 提取上游链路, 设置tracer时创建服务端span
+func grpcServerContext(ctx context.Context, tracer tracex.Tracer, method string) (context.Context, tracex.Span) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		md = metadata.MD{}
+	}
+	ctx = tracex.Extract(ctx, metadataCarrier(md))
+	if traces := md.Get(logx.TraceId); len(traces) > 0 {
+		ctx = logx.TraceKey.WithValue(ctx, strings.Join(traces, ","))
+	} else if sc := tracex.SpanContextFromContext(ctx); sc.IsValid() {
+		ctx = logx.TraceKey.WithValue(ctx, sc.TraceId.String())
+	}
+	if tracer == nil {
+		return ctx, nil
+	}
+	return tracer.Start(ctx, method, tracex.WithSpanKind(tracex.SpanKindServer), tracex.WithSpanAttributes("rpc.system", "grpc", "rpc.method", method))
+}
+
+func endGrpcSpan(span tracex.Span, err error) {
+	if span == nil {
+		return
+	}
+	span.SetAttributes("rpc.grpc.status_code", int(status.Code(err)))
+	span.RecordError(err)
+	span.End()
+}
+
+func newGrpcServerUnaryInterceptor(tracer tracex.Tracer) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, span := grpcServerContext(ctx, tracer, info.FullMethod)
+		resp, err := handler(ctx, req)
+		endGrpcSpan(span, err)
+		return resp, err
+	}
+}
+
+type tracedServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *tracedServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func newGrpcServerStreamInterceptor(tracer tracex.Tracer) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, span := grpcServerContext(ss.Context(), tracer, info.FullMethod)
+		err := handler(srv, &tracedServerStream{ServerStream: ss, ctx: ctx})
+		endGrpcSpan(span, err)
+		return err
+	}
+}
+
+// grpcClientContext 设置tracer时创建客户端span, 并写入traceparent
+func grpcClientContext(ctx context.Context, tracer tracex.Tracer, method string) (context.Context, tracex.Span) {
+	var span tracex.Span
+	if tracer != nil {
+		ctx, span = tracer.Start(ctx, method, tracex.WithSpanKind(tracex.SpanKindClient), tracex.WithSpanAttributes("rpc.system", "grpc", "rpc.method", method))
+	}
+	if !tracex.SpanContextFromContext(ctx).IsValid() {
+		return ctx, span
+	}
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if ok {
+		md = md.Copy()
+	} else {
+		md = metadata.MD{}
+	}
+	tracex.Inject(ctx, metadataCarrier(md))
+	return metadata.NewOutgoingContext(ctx, md), span
+}
+
+func newGrpcClientUnaryInterceptor(tracer tracex.Tracer) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx, span := grpcClientContext(ctx, tracer, method)
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		endGrpcSpan(span, err)
+		return err
+	}
+}
+
+// 流式调用的span在建立流后结束, 仅记录建流耗时
+func newGrpcClientStreamInterceptor(tracer tracex.Tracer) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx, span := grpcClientContext(ctx, tracer, method)
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		endGrpcSpan(span, err)
+		return cs, err
+	}
+}
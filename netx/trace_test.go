@@ -0,0 +1,129 @@
+package netx
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/advancevillage/3rd/logx"
+	"github.com/advancevillage/3rd/tracex"
+	"github.com/advancevillage/3rd/x"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func Test_trace_http(t *testing.T) {
+	var (
+		ctx    = context.TODO()
+		logger = logx.NewObservedLogger()
+		parent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+		got    = make(chan http.Header, 1)
+	)
+	tracer, err := tracex.NewTracer(ctx, logger)
+	assert.Nil(t, err)
+
+	// 1. 下游服务
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got <- r.Header.Clone()
+		w.Write([]byte("{}"))
+	}))
+	defer down.Close()
+	cli, err := newHttpClient(ctx, logger, WithClientTracer(tracer))
+	assert.Nil(t, err)
+
+	// 2. 上游服务
+	h := func(ctx context.Context, r *http.Request) (HttpResponse, error) {
+		logger.Infow(ctx, "handle")
+		_, err := cli.Get(ctx, down.URL, x.NewBuilder(), x.NewBuilder())
+		if err != nil {
+			return nil, err
+		}
+		return NewStatusOkHttpResponse(nil, nil), nil
+	}
+	s, err := newHttpSrv(ctx, logger, WithServerTracer(tracer), WithHttpService(http.MethodGet, "/api/trace", h))
+	assert.Nil(t, err)
+
+	var data = map[string]struct {
+		traceparent string
+		trace       string
+	}{
+		"case-traceparent": {
+			traceparent: parent,
+			trace:       "4bf92f3577b34da6a3ce929d0e0e4736",
+		},
+		"case-legacy-trace": {
+			trace: "0b6f1c4e-3a8d-4d7e-9f2a-5c1b7e8d9a0f",
+		},
+	}
+	for n, v := range data {
+		f := func(t *testing.T) {
+			logger.Reset()
+			req := httptest.NewRequest(http.MethodGet, "/api/trace", nil)
+			if len(v.traceparent) > 0 {
+				req.Header.Set(tracex.Traceparent, v.traceparent)
+			} else {
+				req.Header.Set(logx.TraceId, v.trace)
+			}
+			rec := httptest.NewRecorder()
+			s.srv.ServeHTTP(rec, req)
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, v.trace, rec.Header().Get(logx.TraceId))
+
+			// 日志携带trace和span
+			e := logger.FilterMessage("handle")[0]
+			assert.Equal(t, v.trace, e.Fields[logx.TraceId])
+			assert.NotEmpty(t, e.Fields[logx.SpanKey.Name()])
+
+			// 下游收到同一trace的traceparent
+			hdr := <-got
+			sc, err := tracex.ParseTraceparent(hdr.Get(tracex.Traceparent))
+			assert.Nil(t, err)
+			id, _ := tracex.ParseTraceID(v.trace)
+			assert.Equal(t, id, sc.TraceId)
+		}
+		t.Run(n, f)
+	}
+}
+
+func Test_trace_grpc(t *testing.T) {
+	var (
+		ctx    = context.TODO()
+		parent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	)
+	tracer, err := tracex.NewTracer(ctx, logx.NewNopLogger())
+	assert.Nil(t, err)
+
+	// 1. 服务端提取
+	var (
+		sctx   context.Context
+		server = newGrpcServerUnaryInterceptor(tracer)
+		info   = &grpc.UnaryServerInfo{FullMethod: "/healthor/Ping"}
+		in     = metadata.NewIncomingContext(ctx, metadata.Pairs(tracex.Traceparent, parent))
+	)
+	_, err = server(in, nil, info, func(ctx context.Context, req any) (any, error) {
+		sctx = ctx
+		return nil, nil
+	})
+	assert.Nil(t, err)
+	sc := tracex.SpanContextFromContext(sctx)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceId.String())
+	assert.NotEqual(t, "00f067aa0ba902b7", sc.SpanId.String())
+	trace, _ := logx.TraceKey.Value(sctx)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", trace)
+
+	// 2. 客户端注入
+	var (
+		out    metadata.MD
+		client = newGrpcClientUnaryInterceptor(nil)
+		octx   = metadata.AppendToOutgoingContext(sctx, "k", "v")
+	)
+	err = client(octx, "/healthor/Ping", nil, nil, nil, func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		out, _ = metadata.FromOutgoingContext(ctx)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"v"}, out.Get("k"))
+	assert.Equal(t, tracex.FormatTraceparent(sc), out.Get(tracex.Traceparent)[0])
+}
@@ -0,0 +1,581 @@
+package netx
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/advancevillage/3rd/dbx"
+	"github.com/advancevillage/3rd/logx"
+	"github.com/advancevillage/3rd/mathx"
+)
+
+const (
+	TusVersion     = "1.0.0"
+	TusExtension   = "creation,termination,expiration"
+	TusContentType = "application/offset+octet-stream"
+
+	X_Tus_Resumable   = "Tus-Resumable"
+	X_Tus_Version     = "Tus-Version"
+	X_Tus_Extension   = "Tus-Extension"
+	X_Tus_Max_Size    = "Tus-Max-Size"
+	X_Upload_Offset   = "Upload-Offset"
+	X_Upload_Length   = "Upload-Length"
+	X_Upload_Metadata = "Upload-Metadata"
+	X_Upload_Expires  = "Upload-Expires"
+)
+
+var (
+	ErrTusVersion       = errors.New("tus: unsupported version")
+	ErrTusUploadLength  = errors.New("tus: invalid upload length")
+	ErrTusUploadTooBig  = errors.New("tus: upload too large")
+	ErrTusUploadOffset  = errors.New("tus: upload offset mismatch")
+	ErrTusContentType   = errors.New("tus: invalid content type")
+	ErrTusUploadMissing = errors.New("tus: upload not found")
+	ErrTusUploadLocked  = errors.New("tus: upload in progress")
+)
+
+// TusUpload 上传状态, 保存在缓存中, 实例重启或切换后可继续上传
+type TusUpload struct {
+	Id       string            `json:"id"`
+	Name     string            `json:"name"`     // 对象名称
+	Length   int64             `json:"length"`   // 总长度
+	Offset   int64             `json:"offset"`   // 已接收长度
+	Metadata map[string]string `json:"metadata"` // Upload-Metadata
+	Expires  int64             `json:"expires"`  // 过期时间 秒
+	Snapshot string            `json:"snapshot"` // dbx.MultiPartUploader快照
+	Tail     []byte            `json:"-"`        // 未满一个分片的数据, 单独保存
+}
+
+func (u *TusUpload) Completed() bool {
+	return u.Offset >= u.Length
+}
+
+type TusOption = Option[tusOptions]
+
+// WithTusPartSize 分片大小, 需满足对象存储的最小分片限制
+func WithTusPartSize(size int64) TusOption {
+	return newFuncOption(func(o *tusOptions) {
+		o.partSize = size
+	})
+}
+
+// WithTusMaxSize 单个文件最大长度
+func WithTusMaxSize(size int64) TusOption {
+	return newFuncOption(func(o *tusOptions) {
+		o.maxSize = size
+	})
+}
+
+// WithTusExpires 上传未完成时状态保留时长
+func WithTusExpires(exp time.Duration) TusOption {
+	return newFuncOption(func(o *tusOptions) {
+		o.expires = exp
+	})
+}
+
+// WithTusLockTTL 写入锁时长, 持有期间每ttl/3续期一次, locker需实现dbx.CacheLockRenewer
+func WithTusLockTTL(ttl time.Duration) TusOption {
+	return newFuncOption(func(o *tusOptions) {
+		o.lockTTL = ttl
+	})
+}
+
+func WithTusPrefix(prefix string) TusOption {
+	return newFuncOption(func(o *tusOptions) {
+		o.prefix = prefix
+	})
+}
+
+// WithTusNamer 根据上传id及元数据生成对象名称
+func WithTusNamer(f func(ctx context.Context, id string, meta map[string]string) string) TusOption {
+	return newFuncOption(func(o *tusOptions) {
+		o.namer = f
+	})
+}
+
+// WithTusCompleted 上传完成回调
+func WithTusCompleted(f func(ctx context.Context, upload *TusUpload)) TusOption {
+	return newFuncOption(func(o *tusOptions) {
+		o.completed = f
+	})
+}
+
+type tusOptions struct {
+	partSize  int64                                                               // 分片大小
+	maxSize   int64                                                               // 最大长度
+	expires   time.Duration                                                       // 状态保留时长
+	lockTTL   time.Duration                                                       // 写入锁时长
+	prefix    string                                                              // 缓存键前缀
+	namer     func(ctx context.Context, id string, meta map[string]string) string // 对象名称
+	completed func(ctx context.Context, upload *TusUpload)                        // 完成回调
+}
+
+var defaultTusOptions = tusOptions{
+	partSize: 5 << 20,
+	maxSize:  5 << 30,
+	expires:  24 * time.Hour,
+	lockTTL:  time.Minute,
+	prefix:   "3rd:tus",
+	namer: func(ctx context.Context, id string, meta map[string]string) string {
+		return path.Join("uploads", id)
+	},
+	completed: func(ctx context.Context, upload *TusUpload) {},
+}
+
+// WithHttpTus 在prefix下注册tus 1.0路由, 创建请求发往prefix, 其余请求发往prefix/:id
+func WithHttpTus(prefix string, f ...HttpRegister) ServerOption {
+	prefix = strings.TrimRight(prefix, "/")
+	return newFuncOption(func(o *serverOptions) {
+		o.rs = append(o.rs, httpRouter{"ANY", prefix, f}, httpRouter{"ANY", prefix + "/:id", f})
+	})
+}
+
+type tusSrv struct {
+	opts   tusOptions
+	logger logx.ILogger
+	s3     dbx.S3
+	locker dbx.CacheLocker
+	cacher dbx.Cacher
+}
+
+// NewTusUpload tus协议上传, 数据按分片写入S3.MultiUpload, 状态保存在cacher中, locker防止并发写同一上传
+func NewTusUpload(ctx context.Context, logger logx.ILogger, s3 dbx.S3, locker dbx.CacheLocker, cacher dbx.Cacher, opt ...TusOption) HttpRegister {
+	opts := defaultTusOptions
+	for _, o := range opt {
+		o.apply(&opts)
+	}
+	s := &tusSrv{opts: opts, logger: logger, s3: s3, locker: locker, cacher: cacher}
+	return s.serve
+}
+
+func (s *tusSrv) serve(ctx context.Context, r *http.Request) (HttpResponse, error) {
+	// 1. 协议探测
+	if r.Method == http.MethodOptions {
+		hdr := s.header()
+		hdr.Set(X_Tus_Version, TusVersion)
+		hdr.Set(X_Tus_Extension, TusExtension)
+		hdr.Set(X_Tus_Max_Size, strconv.FormatInt(s.opts.maxSize, 10))
+		return newHttpResponse(nil, hdr, http.StatusNoContent), nil
+	}
+
+	// 2. 协议版本
+	if r.Header.Get(X_Tus_Resumable) != TusVersion {
+		hdr := s.header()
+		hdr.Set(X_Tus_Version, TusVersion)
+		return s.reply(hdr, http.StatusPreconditionFailed, ErrTusVersion), nil
+	}
+
+	// 3. 请求分发
+	switch r.Method {
+	case http.MethodPost:
+		return s.create(ctx, r)
+
+	case http.MethodHead:
+		return s.head(ctx, r)
+
+	case http.MethodPatch:
+		return s.patch(ctx, r)
+
+	case http.MethodDelete:
+		return s.terminate(ctx, r)
+
+	default:
+		hdr := s.header()
+		hdr.Set("Allow", "OPTIONS, POST, HEAD, PATCH, DELETE")
+		return s.reply(hdr, http.StatusMethodNotAllowed, errors.New(r.Method)), nil
+	}
+}
+
+func (s *tusSrv) create(ctx context.Context, r *http.Request) (HttpResponse, error) {
+	// 1. 校验长度
+	length, err := strconv.ParseInt(r.Header.Get(X_Upload_Length), 10, 64)
+	if err != nil || length < 0 {
+		return s.reply(s.header(), http.StatusBadRequest, ErrTusUploadLength), nil
+	}
+	if length > s.opts.maxSize {
+		return s.reply(s.header(), http.StatusRequestEntityTooLarge, ErrTusUploadTooBig), nil
+	}
+	meta, err := parseTusMetadata(r.Header.Get(X_Upload_Metadata))
+	if err != nil {
+		return s.reply(s.header(), http.StatusBadRequest, err), nil
+	}
+
+	// 2. 初始化分片上传
+	var (
+		id     = mathx.UUID()
+		name   = s.opts.namer(ctx, id, meta)
+		total  = int((length + s.opts.partSize - 1) / s.opts.partSize)
+		upOpts = []dbx.MultiUploadOption{}
+	)
+	if total <= 0 {
+		total = 1
+	}
+	if filename := meta["filename"]; len(filename) > 0 {
+		upOpts = append(upOpts, dbx.WithContentDisposition(contentDisposition("attachment", filename)))
+	}
+	mp, err := s.s3.MultiUpload(ctx, name, total, upOpts...)
+	if err != nil {
+		s.logger.Errorw(ctx, "tus: initiate multipart upload failed", "err", err, "name", name)
+		return nil, err
+	}
+	// 空文件直接完成
+	if length == 0 {
+		err = mp.Write(ctx, 0, []byte{})
+		if err != nil {
+			s.logger.Errorw(ctx, "tus: write empty part failed", "err", err, "name", name)
+			return nil, err
+		}
+	}
+
+	// 3. 保存状态
+	upload := &TusUpload{
+		Id:       id,
+		Name:     name,
+		Length:   length,
+		Metadata: meta,
+		Expires:  time.Now().Add(s.opts.expires).Unix(),
+		Snapshot: mp.String(),
+	}
+	err = s.save(ctx, upload)
+	if err != nil {
+		return nil, err
+	}
+	if upload.Completed() {
+		s.opts.completed(ctx, upload)
+	}
+	s.logger.Infow(ctx, "tus: upload created", "id", id, "name", name, "length", length)
+
+	hdr := s.status(upload)
+	hdr.Set("Location", strings.TrimRight(r.URL.Path, "/")+"/"+id)
+	return newHttpResponse(nil, hdr, http.StatusCreated), nil
+}
+
+func (s *tusSrv) head(ctx context.Context, r *http.Request) (HttpResponse, error) {
+	upload, err := s.load(ctx, path.Base(r.URL.Path))
+	if err != nil {
+		return nil, err
+	}
+	if upload == nil {
+		return s.reply(s.header(), http.StatusNotFound, ErrTusUploadMissing), nil
+	}
+	hdr := s.status(upload)
+	hdr.Set(X_Upload_Length, strconv.FormatInt(upload.Length, 10))
+	if len(upload.Metadata) > 0 {
+		hdr.Set(X_Upload_Metadata, formatTusMetadata(upload.Metadata))
+	}
+	hdr.Set("Cache-Control", "no-store")
+	return newHttpResponse(nil, hdr, http.StatusOK), nil
+}
+
+func (s *tusSrv) patch(ctx context.Context, r *http.Request) (HttpResponse, error) {
+	// 1. 校验请求
+	if r.Header.Get("Content-Type") != TusContentType {
+		return s.reply(s.header(), http.StatusUnsupportedMediaType, ErrTusContentType), nil
+	}
+	offset, err := strconv.ParseInt(r.Header.Get(X_Upload_Offset), 10, 64)
+	if err != nil || offset < 0 {
+		return s.reply(s.header(), http.StatusBadRequest, ErrTusUploadOffset), nil
+	}
+
+	// 2. 同一上传串行写入
+	var (
+		id    = path.Base(r.URL.Path)
+		lk    = fmt.Sprintf("%s:%s:lock", s.opts.prefix, id)
+		token = mathx.UUID()
+	)
+	ok, err := s.locker.Lock(ctx, lk, token, s.opts.lockTTL)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return s.reply(s.header(), http.StatusConflict, ErrTusUploadLocked), nil
+	}
+	defer func() {
+		_, err := s.locker.Unlock(ctx, lk, token)
+		if err != nil {
+			s.logger.Errorw(ctx, "tus: unlock failed", "err", err, "id", id)
+		}
+	}()
+	// 请求体较大时写入时间可能超过锁时长, 持续续期, 锁丢失后停止保存状态
+	lost, stop := s.renew(ctx, lk, token, id)
+	defer stop()
+
+	// 3. 加载状态
+	upload, err := s.load(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if upload == nil {
+		return s.reply(s.header(), http.StatusNotFound, ErrTusUploadMissing), nil
+	}
+	if upload.Offset != offset {
+		hdr := s.status(upload)
+		return s.reply(hdr, http.StatusConflict, ErrTusUploadOffset), nil
+	}
+	if upload.Completed() {
+		return newHttpResponse(nil, s.status(upload), http.StatusNoContent), nil
+	}
+	err = s.loadTail(ctx, upload)
+	if err != nil {
+		return nil, err
+	}
+	mp, err := s.s3.ResumeUpload(ctx, upload.Snapshot)
+	if err != nil {
+		s.logger.Errorw(ctx, "tus: resume multipart upload failed", "err", err, "id", id)
+		return nil, err
+	}
+
+	// 4. 按分片写入, 每写完一个分片保存一次状态
+	var (
+		body = io.LimitReader(r.Body, upload.Length-upload.Offset)
+		buf  = make([]byte, s.opts.partSize)
+		n    = copy(buf, upload.Tail)
+		part = int((upload.Offset - int64(n)) / s.opts.partSize)
+		werr error
+	)
+	for {
+		m, rerr := io.ReadFull(body, buf[n:])
+		n += m
+		if int64(n) == s.opts.partSize || int64(part)*s.opts.partSize+int64(n) == upload.Length {
+			werr = mp.Write(ctx, part, buf[:n])
+			if werr != nil {
+				s.logger.Errorw(ctx, "tus: write part failed", "err", werr, "id", id, "part", part)
+				break
+			}
+			// 末尾分片不足partSize, 偏移按实际写入计算
+			upload.Offset = int64(part)*s.opts.partSize + int64(n)
+			part, n = part+1, 0
+			upload.Snapshot = mp.String()
+			upload.Tail = nil
+			if lost.Load() {
+				return s.reply(s.header(), http.StatusConflict, ErrTusUploadLocked), nil
+			}
+			err = s.save(ctx, upload)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if rerr != nil || upload.Completed() {
+			// 客户端断开时保留已接收的数据
+			if rerr != nil && rerr != io.EOF && rerr != io.ErrUnexpectedEOF {
+				s.logger.Warnw(ctx, "tus: read body interrupted", "err", rerr, "id", id)
+			}
+			break
+		}
+	}
+
+	// 5. 保存未写入分片的数据, 下次请求继续写入
+	if n > 0 {
+		if lost.Load() {
+			return s.reply(s.header(), http.StatusConflict, ErrTusUploadLocked), nil
+		}
+		upload.Tail = append([]byte(nil), buf[:n]...)
+		upload.Offset = int64(part)*s.opts.partSize + int64(n)
+		// 先保存分片数据再保存偏移, 中断时分片数据可能比偏移多, 加载时截断
+		err = s.tail(ctx, upload.Id).Set(ctx, string(upload.Tail))
+		if err != nil {
+			s.logger.Errorw(ctx, "tus: save tail failed", "err", err, "id", id)
+			return nil, err
+		}
+		err = s.save(ctx, upload)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if werr != nil {
+		return nil, werr
+	}
+	if upload.Completed() {
+		s.logger.Infow(ctx, "tus: upload completed", "id", id, "name", upload.Name, "length", upload.Length)
+		s.opts.completed(ctx, upload)
+	}
+	return newHttpResponse(nil, s.status(upload), http.StatusNoContent), nil
+}
+
+func (s *tusSrv) terminate(ctx context.Context, r *http.Request) (HttpResponse, error) {
+	upload, err := s.load(ctx, path.Base(r.URL.Path))
+	if err != nil {
+		return nil, err
+	}
+	if upload == nil {
+		return s.reply(s.header(), http.StatusNotFound, ErrTusUploadMissing), nil
+	}
+	// 未完成的分片由存储桶生命周期规则清理
+	if upload.Completed() {
+		err = s.s3.Clean(ctx, upload.Name)
+		if err != nil {
+			s.logger.Errorw(ctx, "tus: clean object failed", "err", err, "id", upload.Id, "name", upload.Name)
+			return nil, err
+		}
+	}
+	err = s.cache(ctx, upload.Id).Del(ctx)
+	if err != nil {
+		return nil, err
+	}
+	err = s.tail(ctx, upload.Id).Del(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.logger.Infow(ctx, "tus: upload terminated", "id", upload.Id, "name", upload.Name)
+	return newHttpResponse(nil, s.header(), http.StatusNoContent), nil
+}
+
+func (s *tusSrv) cache(ctx context.Context, id string) dbx.StringCacher {
+	return s.cacher.CreateStringCacher(ctx, fmt.Sprintf("%s:%s", s.opts.prefix, id), s.opts.expires)
+}
+
+// tail 未满一个分片的数据, 与状态分开保存, 避免每次保存状态都重复编码
+func (s *tusSrv) tail(ctx context.Context, id string) dbx.StringCacher {
+	return s.cacher.CreateStringCacher(ctx, fmt.Sprintf("%s:%s:tail", s.opts.prefix, id), s.opts.expires)
+}
+
+// renew 定期续期写入锁, lost为true表示锁已被他人持有
+func (s *tusSrv) renew(ctx context.Context, key, token, id string) (*atomic.Bool, func()) {
+	var (
+		lost    = &atomic.Bool{}
+		done    = make(chan struct{})
+		stopped = make(chan struct{})
+	)
+	r, ok := s.locker.(dbx.CacheLockRenewer)
+	if !ok || s.opts.lockTTL <= 0 {
+		return lost, func() {}
+	}
+	go func() {
+		defer close(stopped)
+		t := time.NewTicker(max(s.opts.lockTTL/3, time.Millisecond))
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+				ok, err := r.Renew(ctx, key, token, s.opts.lockTTL)
+				if err != nil {
+					s.logger.Warnw(ctx, "tus: renew lock failed", "err", err, "id", id)
+					continue
+				}
+				if !ok {
+					s.logger.Errorw(ctx, "tus: lock lost", "id", id)
+					lost.Store(true)
+					return
+				}
+			}
+		}
+	}()
+	return lost, func() {
+		close(done)
+		<-stopped
+	}
+}
+
+func (s *tusSrv) load(ctx context.Context, id string) (*TusUpload, error) {
+	str, err := s.cache(ctx, id).Get(ctx)
+	if err != nil {
+		s.logger.Errorw(ctx, "tus: load upload failed", "err", err, "id", id)
+		return nil, err
+	}
+	if len(str) <= 0 {
+		return nil, nil
+	}
+	upload := &TusUpload{}
+	err = json.Unmarshal([]byte(str), upload)
+	if err != nil {
+		s.logger.Errorw(ctx, "tus: unmarshal upload failed", "err", err, "id", id)
+		return nil, err
+	}
+	if upload.Expires < time.Now().Unix() {
+		return nil, nil
+	}
+	return upload, nil
+}
+
+// loadTail 加载未满一个分片的数据
+func (s *tusSrv) loadTail(ctx context.Context, upload *TusUpload) error {
+	size := upload.Offset % s.opts.partSize
+	if size <= 0 || upload.Completed() {
+		return nil
+	}
+	tail, err := s.tail(ctx, upload.Id).Get(ctx)
+	if err != nil {
+		s.logger.Errorw(ctx, "tus: load tail failed", "err", err, "id", upload.Id)
+		return err
+	}
+	if int64(len(tail)) < size {
+		s.logger.Errorw(ctx, "tus: tail missing", "id", upload.Id, "want", size, "got", len(tail))
+		return ErrTusUploadMissing
+	}
+	upload.Tail = []byte(tail[:size])
+	return nil
+}
+
+func (s *tusSrv) save(ctx context.Context, upload *TusUpload) error {
+	buf, err := json.Marshal(upload)
+	if err != nil {
+		return err
+	}
+	err = s.cache(ctx, upload.Id).Set(ctx, string(buf))
+	if err != nil {
+		s.logger.Errorw(ctx, "tus: save upload failed", "err", err, "id", upload.Id)
+		return err
+	}
+	return nil
+}
+
+func (s *tusSrv) header() http.Header {
+	hdr := http.Header{}
+	hdr.Set(X_Tus_Resumable, TusVersion)
+	return hdr
+}
+
+func (s *tusSrv) status(upload *TusUpload) http.Header {
+	hdr := s.header()
+	hdr.Set(X_Upload_Offset, strconv.FormatInt(upload.Offset, 10))
+	if !upload.Completed() {
+		hdr.Set(X_Upload_Expires, time.Unix(upload.Expires, 0).UTC().Format(http.TimeFormat))
+	}
+	return hdr
+}
+
+func (s *tusSrv) reply(hdr http.Header, code int, err error) HttpResponse {
+	r := newCodeHttpResponse(code, http.StatusText(code), err)
+	for k, v := range hdr {
+		r.Header()[k] = v
+	}
+	return r
+}
+
+// parseTusMetadata key base64(value),key base64(value)
+func parseTusMetadata(s string) (map[string]string, error) {
+	meta := make(map[string]string)
+	for _, kv := range strings.Split(s, ",") {
+		kv = strings.TrimSpace(kv)
+		if len(kv) <= 0 {
+			continue
+		}
+		k, v, _ := strings.Cut(kv, " ")
+		buf, err := base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			return nil, fmt.Errorf("tus: invalid metadata %s", k)
+		}
+		meta[k] = string(buf)
+	}
+	return meta, nil
+}
+
+func formatTusMetadata(meta map[string]string) string {
+	kv := make([]string, 0, len(meta))
+	for k, v := range meta {
+		kv = append(kv, fmt.Sprintf("%s %s", k, base64.StdEncoding.EncodeToString([]byte(v))))
+	}
+	return strings.Join(kv, ",")
+}
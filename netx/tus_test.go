@@ -0,0 +1,265 @@
+package netx
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/advancevillage/3rd/dbx"
+	"github.com/advancevillage/3rd/logx"
+	"github.com/advancevillage/3rd/mathx"
+	"github.com/stretchr/testify/assert"
+)
+
+type testMemS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	uploads map[string]*testMemUploader
+}
+
+func newTestMemS3() *testMemS3 {
+	return &testMemS3{objects: make(map[string][]byte), uploads: make(map[string]*testMemUploader)}
+}
+
+func (s *testMemS3) MultiUpload(ctx context.Context, name string, totalPart int, opts ...dbx.MultiUploadOption) (dbx.MultiPartUploader, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	mp := &testMemUploader{s3: s, id: mathx.UUID(), name: name, total: totalPart, parts: make(map[int][]byte)}
+	s.uploads[mp.id] = mp
+	return mp, nil
+}
+
+func (s *testMemS3) ResumeUpload(ctx context.Context, snapshot string) (dbx.MultiPartUploader, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.uploads[snapshot], nil
+}
+
+func (s *testMemS3) Url(ctx context.Context, name string) (string, error)      { return name, nil }
+func (s *testMemS3) Download(ctx context.Context, name string) (string, error) { return name, nil }
+
+func (s *testMemS3) Exist(ctx context.Context, name string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.objects[name]
+	return ok, nil
+}
+
+func (s *testMemS3) Clean(ctx context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.objects, name)
+	return nil
+}
+
+type testMemUploader struct {
+	s3    *testMemS3
+	id    string
+	name  string
+	total int
+	parts map[int][]byte
+}
+
+func (mp *testMemUploader) Id(ctx context.Context) string { return mp.id }
+func (mp *testMemUploader) String() string                { return mp.id }
+
+func (mp *testMemUploader) Progress() float64 {
+	return float64(len(mp.parts)) / float64(mp.total)
+}
+
+func (mp *testMemUploader) Write(ctx context.Context, partNumber int, body []byte) error {
+	mp.s3.mu.Lock()
+	defer mp.s3.mu.Unlock()
+	mp.parts[partNumber] = append([]byte(nil), body...)
+	if len(mp.parts) < mp.total {
+		return nil
+	}
+	obj := []byte{}
+	for i := range mp.total {
+		obj = append(obj, mp.parts[i]...)
+	}
+	mp.s3.objects[mp.name] = obj
+	return nil
+}
+
+func Test_tus(t *testing.T) {
+	logger, err := logx.NewLogger("debug")
+	assert.Nil(t, err)
+
+	var (
+		ctx       = context.TODO()
+		s3        = newTestMemS3()
+		cache     = newTestMemCache()
+		completed = make(chan *TusUpload, 1)
+		h         = NewTusUpload(ctx, logger, s3, cache, cache, WithTusPartSize(4), WithTusMaxSize(64),
+			WithTusCompleted(func(ctx context.Context, upload *TusUpload) { completed <- upload }))
+	)
+	s, err := newHttpSrv(ctx, logger, WithHttpTus("/files", h))
+	assert.Nil(t, err)
+
+	do := func(method, path string, body []byte, hdr map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewReader(body))
+		req.Header.Set(X_Tus_Resumable, TusVersion)
+		for k, v := range hdr {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		s.srv.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("case-options", func(t *testing.T) {
+		rec := do(http.MethodOptions, "/files", nil, nil)
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		assert.Equal(t, TusVersion, rec.Header().Get(X_Tus_Version))
+		assert.Equal(t, "64", rec.Header().Get(X_Tus_Max_Size))
+	})
+
+	t.Run("case-version", func(t *testing.T) {
+		rec := do(http.MethodPost, "/files", nil, map[string]string{X_Tus_Resumable: "0.2.2", X_Upload_Length: "10"})
+		assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
+	})
+
+	t.Run("case-too-large", func(t *testing.T) {
+		rec := do(http.MethodPost, "/files", nil, map[string]string{X_Upload_Length: "65"})
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	})
+
+	t.Run("case-upload", func(t *testing.T) {
+		// 1. 创建
+		var (
+			data = []byte("hello tus upload")
+			meta = "filename " + base64.StdEncoding.EncodeToString([]byte("a.txt"))
+		)
+		rec := do(http.MethodPost, "/files", nil, map[string]string{X_Upload_Length: "16", X_Upload_Metadata: meta})
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		loc := rec.Header().Get("Location")
+		assert.True(t, strings.HasPrefix(loc, "/files/"))
+		assert.Equal(t, "0", rec.Header().Get(X_Upload_Offset))
+
+		// 2. 首块数据不满分片
+		patch := map[string]string{"Content-Type": TusContentType, X_Upload_Offset: "0"}
+		rec = do(http.MethodPatch, loc, data[:6], patch)
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		assert.Equal(t, "6", rec.Header().Get(X_Upload_Offset))
+		id := path.Base(loc)
+		assert.NotContains(t, cache.kv["3rd:tus:"+id], "tail")
+		assert.Equal(t, "o ", cache.kv["3rd:tus:"+id+":tail"])
+
+		// 3. 偏移不一致
+		rec = do(http.MethodPatch, loc, data[6:], patch)
+		assert.Equal(t, http.StatusConflict, rec.Code)
+		assert.Equal(t, "6", rec.Header().Get(X_Upload_Offset))
+
+		// 4. 查询状态
+		rec = do(http.MethodHead, loc, nil, nil)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "6", rec.Header().Get(X_Upload_Offset))
+		assert.Equal(t, "16", rec.Header().Get(X_Upload_Length))
+		assert.Equal(t, meta, rec.Header().Get(X_Upload_Metadata))
+
+		// 5. 续传剩余数据
+		patch[X_Upload_Offset] = "6"
+		rec = do(http.MethodPatch, loc, data[6:], patch)
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		assert.Equal(t, "16", rec.Header().Get(X_Upload_Offset))
+		upload := <-completed
+		assert.Equal(t, "a.txt", upload.Metadata["filename"])
+		assert.Equal(t, data, s3.objects[upload.Name])
+
+		// 6. 删除
+		rec = do(http.MethodDelete, loc, nil, nil)
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		rec = do(http.MethodHead, loc, nil, nil)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+		_, ok := s3.objects[upload.Name]
+		assert.False(t, ok)
+	})
+
+	t.Run("case-upload-uneven", func(t *testing.T) {
+		// 长度不是分片大小的整数倍
+		data := []byte("abcdef")
+		rec := do(http.MethodPost, "/files", nil, map[string]string{X_Upload_Length: "6"})
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		loc := rec.Header().Get("Location")
+
+		rec = do(http.MethodPatch, loc, data, map[string]string{"Content-Type": TusContentType, X_Upload_Offset: "0"})
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		assert.Equal(t, "6", rec.Header().Get(X_Upload_Offset))
+		upload := <-completed
+		assert.Equal(t, int64(6), upload.Offset)
+		assert.Equal(t, data, s3.objects[upload.Name])
+
+		rec = do(http.MethodHead, loc, nil, nil)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "6", rec.Header().Get(X_Upload_Offset))
+	})
+
+	t.Run("case-content-type", func(t *testing.T) {
+		rec := do(http.MethodPost, "/files", nil, map[string]string{X_Upload_Length: "4"})
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		rec = do(http.MethodPatch, rec.Header().Get("Location"), []byte("abcd"), map[string]string{X_Upload_Offset: "0"})
+		assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+	})
+}
+
+func Test_tus_lock(t *testing.T) {
+	logger, err := logx.NewLogger("debug")
+	assert.Nil(t, err)
+
+	var (
+		ctx   = context.TODO()
+		s3    = newTestMemS3()
+		cache = newTestMemCache()
+		h     = NewTusUpload(ctx, logger, s3, cache, cache, WithTusPartSize(4), WithTusLockTTL(30*time.Millisecond))
+	)
+	s, err := newHttpSrv(ctx, logger, WithHttpTus("/files", h))
+	assert.Nil(t, err)
+
+	do := func(method, path string, body io.Reader, hdr map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, body)
+		req.Header.Set(X_Tus_Resumable, TusVersion)
+		for k, v := range hdr {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		s.srv.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do(http.MethodPost, "/files", nil, map[string]string{X_Upload_Length: "8"})
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	var (
+		loc    = rec.Header().Get("Location")
+		patch  = map[string]string{"Content-Type": TusContentType, X_Upload_Offset: "0"}
+		pr, pw = io.Pipe()
+		done   = make(chan *httptest.ResponseRecorder)
+	)
+
+	// 1. 慢速请求体, 写入时间超过锁时长
+	go func() { done <- do(http.MethodPatch, loc, pr, patch) }()
+	_, err = pw.Write([]byte("abcd"))
+	assert.Nil(t, err)
+	time.Sleep(100 * time.Millisecond)
+
+	// 2. 锁已续期, 并发写入被拒绝
+	rec = do(http.MethodPatch, loc, strings.NewReader("abcd"), patch)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Contains(t, rec.Body.String(), ErrTusUploadLocked.Error())
+
+	// 3. 慢速请求完成
+	_, err = pw.Write([]byte("efgh"))
+	assert.Nil(t, err)
+	pw.Close()
+	rec = <-done
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, "8", rec.Header().Get(X_Upload_Offset))
+}
@@ -0,0 +1,282 @@
+package tracex
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/advancevillage/3rd/logx"
+	"github.com/advancevillage/3rd/x"
+)
+
+// Exporter 导出结束的span
+type Exporter interface {
+	Export(ctx context.Context, spans []SpanData) error
+	Shutdown(ctx context.Context) error
+}
+
+var _ Exporter = (*fileExporter)(nil)
+
+// fileExporter 每行一个span的JSON
+type fileExporter struct {
+	mu sync.Mutex
+	w  *logx.RotateWriter
+}
+
+// NewFileExporter 导出到本地JSON文件, 按FileOption切割, 便于本地调试或由采集器读取
+func NewFileExporter(path string, opt ...logx.FileOption) (Exporter, error) {
+	w, err := logx.NewRotateWriter(path, opt...)
+	if err != nil {
+		return nil, err
+	}
+	return &fileExporter{w: w}, nil
+}
+
+func (e *fileExporter) Export(ctx context.Context, spans []SpanData) error {
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	for i := range spans {
+		err := enc.Encode(&spans[i])
+		if err != nil {
+			return err
+		}
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, err := e.w.Write(buf.Bytes())
+	return err
+}
+
+func (e *fileExporter) Shutdown(ctx context.Context) error {
+	return e.w.Close()
+}
+
+type OTLPOption = x.Options[otlpOption]
+
+// WithOTLPHeader 附加请求头, 如鉴权
+func WithOTLPHeader(key string, val string) OTLPOption {
+	return x.NewFuncOptions(func(o *otlpOption) {
+		o.hdr.Set(key, val)
+	})
+}
+
+func WithOTLPTimeout(timeout time.Duration) OTLPOption {
+	return x.NewFuncOptions(func(o *otlpOption) {
+		o.timeout = timeout
+	})
+}
+
+type otlpOption struct {
+	hdr     http.Header
+	timeout time.Duration
+}
+
+var _ Exporter = (*otlpExporter)(nil)
+
+type otlpExporter struct {
+	opts     otlpOption
+	logger   logx.ILogger
+	endpoint string
+	client   *http.Client
+}
+
+// NewOTLPExporter 以OTLP/HTTP JSON编码导出到采集器
+// endpoint 如 http://127.0.0.1:4318, 未带路径时追加/v1/traces
+func NewOTLPExporter(ctx context.Context, logger logx.ILogger, endpoint string, opt ...OTLPOption) (Exporter, error) {
+	// 1. 设置配置
+	opts := otlpOption{hdr: http.Header{}, timeout: 10 * time.Second}
+	for _, o := range opt {
+		o.Apply(&opts)
+	}
+	// 2. 默认路径
+	if !strings.HasSuffix(endpoint, "/v1/traces") {
+		endpoint = strings.TrimRight(endpoint, "/") + "/v1/traces"
+	}
+	return &otlpExporter{
+		opts:     opts,
+		logger:   logger,
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: opts.timeout},
+	}, nil
+}
+
+func (e *otlpExporter) Export(ctx context.Context, spans []SpanData) error {
+	// 1. 编码
+	body, err := json.Marshal(newOTLPRequest(spans))
+	if err != nil {
+		return err
+	}
+	// 2. 发送
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range e.opts.hdr {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// 3. 响应
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("tracex: otlp export status %d: %s", resp.StatusCode, msg)
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+func (e *otlpExporter) Shutdown(ctx context.Context) error {
+	e.client.CloseIdleConnections()
+	return nil
+}
+
+// OTLP JSON编码
+// https://opentelemetry.io/docs/specs/otlp/#json-protobuf-encoding
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceId           string         `json:"traceId"`
+	SpanId            string         `json:"spanId"`
+	ParentSpanId      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Events            []otlpEvent    `json:"events,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpEvent struct {
+	TimeUnixNano string         `json:"timeUnixNano"`
+	Name         string         `json:"name"`
+	Attributes   []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"` // int64按字符串编码
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+func newOTLPRequest(spans []SpanData) *otlpRequest {
+	// 1. 按服务分组
+	var (
+		services = []string{}
+		groups   = map[string][]otlpSpan{}
+	)
+	for i := range spans {
+		s := &spans[i]
+		if _, ok := groups[s.Service]; !ok {
+			services = append(services, s.Service)
+		}
+		groups[s.Service] = append(groups[s.Service], otlpSpan{
+			TraceId:           s.TraceId,
+			SpanId:            s.SpanId,
+			ParentSpanId:      s.ParentSpanId,
+			Name:              s.Name,
+			Kind:              int(s.kindOf()),
+			StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+			Attributes:        newOTLPAttributes(s.Attributes),
+			Events:            newOTLPEvents(s.Events),
+			Status:            otlpStatus{Code: int(s.StatusCode), Message: s.StatusMessage},
+		})
+	}
+	// 2. 组装
+	req := &otlpRequest{}
+	for _, svc := range services {
+		req.ResourceSpans = append(req.ResourceSpans, otlpResourceSpans{
+			Resource:   otlpResource{Attributes: newOTLPAttributes([]Attribute{{Key: "service.name", Value: svc}})},
+			ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "github.com/advancevillage/3rd/tracex"}, Spans: groups[svc]}},
+		})
+	}
+	return req
+}
+
+func (s *SpanData) kindOf() SpanKind {
+	for k := SpanKindInternal; k <= SpanKindConsumer; k++ {
+		if k.String() == s.Kind {
+			return k
+		}
+	}
+	return SpanKindInternal
+}
+
+func newOTLPEvents(events []Event) []otlpEvent {
+	out := make([]otlpEvent, 0, len(events))
+	for _, e := range events {
+		out = append(out, otlpEvent{
+			TimeUnixNano: strconv.FormatInt(e.Time.UnixNano(), 10),
+			Name:         e.Name,
+			Attributes:   newOTLPAttributes(e.Attributes),
+		})
+	}
+	return out
+}
+
+func newOTLPAttributes(attrs []Attribute) []otlpKeyValue {
+	out := make([]otlpKeyValue, 0, len(attrs))
+	for _, a := range attrs {
+		var v otlpValue
+		switch val := a.Value.(type) {
+		case bool:
+			v.BoolValue = &val
+		case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+			s := fmt.Sprint(val)
+			v.IntValue = &s
+		case float32:
+			f := float64(val)
+			v.DoubleValue = &f
+		case float64:
+			v.DoubleValue = &val
+		default:
+			s := fmt.Sprint(val)
+			v.StringValue = &s
+		}
+		out = append(out, otlpKeyValue{Key: a.Key, Value: v})
+	}
+	return out
+}
@@ -0,0 +1,92 @@
+package tracex
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// W3C Trace Context
+// https://www.w3.org/TR/trace-context/
+const (
+	Traceparent = "traceparent"
+	Tracestate  = "tracestate"
+)
+
+// Carrier 传播载体, 如HTTP请求头、gRPC元数据、消息字段
+type Carrier interface {
+	Get(key string) string
+	Set(key string, val string)
+}
+
+var _ Carrier = HeaderCarrier{}
+
+type HeaderCarrier http.Header
+
+func (c HeaderCarrier) Get(key string) string      { return http.Header(c).Get(key) }
+func (c HeaderCarrier) Set(key string, val string) { http.Header(c).Set(key, val) }
+
+var _ Carrier = MapCarrier{}
+
+type MapCarrier map[string]string
+
+func (c MapCarrier) Get(key string) string      { return c[key] }
+func (c MapCarrier) Set(key string, val string) { c[key] = val }
+
+// FormatTraceparent version-traceid-parentid-flags
+func FormatTraceparent(sc SpanContext) string {
+	return fmt.Sprintf("00-%s-%s-%02x", sc.TraceId, sc.SpanId, sc.Flags)
+}
+
+// ParseTraceparent 解析traceparent, 未知版本按00格式解析前四段
+func ParseTraceparent(tp string) (SpanContext, error) {
+	var (
+		sc    SpanContext
+		parts = strings.Split(strings.TrimSpace(tp), "-")
+	)
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return sc, ErrInvalidTraceparent
+	}
+	if len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, ErrInvalidTraceparent
+	}
+	if _, err := hex.Decode(sc.TraceId[:], []byte(parts[1])); err != nil {
+		return sc, ErrInvalidTraceparent
+	}
+	if _, err := hex.Decode(sc.SpanId[:], []byte(parts[2])); err != nil {
+		return sc, ErrInvalidTraceparent
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return sc, ErrInvalidTraceparent
+	}
+	sc.Flags = flags[0]
+	if !sc.IsValid() {
+		return sc, ErrInvalidTraceparent
+	}
+	return sc, nil
+}
+
+// Inject 写入当前链路上下文, 无链路时不写入
+func Inject(ctx context.Context, c Carrier) {
+	sc := SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return
+	}
+	c.Set(Traceparent, FormatTraceparent(sc))
+	if len(sc.State) > 0 {
+		c.Set(Tracestate, sc.State)
+	}
+}
+
+// Extract 读取上游链路上下文, 非法时原样返回
+func Extract(ctx context.Context, c Carrier) context.Context {
+	sc, err := ParseTraceparent(c.Get(Traceparent))
+	if err != nil {
+		return ctx
+	}
+	sc.State = c.Get(Tracestate)
+	return ContextWithRemoteSpanContext(ctx, sc)
+}
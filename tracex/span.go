@@ -0,0 +1,281 @@
+package tracex
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	ErrInvalidTraceparent = errors.New("tracex: invalid traceparent")
+)
+
+// TraceID W3C trace-id, 16字节
+type TraceID [16]byte
+
+// SpanID W3C parent-id, 8字节
+type SpanID [8]byte
+
+func (t TraceID) IsValid() bool  { return t != TraceID{} }
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+func (s SpanID) IsValid() bool   { return s != SpanID{} }
+func (s SpanID) String() string  { return hex.EncodeToString(s[:]) }
+
+func newTraceID() TraceID {
+	var t TraceID
+	rand.Read(t[:])
+	return t
+}
+
+func newSpanID() SpanID {
+	var s SpanID
+	rand.Read(s[:])
+	return s
+}
+
+// ParseTraceID 解析32位十六进制, 兼容带连字符的UUID
+func ParseTraceID(s string) (TraceID, error) {
+	var (
+		t   TraceID
+		buf = make([]byte, 0, 32)
+	)
+	for i := 0; i < len(s); i++ {
+		if s[i] != '-' {
+			buf = append(buf, s[i])
+		}
+	}
+	if len(buf) != 32 {
+		return t, ErrInvalidTraceparent
+	}
+	_, err := hex.Decode(t[:], buf)
+	if err != nil || !t.IsValid() {
+		return t, ErrInvalidTraceparent
+	}
+	return t, nil
+}
+
+const FlagsSampled = byte(0x01)
+
+// SpanContext 跨进程传播的链路上下文
+type SpanContext struct {
+	TraceId TraceID
+	SpanId  SpanID
+	Flags   byte   // trace-flags
+	State   string // tracestate 原样透传
+	Remote  bool   // 来自上游
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceId.IsValid() && sc.SpanId.IsValid()
+}
+
+func (sc SpanContext) IsSampled() bool {
+	return sc.Flags&FlagsSampled != 0
+}
+
+type SpanKind int
+
+// 取值与OTLP一致
+const (
+	SpanKindInternal SpanKind = iota + 1
+	SpanKindServer
+	SpanKindClient
+	SpanKindProducer
+	SpanKindConsumer
+)
+
+func (k SpanKind) String() string {
+	switch k {
+	case SpanKindServer:
+		return "server"
+	case SpanKindClient:
+		return "client"
+	case SpanKindProducer:
+		return "producer"
+	case SpanKindConsumer:
+		return "consumer"
+	default:
+		return "internal"
+	}
+}
+
+type StatusCode int
+
+// 取值与OTLP一致
+const (
+	StatusUnset StatusCode = iota
+	StatusOk
+	StatusError
+)
+
+// Attribute 有序键值
+type Attribute struct {
+	Key   string      `json:"key"`
+	Value interface{} `json:"value"`
+}
+
+type Event struct {
+	Name       string      `json:"name"`
+	Time       time.Time   `json:"time"`
+	Attributes []Attribute `json:"attributes,omitempty"`
+}
+
+// SpanData 结束的span, 交给Exporter导出
+type SpanData struct {
+	Service       string      `json:"service"`
+	Name          string      `json:"name"`
+	Kind          string      `json:"kind"`
+	TraceId       string      `json:"traceId"`
+	SpanId        string      `json:"spanId"`
+	ParentSpanId  string      `json:"parentSpanId,omitempty"`
+	Start         time.Time   `json:"start"`
+	End           time.Time   `json:"end"`
+	Attributes    []Attribute `json:"attributes,omitempty"`
+	Events        []Event     `json:"events,omitempty"`
+	StatusCode    StatusCode  `json:"statusCode"`
+	StatusMessage string      `json:"statusMessage,omitempty"`
+}
+
+// Span 一次操作, 由Tracer.Start创建, 必须调用End
+type Span interface {
+	SpanContext() SpanContext
+	// IsRecording 未采样的span不记录属性和事件
+	IsRecording() bool
+	SetAttributes(keysAndValues ...interface{})
+	AddEvent(name string, keysAndValues ...interface{})
+	// SetStatus 设置状态, 出错时使用RecordError
+	SetStatus(code StatusCode, msg string)
+	// RecordError 记录异常事件并将状态置为错误
+	RecordError(err error)
+	End()
+}
+
+var _ Span = (*span)(nil)
+
+type span struct {
+	mu     sync.Mutex
+	tracer *tracer
+	sc     SpanContext
+	data   SpanData
+	ended  bool
+}
+
+func (s *span) SpanContext() SpanContext {
+	return s.sc
+}
+
+func (s *span) IsRecording() bool {
+	return s.tracer != nil && s.sc.IsSampled()
+}
+
+func (s *span) SetAttributes(keysAndValues ...interface{}) {
+	if !s.IsRecording() {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Attributes = appendAttributes(s.data.Attributes, keysAndValues)
+}
+
+func (s *span) AddEvent(name string, keysAndValues ...interface{}) {
+	if !s.IsRecording() {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Events = append(s.data.Events, Event{Name: name, Time: time.Now(), Attributes: appendAttributes(nil, keysAndValues)})
+}
+
+func (s *span) SetStatus(code StatusCode, msg string) {
+	if !s.IsRecording() {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.StatusCode = code
+	s.data.StatusMessage = msg
+}
+
+func (s *span) RecordError(err error) {
+	if err == nil {
+		return
+	}
+	s.AddEvent("exception", "exception.message", err.Error(), "exception.type", fmt.Sprintf("%T", err))
+	s.SetStatus(StatusError, err.Error())
+}
+
+func (s *span) End() {
+	if !s.IsRecording() {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	data := s.data
+	s.mu.Unlock()
+	s.tracer.export(data)
+}
+
+// appendAttributes 同名属性覆盖
+func appendAttributes(attrs []Attribute, keysAndValues []interface{}) []Attribute {
+	for i := 0; i+1 < len(keysAndValues); i += 2 {
+		var (
+			k     = fmt.Sprint(keysAndValues[i])
+			v     = keysAndValues[i+1]
+			found = false
+		)
+		for j := range attrs {
+			if attrs[j].Key == k {
+				attrs[j].Value, found = v, true
+				break
+			}
+		}
+		if !found {
+			attrs = append(attrs, Attribute{Key: k, Value: v})
+		}
+	}
+	return attrs
+}
+
+type ctxKeySpan struct{}
+type ctxKeyRemote struct{}
+
+// SpanFromContext 当前span, 不存在时返回不记录的空span
+func SpanFromContext(ctx context.Context) Span {
+	if s, ok := ctx.Value(ctxKeySpan{}).(Span); ok {
+		return s
+	}
+	return &span{sc: remoteFromContext(ctx)}
+}
+
+// SpanContextFromContext 当前span或上游传入的链路上下文
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	if s, ok := ctx.Value(ctxKeySpan{}).(Span); ok {
+		return s.SpanContext()
+	}
+	return remoteFromContext(ctx)
+}
+
+// ContextWithSpan 将span放入上下文
+func ContextWithSpan(ctx context.Context, s Span) context.Context {
+	return context.WithValue(ctx, ctxKeySpan{}, s)
+}
+
+// ContextWithRemoteSpanContext 放入上游链路上下文, 后续Start以其为父节点
+func ContextWithRemoteSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	sc.Remote = true
+	return context.WithValue(ctx, ctxKeyRemote{}, sc)
+}
+
+func remoteFromContext(ctx context.Context) SpanContext {
+	sc, _ := ctx.Value(ctxKeyRemote{}).(SpanContext)
+	return sc
+}
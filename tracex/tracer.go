@@ -0,0 +1,287 @@
+package tracex
+
+import (
+	"context"
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"github.com/advancevillage/3rd/logx"
+	"github.com/advancevillage/3rd/x"
+)
+
+// Tracer 创建span, 结束的span批量交给Exporter导出
+type Tracer interface {
+	// Start 以上下文中的span或上游链路为父节点创建span, 返回的上下文携带span及日志字段
+	Start(ctx context.Context, name string, opt ...SpanOption) (context.Context, Span)
+	// Shutdown 导出剩余span并关闭Exporter
+	Shutdown(ctx context.Context) error
+}
+
+type TracerOption = x.Options[tracerOption]
+
+// WithTracerService 服务名称, 对应OTLP资源属性service.name
+func WithTracerService(service string) TracerOption {
+	return x.NewFuncOptions(func(o *tracerOption) {
+		o.service = service
+	})
+}
+
+// WithTracerExporter 导出器, 未设置时只生成链路id用于传播和日志, 不导出
+func WithTracerExporter(exp Exporter) TracerOption {
+	return x.NewFuncOptions(func(o *tracerOption) {
+		o.exporter = exp
+	})
+}
+
+// WithTracerSampleRatio 根span采样比例[0,1], 子span跟随父节点
+func WithTracerSampleRatio(ratio float64) TracerOption {
+	return x.NewFuncOptions(func(o *tracerOption) {
+		o.ratio = min(max(ratio, 0), 1)
+	})
+}
+
+// WithTracerBatch 批量导出, 攒够size条或每隔interval导出一次, 队列满时丢弃
+func WithTracerBatch(size int, interval time.Duration, queue int) TracerOption {
+	return x.NewFuncOptions(func(o *tracerOption) {
+		o.batch = max(size, 1)
+		o.interval = interval
+		o.queue = max(queue, size)
+	})
+}
+
+type tracerOption struct {
+	service  string        // 服务名称
+	exporter Exporter      // 导出器
+	ratio    float64       // 采样比例
+	batch    int           // 批量大小
+	interval time.Duration // 导出间隔
+	queue    int           // 队列长度
+}
+
+var defaultTracerOptions = tracerOption{
+	service:  "3rd",
+	ratio:    1,
+	batch:    128,
+	interval: 5 * time.Second,
+	queue:    2048,
+}
+
+type SpanOption = x.Options[spanOption]
+
+func WithSpanKind(kind SpanKind) SpanOption {
+	return x.NewFuncOptions(func(o *spanOption) {
+		o.kind = kind
+	})
+}
+
+func WithSpanAttributes(keysAndValues ...interface{}) SpanOption {
+	return x.NewFuncOptions(func(o *spanOption) {
+		o.attrs = append(o.attrs, keysAndValues...)
+	})
+}
+
+type spanOption struct {
+	kind  SpanKind
+	attrs []interface{}
+}
+
+var _ Tracer = (*tracer)(nil)
+
+type tracer struct {
+	opts   tracerOption
+	logger logx.ILogger
+	queue  chan SpanData
+	flush  chan chan struct{}
+	done   chan struct{}
+	exit   chan struct{}
+	once   sync.Once
+}
+
+func NewTracer(ctx context.Context, logger logx.ILogger, opt ...TracerOption) (Tracer, error) {
+	return newTracer(ctx, logger, opt...), nil
+}
+
+func newTracer(ctx context.Context, logger logx.ILogger, opt ...TracerOption) *tracer {
+	// 1. 设置配置
+	opts := defaultTracerOptions
+	for _, o := range opt {
+		o.Apply(&opts)
+	}
+	t := &tracer{
+		opts:   opts,
+		logger: logger,
+		queue:  make(chan SpanData, opts.queue),
+		flush:  make(chan chan struct{}),
+		done:   make(chan struct{}),
+		exit:   make(chan struct{}),
+	}
+	// 2. 无导出器不采样
+	if opts.exporter == nil {
+		t.opts.ratio = 0
+		close(t.exit)
+		return t
+	}
+	go t.loop(ctx)
+	return t
+}
+
+func (t *tracer) Start(ctx context.Context, name string, opt ...SpanOption) (context.Context, Span) {
+	// 1. 设置配置
+	opts := spanOption{kind: SpanKindInternal}
+	for _, o := range opt {
+		o.Apply(&opts)
+	}
+
+	// 2. 父节点
+	var (
+		parent = SpanContextFromContext(ctx)
+		sc     = SpanContext{SpanId: newSpanID()}
+	)
+	if parent.IsValid() {
+		sc.TraceId, sc.Flags, sc.State = parent.TraceId, parent.Flags, parent.State
+	} else {
+		sc.TraceId = t.rootTraceID(ctx)
+		if t.sample(sc.TraceId) {
+			sc.Flags = FlagsSampled
+		}
+	}
+
+	// 3. 创建span
+	s := &span{tracer: t, sc: sc}
+	if s.IsRecording() {
+		s.data = SpanData{
+			Service:    t.opts.service,
+			Name:       name,
+			Kind:       opts.kind.String(),
+			TraceId:    sc.TraceId.String(),
+			SpanId:     sc.SpanId.String(),
+			Start:      time.Now(),
+			Attributes: appendAttributes(nil, opts.attrs),
+		}
+		if parent.IsValid() {
+			s.data.ParentSpanId = parent.SpanId.String()
+		}
+	}
+
+	// 4. 日志字段, 已有trace时保持原值
+	ctx = ContextWithSpan(ctx, s)
+	if trace, ok := logx.TraceKey.Value(ctx); !ok || len(trace) <= 0 {
+		ctx = logx.TraceKey.WithValue(ctx, sc.TraceId.String())
+	}
+	ctx = logx.SpanKey.WithValue(ctx, sc.SpanId.String())
+	return ctx, s
+}
+
+// rootTraceID 沿用上下文中UUID格式的日志trace, 使日志与链路id一致
+func (t *tracer) rootTraceID(ctx context.Context) TraceID {
+	if trace, ok := logx.TraceKey.Value(ctx); ok {
+		if id, err := ParseTraceID(trace); err == nil {
+			return id
+		}
+	}
+	return newTraceID()
+}
+
+// sample 按trace id确定性采样, 同一trace在各服务结果一致
+func (t *tracer) sample(id TraceID) bool {
+	switch {
+	case t.opts.ratio >= 1:
+		return true
+	case t.opts.ratio <= 0:
+		return false
+	default:
+		return binary.BigEndian.Uint64(id[8:])>>1 < uint64(t.opts.ratio*(1<<63))
+	}
+}
+
+func (t *tracer) export(data SpanData) {
+	select {
+	case t.queue <- data:
+	default:
+		t.logger.Warnw(context.TODO(), "tracex: span queue full, dropped", "name", data.Name, "traceId", data.TraceId)
+	}
+}
+
+func (t *tracer) loop(ctx context.Context) {
+	var (
+		ectx  = context.WithoutCancel(ctx) // 退出时仍需导出剩余span
+		tk    = time.NewTicker(t.opts.interval)
+		batch = make([]SpanData, 0, t.opts.batch)
+	)
+	defer tk.Stop()
+	defer close(t.exit)
+
+	send := func() {
+		if len(batch) <= 0 {
+			return
+		}
+		err := t.opts.exporter.Export(ectx, batch)
+		if err != nil {
+			t.logger.Warnw(ectx, "tracex: export spans failed", "err", err, "count", len(batch))
+		}
+		batch = make([]SpanData, 0, t.opts.batch)
+	}
+	drain := func() {
+		for {
+			select {
+			case data := <-t.queue:
+				batch = append(batch, data)
+				if len(batch) >= t.opts.batch {
+					send()
+				}
+			default:
+				send()
+				return
+			}
+		}
+	}
+
+	for {
+		select {
+		case data := <-t.queue:
+			batch = append(batch, data)
+			if len(batch) >= t.opts.batch {
+				send()
+			}
+		case <-tk.C:
+			send()
+		case ch := <-t.flush:
+			drain()
+			close(ch)
+		case <-t.done:
+			drain()
+			return
+		case <-ctx.Done():
+			drain()
+			return
+		}
+	}
+}
+
+// forceFlush 立即导出队列中的span
+func (t *tracer) forceFlush() {
+	ch := make(chan struct{})
+	select {
+	case t.flush <- ch:
+		<-ch
+	case <-t.exit:
+	}
+}
+
+func (t *tracer) Shutdown(ctx context.Context) error {
+	t.once.Do(func() {
+		if t.opts.exporter != nil {
+			close(t.done)
+		}
+	})
+	select {
+	case <-t.exit:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if t.opts.exporter == nil {
+		return nil
+	}
+	return t.opts.exporter.Shutdown(ctx)
+}
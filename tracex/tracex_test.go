@@ -0,0 +1,223 @@
+package tracex
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/advancevillage/3rd/logx"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_traceparent(t *testing.T) {
+	var data = map[string]struct {
+		tp    string
+		err   error
+		trace string
+		span  string
+		flags byte
+	}{
+		"case-valid": {
+			tp:    "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			trace: "4bf92f3577b34da6a3ce929d0e0e4736",
+			span:  "00f067aa0ba902b7",
+			flags: 0x01,
+		},
+		"case-future-version": {
+			tp:    "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-extra",
+			trace: "4bf92f3577b34da6a3ce929d0e0e4736",
+			span:  "00f067aa0ba902b7",
+		},
+		"case-zero-trace": {
+			tp:  "00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+			err: ErrInvalidTraceparent,
+		},
+		"case-bad-version": {
+			tp:  "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			err: ErrInvalidTraceparent,
+		},
+		"case-extra-v00": {
+			tp:  "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+			err: ErrInvalidTraceparent,
+		},
+		"case-not-hex": {
+			tp:  "00-4bf92f3577b34da6a3ce929d0e0e473z-00f067aa0ba902b7-01",
+			err: ErrInvalidTraceparent,
+		},
+	}
+	for n, v := range data {
+		f := func(t *testing.T) {
+			sc, err := ParseTraceparent(v.tp)
+			assert.Equal(t, v.err, err)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, v.trace, sc.TraceId.String())
+			assert.Equal(t, v.span, sc.SpanId.String())
+			assert.Equal(t, v.flags, sc.Flags)
+			if v.tp[:2] == "00" {
+				assert.Equal(t, v.tp, FormatTraceparent(sc))
+			}
+		}
+		t.Run(n, f)
+	}
+}
+
+func Test_tracer(t *testing.T) {
+	var (
+		ctx    = context.TODO()
+		dir    = t.TempDir()
+		path   = filepath.Join(dir, "spans.json")
+		logger = logx.NewObservedLogger()
+	)
+	exp, err := NewFileExporter(path)
+	assert.Nil(t, err)
+	tr := newTracer(ctx, logger, WithTracerService("svc"), WithTracerExporter(exp))
+
+	// 1. 上游链路
+	hdr := http.Header{}
+	hdr.Set(Traceparent, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	hdr.Set(Tracestate, "vendor=1")
+	ctx = Extract(ctx, HeaderCarrier(hdr))
+
+	// 2. 父子span
+	pctx, parent := tr.Start(ctx, "parent", WithSpanKind(SpanKindServer), WithSpanAttributes("k", "v"))
+	cctx, child := tr.Start(pctx, "child")
+	child.AddEvent("cache miss", "key", "a")
+	child.RecordError(errors.New("boom"))
+	logger.Infow(cctx, "in child")
+	child.End()
+	parent.End()
+	parent.End()
+
+	// 3. 向下游传播
+	out := MapCarrier{}
+	Inject(cctx, out)
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-"+child.SpanContext().SpanId.String()+"-01", out[Traceparent])
+	assert.Equal(t, "vendor=1", out[Tracestate])
+
+	// 4. 日志字段
+	e := logger.FilterMessage("in child")[0]
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", e.Fields[logx.TraceId])
+	assert.Equal(t, child.SpanContext().SpanId.String(), e.Fields[logx.SpanKey.Name()])
+
+	// 5. 导出
+	assert.Nil(t, tr.Shutdown(context.TODO()))
+	fd, err := os.Open(path)
+	assert.Nil(t, err)
+	defer fd.Close()
+	spans := []SpanData{}
+	sc := bufio.NewScanner(fd)
+	for sc.Scan() {
+		s := SpanData{}
+		assert.Nil(t, json.Unmarshal(sc.Bytes(), &s))
+		spans = append(spans, s)
+	}
+	assert.Equal(t, 2, len(spans))
+	assert.Equal(t, "child", spans[0].Name)
+	assert.Equal(t, parent.SpanContext().SpanId.String(), spans[0].ParentSpanId)
+	assert.Equal(t, StatusError, spans[0].StatusCode)
+	assert.Equal(t, 2, len(spans[0].Events))
+	assert.Equal(t, "parent", spans[1].Name)
+	assert.Equal(t, "00f067aa0ba902b7", spans[1].ParentSpanId)
+	assert.Equal(t, "server", spans[1].Kind)
+	assert.Equal(t, "svc", spans[1].Service)
+}
+
+func Test_tracer_root(t *testing.T) {
+	var data = map[string]struct {
+		opts      []TracerOption
+		trace     string
+		recording bool
+	}{
+		"case-uuid-trace": {
+			opts:      []TracerOption{WithTracerExporter(&memExporter{})},
+			trace:     "0b6f1c4e-3a8d-4d7e-9f2a-5c1b7e8d9a0f",
+			recording: true,
+		},
+		"case-no-exporter": {
+			trace: "0b6f1c4e-3a8d-4d7e-9f2a-5c1b7e8d9a0f",
+		},
+		"case-ratio-zero": {
+			opts: []TracerOption{WithTracerExporter(&memExporter{}), WithTracerSampleRatio(0)},
+		},
+	}
+	for n, v := range data {
+		f := func(t *testing.T) {
+			ctx := context.TODO()
+			if len(v.trace) > 0 {
+				ctx = logx.TraceKey.WithValue(ctx, v.trace)
+			}
+			tr, err := NewTracer(ctx, logx.NewNopLogger(), v.opts...)
+			assert.Nil(t, err)
+			ctx, span := tr.Start(ctx, "root")
+			assert.True(t, span.SpanContext().IsValid())
+			assert.Equal(t, v.recording, span.IsRecording())
+			if len(v.trace) > 0 {
+				assert.Equal(t, "0b6f1c4e3a8d4d7e9f2a5c1b7e8d9a0f", span.SpanContext().TraceId.String())
+				trace, _ := logx.TraceKey.Value(ctx)
+				assert.Equal(t, v.trace, trace)
+			}
+			span.End()
+			assert.Nil(t, tr.Shutdown(context.TODO()))
+		}
+		t.Run(n, f)
+	}
+}
+
+func Test_otlp(t *testing.T) {
+	var (
+		ctx  = context.TODO()
+		body = make(chan []byte, 1)
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/traces", r.URL.Path)
+		assert.Equal(t, "secret", r.Header.Get("X-Token"))
+		buf, _ := io.ReadAll(r.Body)
+		body <- buf
+		w.Write([]byte("{}"))
+	}))
+	defer srv.Close()
+
+	exp, err := NewOTLPExporter(ctx, logx.NewNopLogger(), srv.URL, WithOTLPHeader("X-Token", "secret"))
+	assert.Nil(t, err)
+	tr := newTracer(ctx, logx.NewNopLogger(), WithTracerService("svc"), WithTracerExporter(exp))
+	_, span := tr.Start(ctx, "op", WithSpanKind(SpanKindClient), WithSpanAttributes("n", 1, "ok", true, "s", "x"))
+	span.End()
+	tr.forceFlush()
+
+	buf := <-body
+	req := otlpRequest{}
+	assert.Nil(t, json.Unmarshal(buf, &req))
+	assert.Equal(t, 1, len(req.ResourceSpans))
+	assert.Equal(t, "svc", *req.ResourceSpans[0].Resource.Attributes[0].Value.StringValue)
+	s := req.ResourceSpans[0].ScopeSpans[0].Spans[0]
+	assert.Equal(t, "op", s.Name)
+	assert.Equal(t, int(SpanKindClient), s.Kind)
+	assert.Equal(t, span.SpanContext().TraceId.String(), s.TraceId)
+	assert.Equal(t, "1", *s.Attributes[0].Value.IntValue)
+	assert.True(t, *s.Attributes[1].Value.BoolValue)
+	assert.True(t, bytes.Contains(buf, []byte(`"startTimeUnixNano":"`)))
+	assert.Nil(t, tr.Shutdown(ctx))
+}
+
+type memExporter struct {
+	spans []SpanData
+}
+
+func (e *memExporter) Export(ctx context.Context, spans []SpanData) error {
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+func (e *memExporter) Shutdown(ctx context.Context) error {
+	return nil
+}
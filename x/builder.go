@@ -2,8 +2,10 @@ package x
 
 import (
 	"fmt"
+	"reflect"
 	"strings"
 	"sync"
+	"time"
 )
 
 func WithKV(key string, value any) Option {
@@ -14,7 +16,30 @@ func WithKV(key string, value any) Option {
 
 type Builder interface {
 	Value(key string) (any, bool)
+	// Build 取出全部键值并清空, 等价于Drain
 	Build() map[string]any
+	// Drain 取出全部键值并清空, 只能消费一次
+	Drain() map[string]any
+	// Snapshot 复制全部键值, 不清空
+	Snapshot() map[string]any
+
+	// 类型转换, 不存在或无法转换时返回默认值
+	String(key string, def string) string
+	Int64(key string, def int64) int64
+	Bool(key string, def bool) bool
+	Float(key string, def float64) float64
+	// Time 支持time.Time、RFC3339及2006-01-02 15:04:05格式、Unix秒或毫秒
+	Time(key string, def time.Time) time.Time
+	// Duration 支持time.Duration、1m30s格式, 数值按秒
+	Duration(key string, def time.Duration) time.Duration
+
+	// Clone 复制为新的Builder
+	Clone() Builder
+	// Merge 依次写入others的键值, 同名键后者覆盖, 返回自身
+	Merge(others ...Builder) Builder
+	// Decode 按kv标签解析到结构体指针, 未设置标签时使用字段名
+	Decode(v any) error
+
 	write(key string, value any)
 }
 
@@ -39,6 +64,10 @@ func (o *builder) write(key string, value any) {
 }
 
 func (o *builder) Build() map[string]any {
+	return o.Drain()
+}
+
+func (o *builder) Drain() map[string]any {
 	m := make(map[string]any)
 	o.m.Range(func(key, value any) bool {
 		m[fmt.Sprint(key)] = value
@@ -48,6 +77,103 @@ func (o *builder) Build() map[string]any {
 	return m
 }
 
+func (o *builder) Snapshot() map[string]any {
+	m := make(map[string]any)
+	o.m.Range(func(key, value any) bool {
+		m[fmt.Sprint(key)] = value
+		return true
+	})
+	return m
+}
+
 func (o *builder) Value(key string) (any, bool) {
 	return o.m.Load(key)
 }
+
+func (o *builder) String(key string, def string) string {
+	return getAs(o, key, def, toString)
+}
+
+func (o *builder) Int64(key string, def int64) int64 {
+	return getAs(o, key, def, toInt64)
+}
+
+func (o *builder) Bool(key string, def bool) bool {
+	return getAs(o, key, def, toBool)
+}
+
+func (o *builder) Float(key string, def float64) float64 {
+	return getAs(o, key, def, toFloat)
+}
+
+func (o *builder) Time(key string, def time.Time) time.Time {
+	return getAs(o, key, def, toTime)
+}
+
+func (o *builder) Duration(key string, def time.Duration) time.Duration {
+	return getAs(o, key, def, toDuration)
+}
+
+func (o *builder) Clone() Builder {
+	c := &builder{}
+	o.m.Range(func(key, value any) bool {
+		c.m.Store(key, value)
+		return true
+	})
+	return c
+}
+
+func (o *builder) Merge(others ...Builder) Builder {
+	for _, b := range others {
+		if b == nil {
+			continue
+		}
+		for k, v := range b.Snapshot() {
+			o.write(k, v)
+		}
+	}
+	return o
+}
+
+func (o *builder) Decode(v any) error {
+	// 1. 参数检查
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("x: decode target must be a non-nil struct pointer, got %T", v)
+	}
+	rv = rv.Elem()
+
+	// 2. 按字段转换
+	t := rv.Type()
+	for i := range t.NumField() {
+		sf := t.Field(i)
+		key := sf.Tag.Get("kv")
+		if !sf.IsExported() || key == "-" {
+			continue
+		}
+		if len(key) <= 0 {
+			key = sf.Name
+		}
+		val, ok := o.Value(key)
+		if !ok || val == nil {
+			continue
+		}
+		err := decodeValue(rv.Field(i), val)
+		if err != nil {
+			return fmt.Errorf("x: decode %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+func getAs[T any](o *builder, key string, def T, conv func(any) (T, error)) T {
+	v, ok := o.Value(key)
+	if !ok || v == nil {
+		return def
+	}
+	r, err := conv(v)
+	if err != nil {
+		return def
+	}
+	return r
+}
@@ -2,6 +2,7 @@ package x_test
 
 import (
 	"testing"
+	"time"
 
 	"github.com/advancevillage/3rd/mathx"
 	"github.com/advancevillage/3rd/x"
@@ -34,3 +35,126 @@ func Test_builder(t *testing.T) {
 	}
 
 }
+
+func Test_builder_typed(t *testing.T) {
+	var (
+		now = time.Date(2025, 3, 1, 8, 0, 0, 0, time.Local)
+		b   = x.NewBuilder(
+			x.WithKV("s", "abc"),
+			x.WithKV("n", "42"),
+			x.WithKV("f", 1.5),
+			x.WithKV("i", 7),
+			x.WithKV("ok", "true"),
+			x.WithKV("ts", "1740787200"),
+			x.WithKV("ms", int64(1740787200000)),
+			x.WithKV("dt", "2025-03-01 08:00:00"),
+			x.WithKV("d", "1m30s"),
+			x.WithKV("sec", 90),
+		)
+	)
+	var data = map[string]struct {
+		act any
+		exp any
+	}{
+		"case-string":       {act: b.String("s", ""), exp: "abc"},
+		"case-string-num":   {act: b.String("i", ""), exp: "7"},
+		"case-string-def":   {act: b.String("none", "def"), exp: "def"},
+		"case-int64":        {act: b.Int64("n", 0), exp: int64(42)},
+		"case-int64-bad":    {act: b.Int64("s", -1), exp: int64(-1)},
+		"case-int64-float":  {act: b.Int64("f", -1), exp: int64(-1)},
+		"case-float":        {act: b.Float("n", 0), exp: 42.0},
+		"case-bool":         {act: b.Bool("ok", false), exp: true},
+		"case-bool-num":     {act: b.Bool("i", false), exp: true},
+		"case-time-unix":    {act: b.Time("ts", time.Time{}).Unix(), exp: int64(1740787200)},
+		"case-time-ms":      {act: b.Time("ms", time.Time{}).Unix(), exp: int64(1740787200)},
+		"case-time-layout":  {act: b.Time("dt", time.Time{}), exp: now},
+		"case-time-def":     {act: b.Time("s", now), exp: now},
+		"case-duration":     {act: b.Duration("d", 0), exp: 90 * time.Second},
+		"case-duration-sec": {act: b.Duration("sec", 0), exp: 90 * time.Second},
+	}
+	for n, v := range data {
+		f := func(t *testing.T) {
+			assert.Equal(t, v.exp, v.act)
+		}
+		t.Run(n, f)
+	}
+	assert.Equal(t, 10, len(b.Snapshot()))
+}
+
+func Test_builder_merge(t *testing.T) {
+	var (
+		a = x.NewBuilder(x.WithKV("k1", "a"), x.WithKV("k2", "a"))
+		b = x.NewBuilder(x.WithKV("k2", "b"), x.WithKV("k3", "b"))
+		c = a.Clone()
+	)
+	// 1. 合并后者覆盖, 不影响来源
+	assert.Equal(t, map[string]any{"k1": "a", "k2": "b", "k3": "b"}, c.Merge(b, nil).Snapshot())
+	assert.Equal(t, map[string]any{"k1": "a", "k2": "a"}, a.Snapshot())
+	assert.Equal(t, 2, len(b.Snapshot()))
+
+	// 2. Drain只能消费一次
+	assert.Equal(t, 3, len(c.Drain()))
+	assert.Equal(t, 0, len(c.Snapshot()))
+	assert.Equal(t, 2, len(a.Build()))
+	assert.Equal(t, 0, len(a.Build()))
+}
+
+type testClaims struct {
+	Uid     int64         `kv:"uid"`
+	Name    string        `kv:"name"`
+	Admin   bool          `kv:"admin"`
+	Score   float32       `kv:"score"`
+	Expire  time.Time     `kv:"exp"`
+	TTL     time.Duration `kv:"ttl"`
+	Tags    []string      `kv:"tags"`
+	Nick    *string       `kv:"nick"`
+	Skip    string        `kv:"-"`
+	Missing string
+}
+
+func Test_builder_decode(t *testing.T) {
+	nick := "rick"
+	var data = map[string]struct {
+		b   x.Builder
+		exp *testClaims
+		err string
+	}{
+		"case-strings": {
+			b: x.NewBuilder(
+				x.WithKV("uid", "1001"),
+				x.WithKV("name", "richard"),
+				x.WithKV("admin", "1"),
+				x.WithKV("score", "9.5"),
+				x.WithKV("exp", "1740787200"),
+				x.WithKV("ttl", "30m"),
+				x.WithKV("tags", `["a","b"]`),
+				x.WithKV("nick", "rick"),
+				x.WithKV("-", "x"),
+			),
+			exp: &testClaims{Uid: 1001, Name: "richard", Admin: true, Score: 9.5, Expire: time.Unix(1740787200, 0), TTL: 30 * time.Minute, Tags: []string{"a", "b"}, Nick: &nick},
+		},
+		"case-typed": {
+			b:   x.NewBuilder(x.WithKV("uid", int64(7)), x.WithKV("tags", []string{"c"}), x.WithKV("ttl", time.Second)),
+			exp: &testClaims{Uid: 7, Tags: []string{"c"}, TTL: time.Second},
+		},
+		"case-invalid": {
+			b:   x.NewBuilder(x.WithKV("uid", "abc")),
+			err: "x: decode uid",
+		},
+	}
+	for n, v := range data {
+		f := func(t *testing.T) {
+			act := &testClaims{}
+			err := v.b.Decode(act)
+			if len(v.err) > 0 {
+				assert.ErrorContains(t, err, v.err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, v.exp, act)
+			assert.NotEmpty(t, v.b.Snapshot())
+		}
+		t.Run(n, f)
+	}
+	assert.NotNil(t, x.NewBuilder().Decode(testClaims{}))
+}
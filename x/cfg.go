@@ -1,6 +1,7 @@
 package x
 
 import (
+	"fmt"
 	"io"
 	"os"
 
@@ -11,16 +12,26 @@ type Cfg struct {
 	App   *AppCfg  `yaml:"app"`
 	Log   *LogCfg  `yaml:"log"`
 	Creds *CredCfg `yaml:"creds"`
+
+	// 客户端按名称配置, 如redis.default.dsn
+	Redis map[string]*DsnCfg `yaml:"redis"` // redis://
+	Sql   map[string]*DsnCfg `yaml:"sql"`   // mysql://
+	Cos   map[string]*DsnCfg `yaml:"cos"`   // cos://ak:sk@bucket/region
+	Sms   map[string]*DsnCfg `yaml:"sms"`   // sms://ak:sk@region?sign=xx&app=xx&tmpl=xx
+	Sts   map[string]*DsnCfg `yaml:"sts"`   // sts://ak:sk@region
+	Idx   map[string]*DsnCfg `yaml:"idx"`   // idx://ak:sk@appid/region
+	Llm   map[string]*LlmCfg `yaml:"llm"`
 }
 
 type AppCfg struct {
-	Name string `yaml:"name"`
-	Host string `yaml:"host"`
-	Port int    `yaml:"port"`
+	Name string `yaml:"name" validate:"required"`
+	Host string `yaml:"host" default:"0.0.0.0"`
+	Port int    `yaml:"port" validate:"required,min=1,max=65535"`
 }
 
 type LogCfg struct {
-	Level string `yaml:"level"`
+	Level  string `yaml:"level" default:"info" validate:"oneof=debug info warn error"`
+	Format string `yaml:"format" validate:"oneof=json console logfmt"` // json console logfmt, 默认json
 }
 
 type CredCfg struct {
@@ -28,26 +39,104 @@ type CredCfg struct {
 }
 
 type MTlsCfg struct {
-	Cert string `yaml:"cert"`
-	Key  string `yaml:"key"`
+	Cert string `yaml:"cert" validate:"required"`
+	Key  string `yaml:"key" validate:"required"`
 }
 
-func NewCfg(filepath string) (*Cfg, error) {
-	fd, err := os.OpenFile(filepath, os.O_RDONLY, 0644)
+// DsnCfg 以DSN描述的客户端, 密钥可写为ENC(...)
+type DsnCfg struct {
+	Dsn string `yaml:"dsn" validate:"required"`
+}
+
+type LlmCfg struct {
+	BaseUrl string `yaml:"base_url"`
+	Model   string `yaml:"model"`
+	Secret  string `yaml:"secret" validate:"required"`
+	Mode    string `yaml:"mode" validate:"oneof=response chat"`
+}
+
+type CfgOption = Options[cfgOption]
+
+// WithCfgEnvPrefix 环境变量覆盖配置, 如前缀XMAGIC时XMAGIC_APP_PORT覆盖app.port
+func WithCfgEnvPrefix(prefix string) CfgOption {
+	return NewFuncOptions(func(o *cfgOption) {
+		o.prefix = prefix
+	})
+}
+
+// WithCfgKey 解密ENC(...)的密钥, 未设置时读取X_CFG_KEY或X_CFG_KEY_FILE
+func WithCfgKey(key []byte) CfgOption {
+	return NewFuncOptions(func(o *cfgOption) {
+		o.key = key
+	})
+}
+
+type cfgOption struct {
+	prefix string // 环境变量前缀, 为空不覆盖
+	key    []byte // 配置密钥
+}
+
+func NewCfg(filepath string, opt ...CfgOption) (*Cfg, error) {
+	c := &Cfg{}
+	err := DecodeCfg(filepath, c, opt...)
 	if err != nil {
 		return nil, err
 	}
+	return c, nil
+}
+
+// DecodeCfg 解析YAML配置到任意结构体, 依次执行:
+// ${VAR:-default}替换, 解析, 环境变量覆盖, ENC(...)解密, default标签默认值, validate标签校验
+func DecodeCfg(filepath string, v any, opt ...CfgOption) error {
+	// 1. 读取文件
+	fd, err := os.OpenFile(filepath, os.O_RDONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
 
 	buf, err := io.ReadAll(fd)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	return decodeCfg(filepath, buf, v, opt...)
+}
 
-	c := &Cfg{}
-	err = yaml.Unmarshal(buf, c)
+func decodeCfg(filepath string, buf []byte, v any, opt ...CfgOption) error {
+	// 0. 设置配置
+	opts := cfgOption{}
+	for _, o := range opt {
+		o.Apply(&opts)
+	}
+
+	// 2. 变量替换
+	buf, err := interpolateYaml(buf, os.LookupEnv)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("%s: %w", filepath, err)
+	}
+	err = yaml.Unmarshal(buf, v)
+	if err != nil {
+		return fmt.Errorf("%s: %w", filepath, err)
 	}
 
-	return c, nil
+	// 3. 环境变量覆盖
+	if len(opts.prefix) > 0 {
+		err = applyEnv(v, opts.prefix, os.Environ())
+		if err != nil {
+			return err
+		}
+	}
+
+	// 4. 解密ENC(...)
+	err = (&cfgDecrypter{key: opts.key}).decryptStruct(v)
+	if err != nil {
+		return err
+	}
+
+	// 5. 默认值和校验
+	err = applyDefaults(v)
+	if err != nil {
+		return err
+	}
+	return Validate(v)
 }
@@ -1,7 +1,11 @@
 package x_test
 
 import (
+	"errors"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/advancevillage/3rd/x"
 	"github.com/stretchr/testify/assert"
@@ -42,3 +46,92 @@ func Test_Cfg(t *testing.T) {
 		t.Run(n, f)
 	}
 }
+
+type testRedisCfg struct {
+	Dsn      string        `yaml:"dsn" validate:"required"`
+	Password string        `yaml:"password"`
+	Timeout  time.Duration `yaml:"timeout" default:"3s"`
+	Hosts    []string      `yaml:"hosts"`
+}
+
+type testCfg struct {
+	App   *x.AppCfg     `yaml:"app"`
+	Redis *testRedisCfg `yaml:"redis"`
+}
+
+func Test_DecodeCfg(t *testing.T) {
+	var data = map[string]struct {
+		yaml string
+		env  map[string]string
+		opts []x.CfgOption
+		path string
+		err  string
+		cfg  *testCfg
+	}{
+		"case-interpolate": {
+			yaml: "app:\n  name: xmagic\n  port: 1995\nredis:\n  dsn: ${T_REDIS_DSN:-redis://127.0.0.1:6379/0}\n  password: ${T_REDIS_PASSWORD}\n  hosts: [\"$${HOST}\"]\n",
+			env:  map[string]string{"T_REDIS_PASSWORD": "p@ss"},
+			cfg: &testCfg{
+				App:   &x.AppCfg{Name: "xmagic", Host: "0.0.0.0", Port: 1995},
+				Redis: &testRedisCfg{Dsn: "redis://127.0.0.1:6379/0", Password: "p@ss", Timeout: 3 * time.Second, Hosts: []string{"${HOST}"}},
+			},
+		},
+		"case-interpolate-special": {
+			yaml: "app:\n  name: xmagic\n  port: ${T_APP_PORT}\nredis:\n  dsn: ${T_REDIS_DSN}\n  password: ${T_REDIS_PASSWORD} # comment\n  hosts: [\"${T_REDIS_HOST}\"]\n",
+			env:  map[string]string{"T_APP_PORT": "8080", "T_REDIS_DSN": "redis://h:6379/0?a=1 #frag", "T_REDIS_PASSWORD": "p: ss", "T_REDIS_HOST": `a"b`},
+			cfg: &testCfg{
+				App:   &x.AppCfg{Name: "xmagic", Host: "0.0.0.0", Port: 8080},
+				Redis: &testRedisCfg{Dsn: "redis://h:6379/0?a=1 #frag", Password: "p: ss", Timeout: 3 * time.Second, Hosts: []string{`a"b`}},
+			},
+		},
+		"case-env-override": {
+			yaml: "app:\n  name: xmagic\n  port: 1995\n",
+			env:  map[string]string{"XT_APP_PORT": "8080", "XT_REDIS_DSN": "redis://redis:6379/1", "XT_REDIS_HOSTS": "a, b", "XT_REDIS_TIMEOUT": "500ms"},
+			opts: []x.CfgOption{x.WithCfgEnvPrefix("xt")},
+			cfg: &testCfg{
+				App:   &x.AppCfg{Name: "xmagic", Host: "0.0.0.0", Port: 8080},
+				Redis: &testRedisCfg{Dsn: "redis://redis:6379/1", Timeout: 500 * time.Millisecond, Hosts: []string{"a", "b"}},
+			},
+		},
+		"case-env-invalid": {
+			yaml: "app:\n  name: xmagic\n  port: 1995\n",
+			env:  map[string]string{"XT_APP_PORT": "abc"},
+			opts: []x.CfgOption{x.WithCfgEnvPrefix("XT")},
+			path: "app.port",
+			err:  `app.port: invalid XT_APP_PORT="abc"`,
+		},
+		"case-required": {
+			yaml: "app:\n  port: 1995\nredis:\n  password: x\n",
+			path: "app.name",
+			err:  "app.name: is required\nredis.dsn: is required",
+		},
+		"case-range": {
+			yaml: "app:\n  name: xmagic\n  port: 70000\n",
+			path: "app.port",
+			err:  "app.port: must be <= 65535",
+		},
+	}
+
+	for n, v := range data {
+		f := func(t *testing.T) {
+			for k, val := range v.env {
+				t.Setenv(k, val)
+			}
+			path := filepath.Join(t.TempDir(), "cfg.yaml")
+			assert.Nil(t, os.WriteFile(path, []byte(v.yaml), 0o644))
+
+			cfg := &testCfg{}
+			err := x.DecodeCfg(path, cfg, v.opts...)
+			if len(v.err) > 0 {
+				assert.ErrorContains(t, err, v.err)
+				fe := &x.FieldError{}
+				assert.True(t, errors.As(err, &fe))
+				assert.Equal(t, v.path, fe.Path)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, v.cfg, cfg)
+		}
+		t.Run(n, f)
+	}
+}
@@ -0,0 +1,216 @@
+package x
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func toString(v any) (string, error) {
+	switch t := v.(type) {
+	case string:
+		return t, nil
+	case []byte:
+		return string(t), nil
+	case time.Time:
+		return t.Format(time.RFC3339), nil
+	default:
+		return fmt.Sprint(v), nil
+	}
+}
+
+func toInt64(v any) (int64, error) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if rv.Uint() > math.MaxInt64 {
+			return 0, strconv.ErrRange
+		}
+		return int64(rv.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		if f != math.Trunc(f) || f > math.MaxInt64 || f < math.MinInt64 {
+			return 0, fmt.Errorf("%v is not an integer", f)
+		}
+		return int64(f), nil
+	case reflect.Bool:
+		if rv.Bool() {
+			return 1, nil
+		}
+		return 0, nil
+	}
+	s, err := toString(v)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+}
+
+func toFloat(v any) (float64, error) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), nil
+	}
+	s, err := toString(v)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(strings.TrimSpace(s), 64)
+}
+
+func toBool(v any) (bool, error) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Bool:
+		return rv.Bool(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int() != 0, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return rv.Uint() != 0, nil
+	}
+	s, err := toString(v)
+	if err != nil {
+		return false, err
+	}
+	return strconv.ParseBool(strings.TrimSpace(s))
+}
+
+// toTime 数值大于1e12时按毫秒, 否则按秒
+func toTime(v any) (time.Time, error) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, nil
+	case *time.Time:
+		return *t, nil
+	}
+	if n, err := toInt64(v); err == nil {
+		if n > 1e12 || n < -1e12 {
+			return time.UnixMilli(n), nil
+		}
+		return time.Unix(n, 0), nil
+	}
+	s, err := toString(v)
+	if err != nil {
+		return time.Time{}, err
+	}
+	s = strings.TrimSpace(s)
+	for _, layout := range []string{time.RFC3339Nano, time.DateTime, time.DateOnly} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", s)
+}
+
+// toDuration 数值按秒
+func toDuration(v any) (time.Duration, error) {
+	switch t := v.(type) {
+	case time.Duration:
+		return t, nil
+	case string:
+		if d, err := time.ParseDuration(strings.TrimSpace(t)); err == nil {
+			return d, nil
+		}
+	}
+	f, err := toFloat(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %v", v)
+	}
+	return time.Duration(f * float64(time.Second)), nil
+}
+
+// decodeValue 按字段类型转换后写入, 类型可直接赋值时不转换
+func decodeValue(f reflect.Value, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Type().AssignableTo(f.Type()) {
+		f.Set(rv)
+		return nil
+	}
+	switch {
+	case f.Type() == durationType:
+		d, err := toDuration(v)
+		if err != nil {
+			return err
+		}
+		f.SetInt(int64(d))
+		return nil
+	case f.Type() == timeType:
+		t, err := toTime(v)
+		if err != nil {
+			return err
+		}
+		f.Set(reflect.ValueOf(t))
+		return nil
+	}
+	switch f.Kind() {
+	case reflect.String:
+		s, err := toString(v)
+		if err != nil {
+			return err
+		}
+		f.SetString(s)
+	case reflect.Bool:
+		b, err := toBool(v)
+		if err != nil {
+			return err
+		}
+		f.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := toInt64(v)
+		if err != nil {
+			return err
+		}
+		if f.OverflowInt(n) {
+			return strconv.ErrRange
+		}
+		f.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := toInt64(v)
+		if err != nil {
+			return err
+		}
+		if n < 0 || f.OverflowUint(uint64(n)) {
+			return strconv.ErrRange
+		}
+		f.SetUint(uint64(n))
+	case reflect.Float32, reflect.Float64:
+		n, err := toFloat(v)
+		if err != nil {
+			return err
+		}
+		f.SetFloat(n)
+	case reflect.Pointer:
+		e := reflect.New(f.Type().Elem())
+		if err := decodeValue(e.Elem(), v); err != nil {
+			return err
+		}
+		f.Set(e)
+	default:
+		// 复杂类型经JSON转换, 如Redis中保存的JSON字符串
+		var buf []byte
+		if s, ok := v.(string); ok {
+			buf = []byte(s)
+		} else {
+			b, err := json.Marshal(v)
+			if err != nil {
+				return err
+			}
+			buf = b
+		}
+		return json.Unmarshal(buf, f.Addr().Interface())
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package x
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+var envRe = regexp.MustCompile(`\$\$|\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// interpolate 替换${VAR}和${VAR:-default}, 变量未设置或为空时取默认值, $$转义为$
+func interpolate(s string, lookup func(string) (string, bool)) string {
+	return envRe.ReplaceAllStringFunc(s, func(m string) string {
+		if m == "$$" {
+			return "$"
+		}
+		sub := envRe.FindStringSubmatch(m)
+		if v, ok := lookup(sub[1]); ok && len(v) > 0 {
+			return v
+		}
+		return sub[3]
+	})
+}
+
+// interpolateYaml 解析后逐个替换标量, 值中的": "或" #"不会破坏文档结构
+func interpolateYaml(buf []byte, lookup func(string) (string, bool)) ([]byte, error) {
+	// 1. 解析为节点树
+	doc := &yamlv3.Node{}
+	err := yamlv3.Unmarshal(buf, doc)
+	if err != nil {
+		return nil, err
+	}
+	if doc.Kind == 0 {
+		return buf, nil
+	}
+
+	// 2. 替换标量
+	interpolateNode(doc, lookup)
+
+	// 3. 重新编码, 需要时自动加引号
+	return yamlv3.Marshal(doc)
+}
+
+func interpolateNode(n *yamlv3.Node, lookup func(string) (string, bool)) {
+	if n.Kind == yamlv3.ScalarNode {
+		v := interpolate(n.Value, lookup)
+		if v == n.Value {
+			return
+		}
+		n.Value = v
+		// 未加引号的值按替换后的内容推断类型, 如port: ${PORT}
+		if n.Style&(yamlv3.SingleQuotedStyle|yamlv3.DoubleQuotedStyle|yamlv3.LiteralStyle|yamlv3.FoldedStyle) == 0 {
+			n.Tag = ""
+		}
+		return
+	}
+	for _, c := range n.Content {
+		interpolateNode(c, lookup)
+	}
+}
+
+// interpolateTree 替换已解析键值中的字符串
+func interpolateTree(v any, lookup func(string) (string, bool)) any {
+	switch t := v.(type) {
+	case string:
+		return interpolate(t, lookup)
+	case map[string]any:
+		for k, val := range t {
+			t[k] = interpolateTree(val, lookup)
+		}
+		return t
+	case []any:
+		for i := range t {
+			t[i] = interpolateTree(t[i], lookup)
+		}
+		return t
+	default:
+		return v
+	}
+}
+
+// applyEnv 按前缀覆盖配置, 如前缀XMAGIC时XMAGIC_APP_PORT覆盖app.port
+func applyEnv(v any, prefix string, environ []string) error {
+	// 1. 收集前缀下的环境变量
+	var (
+		envs = map[string]string{}
+		p    = strings.ToUpper(prefix) + "_"
+	)
+	for _, kv := range environ {
+		k, val, ok := strings.Cut(kv, "=")
+		if ok && strings.HasPrefix(k, p) {
+			envs[k] = val
+		}
+	}
+	if len(envs) <= 0 {
+		return nil
+	}
+
+	// 2. 按字段路径覆盖
+	var errs []error
+	walkCfg(reflect.ValueOf(v), "", func(path string, f reflect.Value, _ reflect.StructField) bool {
+		name := p + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(path))
+		// 未配置的段只在存在对应环境变量时创建
+		if f.Kind() == reflect.Pointer && f.Type().Elem().Kind() == reflect.Struct {
+			if f.IsNil() && hasEnvPrefix(envs, name+"_") {
+				f.Set(reflect.New(f.Type().Elem()))
+			}
+			return true
+		}
+		val, ok := envs[name]
+		if !ok {
+			return true
+		}
+		if err := setValue(f, val); err != nil {
+			errs = append(errs, &FieldError{Path: path, Msg: fmt.Sprintf("invalid %s=%q: %v", name, val, err)})
+		}
+		return true
+	})
+	return joinFieldErrors(errs)
+}
+
+func hasEnvPrefix(envs map[string]string, prefix string) bool {
+	for k := range envs {
+		if strings.HasPrefix(k, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// setValue 将字符串写入基础类型字段, 切片以逗号分隔
+func setValue(f reflect.Value, s string) error {
+	if f.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		f.SetInt(int64(d))
+		return nil
+	}
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		f.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetFloat(n)
+	case reflect.Slice:
+		parts := strings.Split(s, ",")
+		sl := reflect.MakeSlice(f.Type(), len(parts), len(parts))
+		for i := range parts {
+			if err := setValue(sl.Index(i), strings.TrimSpace(parts[i])); err != nil {
+				return err
+			}
+		}
+		f.Set(sl)
+	case reflect.Pointer:
+		e := reflect.New(f.Type().Elem())
+		if err := setValue(e.Elem(), s); err != nil {
+			return err
+		}
+		f.Set(e)
+	default:
+		return fmt.Errorf("unsupported type %s", f.Type())
+	}
+	return nil
+}
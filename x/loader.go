@@ -0,0 +1,193 @@
+package x
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// CfgLoader 按顺序合并多个来源, 后者覆盖前者
+//
+//	l := x.NewCfgLoader(
+//		x.NewFileSource("base.yaml"),
+//		x.NewOptionalFileSource("prod.toml"),
+//		x.NewEnvSource("XMAGIC"),
+//		x.NewFlagSource(flag.CommandLine),
+//	)
+//	origins, err := l.Load(ctx, cfg)
+//
+// 对象逐层合并, 标量和列表整体替换, 显式的null删除该项
+type CfgLoader struct {
+	sources []CfgSource
+	key     []byte
+}
+
+func NewCfgLoader(sources ...CfgSource) *CfgLoader {
+	return &CfgLoader{sources: sources}
+}
+
+// SetKey 解密ENC(...)的密钥, 未设置时读取X_CFG_KEY或X_CFG_KEY_FILE
+func (l *CfgLoader) SetKey(key []byte) {
+	l.key = key
+}
+
+// Load 合并后解密ENC(...)并解析到v, 再执行default标签默认值和validate标签校验
+// 返回每个叶子路径的来源名称, 取默认值的为default
+func (l *CfgLoader) Load(ctx context.Context, v any) (map[string]string, error) {
+	// 1. 目标结构体的叶子路径
+	var (
+		fields  = cfgFields(reflect.TypeOf(v), "", map[string]reflect.Type{})
+		keys    = slices.Sorted(maps.Keys(fields))
+		tree    = map[string]any{}
+		origins = map[string]string{}
+	)
+
+	// 2. 逐个来源合并
+	for _, s := range l.sources {
+		m, err := s.Load(ctx, keys)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", s.Name(), err)
+		}
+		err = coerce(m, "", fields, s.Name())
+		if err != nil {
+			return nil, err
+		}
+		merge(tree, m, "", s.Name(), origins)
+	}
+
+	// 3. 解密并解析到结构体
+	_, err := (&cfgDecrypter{key: l.key}).decryptTree(tree, "")
+	if err != nil {
+		return nil, err
+	}
+	buf, err := yaml.Marshal(tree)
+	if err != nil {
+		return nil, err
+	}
+	err = yaml.Unmarshal(buf, v)
+	if err != nil {
+		return nil, err
+	}
+
+	// 4. 默认值和校验
+	err = applyDefaults(v)
+	if err != nil {
+		return nil, err
+	}
+	walkCfg(reflect.ValueOf(v), "", func(path string, f reflect.Value, sf reflect.StructField) bool {
+		if _, ok := sf.Tag.Lookup("default"); ok && len(origins[path]) <= 0 {
+			origins[path] = "default"
+		}
+		return true
+	})
+	return origins, Validate(v)
+}
+
+// merge 深度合并src到dst, 记录叶子来源
+func merge(dst, src map[string]any, prefix string, name string, origins map[string]string) {
+	for k, v := range src {
+		path := k
+		if len(prefix) > 0 {
+			path = prefix + "." + k
+		}
+		// 1. 删除
+		if v == nil {
+			delete(dst, k)
+			dropOrigins(origins, path)
+			continue
+		}
+		// 2. 对象逐层合并
+		if sm, ok := v.(map[string]any); ok {
+			dm, ok := dst[k].(map[string]any)
+			if !ok {
+				dm = map[string]any{}
+				dst[k] = dm
+				dropOrigins(origins, path)
+			}
+			merge(dm, sm, path, name, origins)
+			continue
+		}
+		// 3. 标量和列表替换
+		dst[k] = v
+		dropOrigins(origins, path)
+		origins[path] = name
+	}
+}
+
+func dropOrigins(origins map[string]string, path string) {
+	delete(origins, path)
+	for k := range origins {
+		if strings.HasPrefix(k, path+".") {
+			delete(origins, k)
+		}
+	}
+}
+
+// coerce 环境变量等来源的值为字符串, 按目标字段类型转换
+func coerce(m map[string]any, prefix string, fields map[string]reflect.Type, name string) error {
+	for k, v := range m {
+		path := k
+		if len(prefix) > 0 {
+			path = prefix + "." + k
+		}
+		if sm, ok := v.(map[string]any); ok {
+			if err := coerce(sm, path, fields, name); err != nil {
+				return err
+			}
+			continue
+		}
+		var (
+			s, ok = v.(string)
+			t     = fields[path]
+		)
+		if !ok || t == nil || t.Kind() == reflect.String {
+			continue
+		}
+		f := reflect.New(t).Elem()
+		if err := setValue(f, s); err != nil {
+			return &FieldError{Path: path, Msg: fmt.Sprintf("invalid value %q from %s: %v", s, name, err)}
+		}
+		if t == durationType {
+			m[k] = s
+		} else {
+			m[k] = f.Interface()
+		}
+	}
+	return nil
+}
+
+// cfgFields 按yaml标签收集叶子路径及类型
+func cfgFields(t reflect.Type, prefix string, fields map[string]reflect.Type) map[string]reflect.Type {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return fields
+	}
+	for i := range t.NumField() {
+		sf := t.Field(i)
+		name := yamlName(sf)
+		if !sf.IsExported() || name == "-" {
+			continue
+		}
+		path := name
+		if len(prefix) > 0 {
+			path = prefix + "." + name
+		}
+		ft := sf.Type
+		for ft.Kind() == reflect.Pointer && ft.Elem().Kind() == reflect.Struct {
+			ft = ft.Elem()
+		}
+		if ft.Kind() == reflect.Struct && ft != durationType {
+			cfgFields(ft, path, fields)
+			continue
+		}
+		fields[path] = sf.Type
+	}
+	return fields
+}
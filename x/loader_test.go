@@ -0,0 +1,130 @@
+package x_test
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/advancevillage/3rd/x"
+	"github.com/stretchr/testify/assert"
+)
+
+type testLoaderCfg struct {
+	App   *x.AppCfg     `yaml:"app"`
+	Log   *x.LogCfg     `yaml:"log"`
+	Redis *testRedisCfg `yaml:"redis"`
+	Flags []string      `yaml:"flags"`
+}
+
+func Test_CfgLoader(t *testing.T) {
+	var (
+		dir  = t.TempDir()
+		base = filepath.Join(dir, "base.yaml")
+		prod = filepath.Join(dir, "prod.json")
+		feat = filepath.Join(dir, "feat.toml")
+	)
+	assert.Nil(t, os.WriteFile(base, []byte("app:\n  name: xmagic\n  port: 1995\nlog:\n  level: info\n  format: json\nredis:\n  dsn: redis://127.0.0.1:6379/0\n  hosts: [a, b, c]\nflags: [x, y]\n"), 0o644))
+	assert.Nil(t, os.WriteFile(prod, []byte(`{"app": {"port": 8080}, "redis": {"hosts": ["d"]}, "flags": null}`), 0o644))
+	assert.Nil(t, os.WriteFile(feat, []byte("[log]\nlevel = \"warn\"\n[redis]\ntimeout = \"5s\"\n"), 0o644))
+
+	var data = map[string]struct {
+		sources func(t *testing.T) []x.CfgSource
+		cfg     *testLoaderCfg
+		origins map[string]string
+		err     string
+	}{
+		"case-files": {
+			sources: func(t *testing.T) []x.CfgSource {
+				return []x.CfgSource{x.NewFileSource(base), x.NewFileSource(prod), x.NewFileSource(feat), x.NewOptionalFileSource(filepath.Join(dir, "missing.yaml"))}
+			},
+			cfg: &testLoaderCfg{
+				App:   &x.AppCfg{Name: "xmagic", Host: "0.0.0.0", Port: 8080},
+				Log:   &x.LogCfg{Level: "warn", Format: "json"},
+				Redis: &testRedisCfg{Dsn: "redis://127.0.0.1:6379/0", Timeout: 5 * time.Second, Hosts: []string{"d"}},
+			},
+			origins: map[string]string{
+				"app.name":      "file:" + base,
+				"app.port":      "file:" + prod,
+				"app.host":      "default",
+				"log.level":     "file:" + feat,
+				"log.format":    "file:" + base,
+				"redis.dsn":     "file:" + base,
+				"redis.hosts":   "file:" + prod,
+				"redis.timeout": "file:" + feat,
+			},
+		},
+		"case-env-flag-kv": {
+			sources: func(t *testing.T) []x.CfgSource {
+				t.Setenv("XL_APP_PORT", "9090")
+				t.Setenv("XL_REDIS_HOSTS", "e,f")
+				fs := flag.NewFlagSet("test", flag.ContinueOnError)
+				fs.String("log.level", "", "")
+				fs.Int("app.port", 0, "")
+				fs.String("redis.dsn", "", "")
+				assert.Nil(t, fs.Parse([]string{"-app.port=7070", "-log.level=debug"}))
+				kv := x.NewKVSource("redis:cfg", func(ctx context.Context) (map[string]any, error) {
+					return map[string]any{"log.format": "logfmt", "redis.timeout": "1s"}, nil
+				})
+				return []x.CfgSource{x.NewFileSource(base), x.NewEnvSource("xl"), x.NewFlagSource(fs), kv}
+			},
+			cfg: &testLoaderCfg{
+				App:   &x.AppCfg{Name: "xmagic", Host: "0.0.0.0", Port: 7070},
+				Log:   &x.LogCfg{Level: "debug", Format: "logfmt"},
+				Redis: &testRedisCfg{Dsn: "redis://127.0.0.1:6379/0", Timeout: time.Second, Hosts: []string{"e", "f"}},
+				Flags: []string{"x", "y"},
+			},
+			origins: map[string]string{
+				"app.name":      "file:" + base,
+				"app.port":      "flag",
+				"app.host":      "default",
+				"log.level":     "flag",
+				"log.format":    "redis:cfg",
+				"redis.dsn":     "file:" + base,
+				"redis.hosts":   "env:XL_*",
+				"redis.timeout": "redis:cfg",
+				"flags":         "file:" + base,
+			},
+		},
+		"case-invalid-env": {
+			sources: func(t *testing.T) []x.CfgSource {
+				t.Setenv("XL_APP_PORT", "abc")
+				return []x.CfgSource{x.NewFileSource(base), x.NewEnvSource("XL")}
+			},
+			err: `app.port: invalid value "abc" from env:XL_*`,
+		},
+		"case-missing-file": {
+			sources: func(t *testing.T) []x.CfgSource {
+				return []x.CfgSource{x.NewFileSource(filepath.Join(dir, "missing.yaml"))}
+			},
+			err: "no such file",
+		},
+	}
+
+	for n, v := range data {
+		f := func(t *testing.T) {
+			cfg := &testLoaderCfg{}
+			origins, err := x.NewCfgLoader(v.sources(t)...).Load(context.TODO(), cfg)
+			if len(v.err) > 0 {
+				assert.ErrorContains(t, err, v.err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, v.cfg, cfg)
+			assert.Equal(t, v.origins, origins)
+		}
+		t.Run(n, f)
+	}
+}
+
+func Test_CfgLoader_validate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cfg.json")
+	assert.Nil(t, os.WriteFile(path, []byte(`{"app": {"name": "xmagic", "port": 70000}}`), 0o644))
+	_, err := x.NewCfgLoader(x.NewFileSource(path)).Load(context.TODO(), &testLoaderCfg{})
+	fe := &x.FieldError{}
+	assert.True(t, errors.As(err, &fe))
+	assert.Equal(t, "app.port", fe.Path)
+}
@@ -0,0 +1,229 @@
+package x
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/advancevillage/3rd/cryptox/sm4"
+)
+
+const (
+	CfgKeyEnv     = "X_CFG_KEY"      // 配置密钥, 32位十六进制或base64
+	CfgKeyFileEnv = "X_CFG_KEY_FILE" // 配置密钥文件
+)
+
+var (
+	ErrCfgKeyMissing = errors.New("x: cfg key missing, set " + CfgKeyEnv + " or " + CfgKeyFileEnv)
+	ErrCfgCipher     = errors.New("x: invalid ENC value")
+)
+
+// EncryptValue SM4-GCM加密, 返回ENC(base64(nonce|密文|tag))
+func EncryptValue(key []byte, plain string) (string, error) {
+	aead, err := newCfgAEAD(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return "", err
+	}
+	buf := aead.Seal(nonce, nonce, []byte(plain), nil)
+	return "ENC(" + base64.StdEncoding.EncodeToString(buf) + ")", nil
+}
+
+// DecryptValue 解密ENC(...), 非ENC值原样返回
+func DecryptValue(key []byte, s string) (string, error) {
+	raw, ok := encValue(s)
+	if !ok {
+		return s, nil
+	}
+	aead, err := newCfgAEAD(key)
+	if err != nil {
+		return "", err
+	}
+	buf, err := base64.StdEncoding.DecodeString(raw)
+	if err != nil || len(buf) < aead.NonceSize()+aead.Overhead() {
+		return "", ErrCfgCipher
+	}
+	plain, err := aead.Open(nil, buf[:aead.NonceSize()], buf[aead.NonceSize():], nil)
+	if err != nil {
+		return "", ErrCfgCipher
+	}
+	return string(plain), nil
+}
+
+// ParseCfgKey 解析16字节密钥, 支持32位十六进制、base64或原始16字节
+func ParseCfgKey(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	if k, err := hex.DecodeString(s); err == nil && len(k) == 16 {
+		return k, nil
+	}
+	if k, err := base64.StdEncoding.DecodeString(s); err == nil && len(k) == 16 {
+		return k, nil
+	}
+	if len(s) == 16 {
+		return []byte(s), nil
+	}
+	return nil, sm4.KeySizeError(len(s))
+}
+
+// LoadCfgKey 依次读取X_CFG_KEY和X_CFG_KEY_FILE
+func LoadCfgKey() ([]byte, error) {
+	if s, ok := os.LookupEnv(CfgKeyEnv); ok && len(s) > 0 {
+		return ParseCfgKey(s)
+	}
+	if path, ok := os.LookupEnv(CfgKeyFileEnv); ok && len(path) > 0 {
+		buf, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return ParseCfgKey(string(buf))
+	}
+	return nil, ErrCfgKeyMissing
+}
+
+func newCfgAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := sm4.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func encValue(s string) (string, bool) {
+	if strings.HasPrefix(s, "ENC(") && strings.HasSuffix(s, ")") {
+		return s[4 : len(s)-1], true
+	}
+	return "", false
+}
+
+// cfgDecrypter 首次遇到ENC值时才读取密钥
+type cfgDecrypter struct {
+	key []byte
+	err error
+}
+
+func (d *cfgDecrypter) decrypt(path string, s string) (string, error) {
+	if _, ok := encValue(s); !ok {
+		return s, nil
+	}
+	if d.key == nil && d.err == nil {
+		d.key, d.err = LoadCfgKey()
+	}
+	if d.err != nil {
+		return "", &FieldError{Path: path, Msg: d.err.Error()}
+	}
+	plain, err := DecryptValue(d.key, s)
+	if err != nil {
+		return "", &FieldError{Path: path, Msg: err.Error()}
+	}
+	addSecret(plain)
+	return plain, nil
+}
+
+// decryptStruct 解密结构体中的字符串及字符串切片
+func (d *cfgDecrypter) decryptStruct(v any) error {
+	var errs []error
+	walkCfg(reflect.ValueOf(v), "", func(path string, f reflect.Value, _ reflect.StructField) bool {
+		switch {
+		case f.Kind() == reflect.String:
+			s, err := d.decrypt(path, f.String())
+			if err != nil {
+				errs = append(errs, err)
+			} else {
+				f.SetString(s)
+			}
+		case f.Kind() == reflect.Slice && f.Type().Elem().Kind() == reflect.String:
+			for i := range f.Len() {
+				s, err := d.decrypt(fmt.Sprintf("%s[%d]", path, i), f.Index(i).String())
+				if err != nil {
+					errs = append(errs, err)
+				} else {
+					f.Index(i).SetString(s)
+				}
+			}
+		}
+		return true
+	})
+	return joinFieldErrors(errs)
+}
+
+// decryptTree 解密合并后的配置树
+func (d *cfgDecrypter) decryptTree(v any, path string) (any, error) {
+	switch t := v.(type) {
+	case string:
+		return d.decrypt(path, t)
+	case map[string]any:
+		var errs []error
+		for k, val := range t {
+			p := k
+			if len(path) > 0 {
+				p = path + "." + k
+			}
+			nv, err := d.decryptTree(val, p)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			t[k] = nv
+		}
+		return t, errors.Join(errs...)
+	case []any:
+		var errs []error
+		for i := range t {
+			nv, err := d.decryptTree(t[i], fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			t[i] = nv
+		}
+		return t, errors.Join(errs...)
+	default:
+		return v, nil
+	}
+}
+
+var (
+	secretsMu sync.Mutex
+	secrets   atomic.Pointer[[]string]
+)
+
+// addSecret 记录解密得到的明文, 日志输出时脱敏
+func addSecret(s string) {
+	if len(s) <= 0 {
+		return
+	}
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	var cur []string
+	if p := secrets.Load(); p != nil {
+		cur = *p
+	}
+	if slices.Contains(cur, s) {
+		return
+	}
+	next := append(slices.Clone(cur), s)
+	// 长值优先替换, 避免被其子串部分替换
+	slices.SortFunc(next, func(a, b string) int { return len(b) - len(a) })
+	secrets.Store(&next)
+}
+
+// Secrets 配置中解密得到的明文, 供日志脱敏, 不可修改
+func Secrets() []string {
+	if p := secrets.Load(); p != nil {
+		return *p
+	}
+	return nil
+}
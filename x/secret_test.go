@@ -0,0 +1,137 @@
+package x_test
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/advancevillage/3rd/x"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_EncryptValue(t *testing.T) {
+	var (
+		key   = []byte("0123456789abcdef")
+		other = []byte("fedcba9876543210")
+	)
+	enc, err := x.EncryptValue(key, "redis://:p@ss@127.0.0.1:6379/0")
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(enc, "ENC("))
+	tampered := []byte(enc)
+	tampered[10] ^= 0x01
+
+	var data = map[string]struct {
+		key   []byte
+		value string
+		exp   string
+		err   error
+	}{
+		"case-ok": {
+			key:   key,
+			value: enc,
+			exp:   "redis://:p@ss@127.0.0.1:6379/0",
+		},
+		"case-plain": {
+			key:   key,
+			value: "redis://127.0.0.1:6379/0",
+			exp:   "redis://127.0.0.1:6379/0",
+		},
+		"case-wrong-key": {
+			key:   other,
+			value: enc,
+			err:   x.ErrCfgCipher,
+		},
+		"case-tampered": {
+			key:   key,
+			value: string(tampered),
+			err:   x.ErrCfgCipher,
+		},
+		"case-not-base64": {
+			key:   key,
+			value: "ENC(???)",
+			err:   x.ErrCfgCipher,
+		},
+	}
+	for n, v := range data {
+		f := func(t *testing.T) {
+			act, err := x.DecryptValue(v.key, v.value)
+			assert.Equal(t, v.err, err)
+			assert.Equal(t, v.exp, act)
+		}
+		t.Run(n, f)
+	}
+}
+
+func Test_DecodeCfg_enc(t *testing.T) {
+	var (
+		dir     = t.TempDir()
+		key     = []byte("0123456789abcdef")
+		keyFile = filepath.Join(dir, "cfg.key")
+	)
+	dsn, err := x.EncryptValue(key, "redis://:secret-pass@redis:6379/0")
+	assert.Nil(t, err)
+	host, err := x.EncryptValue(key, "sts://ak:sk@sts.example.com")
+	assert.Nil(t, err)
+	assert.Nil(t, os.WriteFile(keyFile, []byte(hex.EncodeToString(key)+"\n"), 0o644))
+	yaml := "redis:\n  dsn: " + dsn + "\n  hosts: [a, " + host + "]\n"
+
+	var data = map[string]struct {
+		env  map[string]string
+		opts []x.CfgOption
+		err  string
+	}{
+		"case-key-env": {
+			env: map[string]string{x.CfgKeyEnv: hex.EncodeToString(key)},
+		},
+		"case-key-file": {
+			env: map[string]string{x.CfgKeyFileEnv: keyFile},
+		},
+		"case-key-option": {
+			opts: []x.CfgOption{x.WithCfgKey(key)},
+		},
+		"case-key-missing": {
+			err: "redis.dsn: x: cfg key missing",
+		},
+		"case-key-wrong": {
+			opts: []x.CfgOption{x.WithCfgKey([]byte("fedcba9876543210"))},
+			err:  "redis.hosts[1]: x: invalid ENC value",
+		},
+	}
+	for n, v := range data {
+		f := func(t *testing.T) {
+			t.Setenv(x.CfgKeyEnv, "")
+			t.Setenv(x.CfgKeyFileEnv, "")
+			for k, val := range v.env {
+				t.Setenv(k, val)
+			}
+			path := filepath.Join(t.TempDir(), "cfg.yaml")
+			assert.Nil(t, os.WriteFile(path, []byte(yaml), 0o644))
+
+			cfg := &testCfg{}
+			err := x.DecodeCfg(path, cfg, v.opts...)
+			if len(v.err) > 0 {
+				assert.ErrorContains(t, err, v.err)
+				fe := &x.FieldError{}
+				assert.True(t, errors.As(err, &fe))
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, "redis://:secret-pass@redis:6379/0", cfg.Redis.Dsn)
+			assert.Equal(t, []string{"a", "sts://ak:sk@sts.example.com"}, cfg.Redis.Hosts)
+			assert.Contains(t, x.Secrets(), cfg.Redis.Dsn)
+
+			// 分层加载同样解密
+			l := x.NewCfgLoader(x.NewFileSource(path))
+			l.SetKey(key)
+			lcfg := &testLoaderCfg{}
+			_, err = l.Load(context.TODO(), lcfg)
+			assert.Nil(t, err)
+			assert.Equal(t, cfg.Redis, lcfg.Redis)
+		}
+		t.Run(n, f)
+	}
+}
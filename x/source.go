@@ -0,0 +1,205 @@
+package x
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// CfgSource 配置来源
+type CfgSource interface {
+	// Name 来源名称, 用于记录配置项来源
+	Name() string
+	// Load 返回嵌套的键值, keys为目标结构体的全部叶子路径如app.port
+	Load(ctx context.Context, keys []string) (map[string]any, error)
+}
+
+var _ CfgSource = (*fileSource)(nil)
+
+type fileSource struct {
+	path     string
+	optional bool
+}
+
+// NewFileSource 按扩展名解析yaml yml json toml文件, 支持${VAR:-default}替换
+func NewFileSource(path string) CfgSource {
+	return &fileSource{path: path}
+}
+
+// NewOptionalFileSource 文件不存在时忽略, 用于可选的环境覆盖文件
+func NewOptionalFileSource(path string) CfgSource {
+	return &fileSource{path: path, optional: true}
+}
+
+func (s *fileSource) Name() string {
+	return "file:" + s.path
+}
+
+func (s *fileSource) Load(ctx context.Context, keys []string) (map[string]any, error) {
+	// 1. 读取文件
+	buf, err := os.ReadFile(s.path)
+	if s.optional && errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. 按格式解析, 解析后再替换变量
+	var m map[string]any
+	switch strings.ToLower(filepath.Ext(s.path)) {
+	case ".yaml", ".yml":
+		buf, err = interpolateYaml(buf, os.LookupEnv)
+		if err != nil {
+			return nil, err
+		}
+		// yaml.v3按YAML 1.2解析, 避免y/on等未加引号的字符串变为布尔值
+		err = yamlv3.Unmarshal(buf, &m)
+		if err == nil {
+			normalize(m)
+		}
+	case ".json":
+		d := json.NewDecoder(bytes.NewReader(buf))
+		err = d.Decode(&m)
+		if err == nil {
+			interpolateTree(m, os.LookupEnv)
+		}
+	case ".toml":
+		err = toml.Unmarshal(buf, &m)
+		if err == nil {
+			interpolateTree(m, os.LookupEnv)
+		}
+	default:
+		err = fmt.Errorf("unsupported cfg format %q", filepath.Ext(s.path))
+	}
+	return m, err
+}
+
+// normalize 嵌套的map[any]any转换为map[string]any
+func normalize(v any) any {
+	switch t := v.(type) {
+	case map[any]any:
+		m := make(map[string]any, len(t))
+		for k, val := range t {
+			m[fmt.Sprint(k)] = normalize(val)
+		}
+		return m
+	case map[string]any:
+		for k, val := range t {
+			t[k] = normalize(val)
+		}
+		return t
+	case []any:
+		for i := range t {
+			t[i] = normalize(t[i])
+		}
+		return t
+	default:
+		return v
+	}
+}
+
+var _ CfgSource = (*envSource)(nil)
+
+type envSource struct {
+	prefix string
+}
+
+// NewEnvSource 环境变量覆盖, 如前缀XMAGIC时XMAGIC_APP_PORT覆盖app.port
+func NewEnvSource(prefix string) CfgSource {
+	return &envSource{prefix: strings.ToUpper(prefix) + "_"}
+}
+
+func (s *envSource) Name() string {
+	return "env:" + s.prefix + "*"
+}
+
+func (s *envSource) Load(ctx context.Context, keys []string) (map[string]any, error) {
+	m := map[string]any{}
+	for _, k := range keys {
+		name := s.prefix + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(k))
+		if v, ok := os.LookupEnv(name); ok {
+			setPath(m, k, v)
+		}
+	}
+	return m, nil
+}
+
+var _ CfgSource = (*flagSource)(nil)
+
+type flagSource struct {
+	fs *flag.FlagSet
+}
+
+// NewFlagSource 命令行参数覆盖, 仅取显式设置的参数, 参数名即路径如-app.port=8080
+func NewFlagSource(fs *flag.FlagSet) CfgSource {
+	return &flagSource{fs: fs}
+}
+
+func (s *flagSource) Name() string {
+	return "flag"
+}
+
+func (s *flagSource) Load(ctx context.Context, keys []string) (map[string]any, error) {
+	m := map[string]any{}
+	s.fs.Visit(func(f *flag.Flag) {
+		if g, ok := f.Value.(flag.Getter); ok {
+			setPath(m, f.Name, g.Get())
+		} else {
+			setPath(m, f.Name, f.Value.String())
+		}
+	})
+	return m, nil
+}
+
+var _ CfgSource = (*kvSource)(nil)
+
+type kvSource struct {
+	name string
+	load func(ctx context.Context) (map[string]any, error)
+}
+
+// NewKVSource 远程键值来源, 键为点分路径如app.port, 如dbx.NewCacheCfgSource
+func NewKVSource(name string, load func(ctx context.Context) (map[string]any, error)) CfgSource {
+	return &kvSource{name: name, load: load}
+}
+
+func (s *kvSource) Name() string {
+	return s.name
+}
+
+func (s *kvSource) Load(ctx context.Context, keys []string) (map[string]any, error) {
+	kv, err := s.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	m := map[string]any{}
+	for k, v := range kv {
+		setPath(m, k, v)
+	}
+	return m, nil
+}
+
+// setPath 按点分路径写入嵌套map
+func setPath(m map[string]any, path string, v any) {
+	parts := strings.Split(path, ".")
+	for _, p := range parts[:len(parts)-1] {
+		next, ok := m[p].(map[string]any)
+		if !ok {
+			next = map[string]any{}
+			m[p] = next
+		}
+		m = next
+	}
+	m[parts[len(parts)-1]] = v
+}
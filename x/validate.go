@@ -0,0 +1,174 @@
+package x
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// FieldError 配置字段错误, Path为YAML路径如app.port
+type FieldError struct {
+	Path string
+	Msg  string
+}
+
+func (e *FieldError) Error() string {
+	return e.Path + ": " + e.Msg
+}
+
+func joinFieldErrors(errs []error) error {
+	if len(errs) <= 0 {
+		return nil
+	}
+	return errors.Join(errs...)
+}
+
+// walkCfg 按yaml标签深度遍历结构体字段, 仅进入非nil的结构体指针和map[string]*T
+func walkCfg(v reflect.Value, prefix string, fn func(path string, f reflect.Value, sf reflect.StructField) bool) {
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return
+	}
+	t := v.Type()
+	for i := range t.NumField() {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		name := yamlName(sf)
+		if name == "-" {
+			continue
+		}
+		path := name
+		if len(prefix) > 0 {
+			path = prefix + "." + name
+		}
+		f := v.Field(i)
+		if !fn(path, f, sf) {
+			continue
+		}
+		switch {
+		case f.Kind() == reflect.Struct && f.Type() != durationType, f.Kind() == reflect.Pointer && f.Type().Elem().Kind() == reflect.Struct:
+			walkCfg(f, path, fn)
+		case f.Kind() == reflect.Map && f.Type().Key().Kind() == reflect.String && f.Type().Elem().Kind() == reflect.Pointer:
+			// 按名称配置的段, 路径如redis.default.dsn
+			for _, k := range f.MapKeys() {
+				walkCfg(f.MapIndex(k), path+"."+k.String(), fn)
+			}
+		}
+	}
+}
+
+// yamlName 与yaml.v2一致, 未设置标签时使用小写字段名
+func yamlName(sf reflect.StructField) string {
+	name, _, _ := strings.Cut(sf.Tag.Get("yaml"), ",")
+	if len(name) > 0 {
+		return name
+	}
+	return strings.ToLower(sf.Name)
+}
+
+// applyDefaults 零值字段取default标签, 未配置的段保持为nil
+func applyDefaults(v any) error {
+	var errs []error
+	walkCfg(reflect.ValueOf(v), "", func(path string, f reflect.Value, sf reflect.StructField) bool {
+		def, ok := sf.Tag.Lookup("default")
+		if !ok || !f.IsZero() {
+			return true
+		}
+		if err := setValue(f, def); err != nil {
+			errs = append(errs, &FieldError{Path: path, Msg: fmt.Sprintf("invalid default %q: %v", def, err)})
+		}
+		return true
+	})
+	return joinFieldErrors(errs)
+}
+
+// Validate 按validate标签校验, 支持required min max oneof, 多条规则以逗号分隔
+//
+//	Port int `yaml:"port" validate:"required,min=1,max=65535"`
+//	Level string `yaml:"level" validate:"oneof=debug info warn error"`
+//
+// min/max对数值比较大小, 对字符串和切片比较长度; 返回的错误可用errors.As取出*FieldError
+func Validate(v any) error {
+	var errs []error
+	walkCfg(reflect.ValueOf(v), "", func(path string, f reflect.Value, sf reflect.StructField) bool {
+		tag := sf.Tag.Get("validate")
+		if len(tag) <= 0 {
+			return true
+		}
+		for _, rule := range strings.Split(tag, ",") {
+			if err := checkRule(f, strings.TrimSpace(rule)); err != nil {
+				errs = append(errs, &FieldError{Path: path, Msg: err.Error()})
+				break
+			}
+		}
+		return true
+	})
+	return joinFieldErrors(errs)
+}
+
+func checkRule(f reflect.Value, rule string) error {
+	name, arg, _ := strings.Cut(rule, "=")
+	// 1. 必填
+	if name == "required" {
+		if f.IsZero() {
+			return errors.New("is required")
+		}
+		return nil
+	}
+	// 2. 可选字段为空时不校验
+	if f.IsZero() {
+		return nil
+	}
+	for f.Kind() == reflect.Pointer {
+		f = f.Elem()
+	}
+	switch name {
+	case "oneof":
+		s := fmt.Sprint(f.Interface())
+		for _, o := range strings.Fields(arg) {
+			if s == o {
+				return nil
+			}
+		}
+		return fmt.Errorf("must be one of [%s], got %q", arg, s)
+	case "min", "max":
+		n, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return fmt.Errorf("invalid rule %q", rule)
+		}
+		var (
+			act  float64
+			unit = ""
+		)
+		switch f.Kind() {
+		case reflect.String, reflect.Slice, reflect.Map:
+			act, unit = float64(f.Len()), " in length"
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			act = float64(f.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			act = float64(f.Uint())
+		case reflect.Float32, reflect.Float64:
+			act = f.Float()
+		default:
+			return fmt.Errorf("rule %q unsupported for %s", rule, f.Type())
+		}
+		if name == "min" && act < n {
+			return fmt.Errorf("must be >= %s%s", arg, unit)
+		}
+		if name == "max" && act > n {
+			return fmt.Errorf("must be <= %s%s", arg, unit)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown rule %q", rule)
+	}
+}
@@ -0,0 +1,196 @@
+package x
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"log"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// CfgSubscriber 配置变更回调, 在加载完成并释放锁后按订阅顺序同步执行, 回调中可以调用Subscribe或Reload
+type CfgSubscriber[T any] func(old, new *T)
+
+// WatchLogger 重新加载失败时使用的日志, logx.ILogger满足该接口
+type WatchLogger interface {
+	Errorw(ctx context.Context, msg string, keysAndValues ...interface{})
+}
+
+type WatchOption = Options[watchOption]
+
+// WithWatchInterval 文件检查间隔, 默认1秒, 0表示仅响应信号
+func WithWatchInterval(interval time.Duration) WatchOption {
+	return NewFuncOptions(func(o *watchOption) {
+		o.interval = max(interval, 0)
+	})
+}
+
+// WithWatchCfgOptions 重新加载时使用的解析配置, 如WithCfgEnvPrefix
+func WithWatchCfgOptions(opt ...CfgOption) WatchOption {
+	return NewFuncOptions(func(o *watchOption) {
+		o.cfg = append(o.cfg, opt...)
+	})
+}
+
+// WithWatchErrorHandler 重新加载失败时回调, 优先于WithWatchLogger, 失败时保留旧配置
+func WithWatchErrorHandler(fn func(err error)) WatchOption {
+	return NewFuncOptions(func(o *watchOption) {
+		o.onError = fn
+	})
+}
+
+// WithWatchLogger 重新加载失败时记录日志
+// 未设置日志和WithWatchErrorHandler时由标准库log输出到标准错误
+func WithWatchLogger(logger WatchLogger) WatchOption {
+	return NewFuncOptions(func(o *watchOption) {
+		o.logger = logger
+	})
+}
+
+type watchOption struct {
+	interval time.Duration // 检查间隔
+	cfg      []CfgOption   // 解析配置
+	logger   WatchLogger   // 日志
+	onError  func(error)   // 加载失败
+}
+
+func newDefaultWatchOption() watchOption {
+	return watchOption{
+		interval: time.Second,
+	}
+}
+
+// CfgWatcher 文件变化或收到SIGHUP时重新加载配置, 校验通过后原子替换
+type CfgWatcher[T any] struct {
+	path string
+	opts watchOption
+	cur  atomic.Pointer[T]
+
+	mu   sync.Mutex // 串行加载和订阅, 通知订阅者时不持有
+	sum  [sha256.Size]byte
+	subs []CfgSubscriber[T]
+}
+
+// NewCfgWatcher 加载配置并开始监听, ctx结束时停止
+func NewCfgWatcher[T any](ctx context.Context, path string, opt ...WatchOption) (*CfgWatcher[T], error) {
+	// 0. 设置配置
+	opts := newDefaultWatchOption()
+	for _, o := range opt {
+		o.Apply(&opts)
+	}
+	if opts.onError == nil && opts.logger != nil {
+		opts.onError = func(err error) { opts.logger.Errorw(ctx, "cfg reload failed", "err", err, "path", path) }
+	}
+	if opts.onError == nil {
+		opts.onError = func(err error) { log.Printf("cfg reload failed: path=%s err=%v", path, err) }
+	}
+
+	// 1. 首次加载
+	w := &CfgWatcher[T]{path: path, opts: opts}
+	_, err := w.reload(true)
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. 开始监听, 先注册信号避免SIGHUP默认终止进程
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go w.watch(ctx, hup)
+	return w, nil
+}
+
+// Load 当前配置, 返回的对象不可修改
+func (w *CfgWatcher[T]) Load() *T {
+	return w.cur.Load()
+}
+
+// Subscribe 订阅配置变更
+func (w *CfgWatcher[T]) Subscribe(fn CfgSubscriber[T]) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.subs = append(w.subs, fn)
+}
+
+// Reload 立即重新加载, 返回配置是否变化
+func (w *CfgWatcher[T]) Reload() (bool, error) {
+	return w.reload(true)
+}
+
+func (w *CfgWatcher[T]) watch(ctx context.Context, hup chan os.Signal) {
+	var tick <-chan time.Time
+	defer signal.Stop(hup)
+	if w.opts.interval > 0 {
+		t := time.NewTicker(w.opts.interval)
+		defer t.Stop()
+		tick = t.C
+	}
+
+	for {
+		var err error
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			_, err = w.reload(true)
+		case <-tick:
+			_, err = w.reload(false)
+		}
+		if err != nil {
+			w.opts.onError(err)
+		}
+	}
+}
+
+// reload force为false时文件内容未变化则跳过
+func (w *CfgWatcher[T]) reload(force bool) (bool, error) {
+	old, next, subs, err := w.swap(force)
+	if err != nil || next == nil {
+		return false, err
+	}
+	// 4. 释放锁后通知, 订阅者可以再次订阅或加载
+	if old != nil {
+		for _, fn := range subs {
+			fn(old, next)
+		}
+	}
+	return true, nil
+}
+
+// swap 加载并替换配置, 配置变化时返回新旧配置和订阅者快照
+func (w *CfgWatcher[T]) swap(force bool) (*T, *T, []CfgSubscriber[T], error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// 1. 比较文件内容
+	buf, err := os.ReadFile(w.path)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	sum := sha256.Sum256(buf)
+	if !force && bytes.Equal(sum[:], w.sum[:]) {
+		return nil, nil, nil, nil
+	}
+
+	w.sum = sum
+
+	// 2. 解析并校验, 失败时保留旧配置; 内容再次变化前不重复报错
+	next := new(T)
+	err = decodeCfg(w.path, buf, next, w.opts.cfg...)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	// 3. 原子替换, 复制订阅者
+	old := w.cur.Load()
+	if old != nil && reflect.DeepEqual(old, next) {
+		return nil, nil, nil, nil
+	}
+	w.cur.Store(next)
+	return old, next, append([]CfgSubscriber[T](nil), w.subs...), nil
+}
@@ -0,0 +1,157 @@
+package x_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/advancevillage/3rd/x"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_CfgWatcher(t *testing.T) {
+	var (
+		ctx, cancel = context.WithCancel(context.TODO())
+		path        = filepath.Join(t.TempDir(), "cfg.yaml")
+		changes     = make(chan [2]*x.Cfg, 4)
+		errs        = make(chan error, 4)
+	)
+	defer cancel()
+	write := func(s string) {
+		assert.Nil(t, os.WriteFile(path, []byte(s), 0o644))
+	}
+	write("app:\n  name: xmagic\n  port: 1995\nlog:\n  level: info\n")
+
+	w, err := x.NewCfgWatcher[x.Cfg](ctx, path, x.WithWatchInterval(10*time.Millisecond), x.WithWatchErrorHandler(func(err error) { errs <- err }))
+	assert.Nil(t, err)
+	w.Subscribe(func(old, new *x.Cfg) { changes <- [2]*x.Cfg{old, new} })
+	assert.Equal(t, "info", w.Load().Log.Level)
+
+	var data = []struct {
+		name  string
+		yaml  string
+		err   string
+		level string
+	}{
+		{name: "case-file-change", yaml: "app:\n  name: xmagic\n  port: 1995\nlog:\n  level: debug\n", level: "debug"},
+		{name: "case-invalid-kept", yaml: "app:\n  name: xmagic\n  port: 1995\nlog:\n  level: verbose\n", err: "log.level: must be one of", level: "debug"},
+	}
+	for _, v := range data {
+		f := func(t *testing.T) {
+			write(v.yaml)
+			if len(v.err) > 0 {
+				select {
+				case err := <-errs:
+					assert.ErrorContains(t, err, v.err)
+				case <-time.After(time.Second):
+					t.Fatal("reload error not reported")
+				}
+			} else {
+				select {
+				case c := <-changes:
+					assert.NotEqual(t, c[0].Log.Level, c[1].Log.Level)
+					assert.Equal(t, v.level, c[1].Log.Level)
+				case <-time.After(time.Second):
+					t.Fatal("change not notified")
+				}
+			}
+			assert.Equal(t, v.level, w.Load().Log.Level)
+		}
+		t.Run(v.name, f)
+	}
+}
+
+func Test_CfgWatcher_sighup(t *testing.T) {
+	var (
+		ctx, cancel = context.WithCancel(context.TODO())
+		path        = filepath.Join(t.TempDir(), "cfg.yaml")
+		got         = make(chan string, 1)
+	)
+	defer cancel()
+	assert.Nil(t, os.WriteFile(path, []byte("log:\n  level: debug\n"), 0o644))
+
+	// 不轮询, 仅由信号触发
+	w, err := x.NewCfgWatcher[x.Cfg](ctx, path, x.WithWatchInterval(0))
+	assert.Nil(t, err)
+	w.Subscribe(func(old, new *x.Cfg) { got <- old.Log.Level + "->" + new.Log.Level })
+	assert.Nil(t, os.WriteFile(path, []byte("log:\n  level: warn\n"), 0o644))
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, "debug", w.Load().Log.Level)
+
+	assert.Nil(t, syscall.Kill(os.Getpid(), syscall.SIGHUP))
+	select {
+	case s := <-got:
+		assert.Equal(t, "debug->warn", s)
+	case <-time.After(time.Second):
+		t.Fatal("sighup not handled")
+	}
+	assert.Equal(t, "warn", w.Load().Log.Level)
+}
+
+type testWatchLogger struct {
+	msgs chan []interface{}
+}
+
+func (l *testWatchLogger) Errorw(ctx context.Context, msg string, keysAndValues ...interface{}) {
+	l.msgs <- append([]interface{}{msg}, keysAndValues...)
+}
+
+func Test_CfgWatcher_logger(t *testing.T) {
+	var (
+		ctx, cancel = context.WithCancel(context.TODO())
+		path        = filepath.Join(t.TempDir(), "cfg.yaml")
+		logger      = &testWatchLogger{msgs: make(chan []interface{}, 4)}
+	)
+	defer cancel()
+	assert.Nil(t, os.WriteFile(path, []byte("log:\n  level: info\n"), 0o644))
+	_, err := x.NewCfgWatcher[x.Cfg](ctx, path, x.WithWatchInterval(10*time.Millisecond), x.WithWatchLogger(logger))
+	assert.Nil(t, err)
+
+	assert.Nil(t, os.WriteFile(path, []byte("log:\n  level: verbose\n"), 0o644))
+	select {
+	case kv := <-logger.msgs:
+		assert.Equal(t, "cfg reload failed", kv[0])
+		assert.Equal(t, path, kv[4])
+	case <-time.After(time.Second):
+		t.Fatal("reload error not logged")
+	}
+}
+
+func Test_CfgWatcher_reentrant(t *testing.T) {
+	var (
+		ctx, cancel = context.WithCancel(context.TODO())
+		path        = filepath.Join(t.TempDir(), "cfg.yaml")
+		got         = make(chan string, 4)
+	)
+	defer cancel()
+	assert.Nil(t, os.WriteFile(path, []byte("log:\n  level: info\n"), 0o644))
+	w, err := x.NewCfgWatcher[x.Cfg](ctx, path, x.WithWatchInterval(0))
+	assert.Nil(t, err)
+
+	// 订阅者中再次订阅和加载不死锁
+	w.Subscribe(func(old, new *x.Cfg) {
+		w.Subscribe(func(old, new *x.Cfg) { got <- "late:" + new.Log.Level })
+		changed, err := w.Reload()
+		assert.Nil(t, err)
+		assert.False(t, changed)
+		got <- new.Log.Level
+	})
+
+	assert.Nil(t, os.WriteFile(path, []byte("log:\n  level: debug\n"), 0o644))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		changed, err := w.Reload()
+		assert.Nil(t, err)
+		assert.True(t, changed)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("reload deadlocked in subscriber")
+	}
+	assert.Equal(t, "debug", <-got)
+}